@@ -0,0 +1,100 @@
+package mob
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"code.olapie.com/sugar/v2/xsqlite"
+)
+
+// Change operations of ChangeEvent
+const (
+	ChangeInsert = int(xsqlite.ChangeInsert)
+	ChangeUpdate = int(xsqlite.ChangeUpdate)
+	ChangeDelete = int(xsqlite.ChangeDelete)
+)
+
+// ChangeEvent is a change of xsqlite tables in types which can be exported by gomobile
+type ChangeEvent struct {
+	Table    string
+	Op       int
+	Key      string
+	Category int
+}
+
+type ChangeHandler interface {
+	OnChange(e *ChangeEvent)
+}
+
+// Subscription forwards change events of a xsqlite table to native handler until it's cancelled.
+// It's created in Go by SubscribeLocalTable, SubscribeSimpleTable or WatchKVTable, then returned to native code, e.g.
+//
+//	func (s *Store) SubscribeNotes(handler mob.ChangeHandler) *mob.Subscription {
+//		return mob.SubscribeLocalTable(s.notes, "notes", handler)
+//	}
+type Subscription struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	handler ChangeHandler
+}
+
+// SubscribeLocalTable forwards all changes of table, which is named as name in events
+func SubscribeLocalTable[R any](table *xsqlite.LocalTable[R], name string, handler ChangeHandler) *Subscription {
+	return subscribe(name, handler, func(ctx context.Context) <-chan *xsqlite.ChangeEvent[string] {
+		return table.Subscribe(ctx, nil)
+	})
+}
+
+// SubscribeSimpleTable forwards all changes of table, keys of which are formatted by fmt.Sprint
+func SubscribeSimpleTable[K xsqlite.SimpleKey, R xsqlite.SimpleTableRecord[K]](table *xsqlite.SimpleTable[K, R], name string, handler ChangeHandler) *Subscription {
+	return subscribe(name, handler, func(ctx context.Context) <-chan *xsqlite.ChangeEvent[K] {
+		return table.Subscribe(ctx, nil)
+	})
+}
+
+// WatchKVTable forwards changes of keys with prefix in table
+func WatchKVTable(table *xsqlite.KVTable, name, prefix string, handler ChangeHandler) *Subscription {
+	return subscribe(name, handler, func(ctx context.Context) <-chan *xsqlite.ChangeEvent[string] {
+		return table.Watch(ctx, prefix)
+	})
+}
+
+func subscribe[K xsqlite.SimpleKey](table string, handler ChangeHandler, subscribeFunc func(ctx context.Context) <-chan *xsqlite.ChangeEvent[K]) *Subscription {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Subscription{
+		ctx:     ctx,
+		cancel:  cancel,
+		handler: handler,
+	}
+	events := subscribeFunc(ctx)
+	go func() {
+		for e := range events {
+			s.notify(&ChangeEvent{
+				Table:    table,
+				Op:       int(e.Op),
+				Key:      fmt.Sprint(e.Key),
+				Category: e.Category,
+			})
+		}
+	}()
+	return s
+}
+
+// notify calls handler in order, it's ignored after the subscription is cancelled
+func (s *Subscription) notify(e *ChangeEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil || s.handler == nil {
+		return
+	}
+	s.handler.OnChange(e)
+}
+
+func (s *Subscription) Cancel() {
+	s.cancel()
+	s.mu.Lock()
+	s.handler = nil
+	s.mu.Unlock()
+}
@@ -0,0 +1,44 @@
+package mob
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"code.olapie.com/sugar/v2/xsqlite"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type changeRecorder chan *ChangeEvent
+
+func (r changeRecorder) OnChange(e *ChangeEvent) {
+	r <- e
+}
+
+func TestWatchKVTable(t *testing.T) {
+	db, err := xsqlite.Open(filepath.Join(t.TempDir(), "kv.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	table := xsqlite.NewKVTable(db)
+	recorder := make(changeRecorder, 10)
+	sub := WatchKVTable(table, "kv", "user.", recorder)
+	defer sub.Cancel()
+
+	if err = table.SaveString("app.theme", "dark"); err != nil {
+		t.Fatal(err)
+	}
+	if err = table.SaveString("user.name", "tom"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-recorder:
+		if e.Table != "kv" || e.Key != "user.name" || e.Op != ChangeInsert {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+}
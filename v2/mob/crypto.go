@@ -2,18 +2,22 @@ package mob
 
 import "code.olapie.com/sugar/v2/olasec"
 
+func useMobileKDF(options *olasec.Options) {
+	options.KDF = olasec.MobileKDF
+}
+
 func Encrypt(data []byte, passphrase string) []byte {
-	content, _ := olasec.Encrypt(data, passphrase)
+	content, _ := olasec.Encrypt(data, passphrase, useMobileKDF)
 	return content
 }
 
 func Decrypt(data []byte, passphrase string) []byte {
-	content, _ := olasec.Encrypt(data, passphrase)
+	content, _ := olasec.Decrypt(data, passphrase)
 	return content
 }
 
 func EncryptFile(src, dst, passphrase string) bool {
-	err := olasec.EncryptFile(olasec.SF(src), olasec.DF(dst), passphrase)
+	err := olasec.EncryptFile(olasec.SF(src), olasec.DF(dst), passphrase, useMobileKDF)
 	return err == nil
 }
 
@@ -4,16 +4,22 @@ go 1.19
 
 require (
 	code.olapie.com/sugar/v2 v2.1.1
+	code.olapie.com/sugar/v2/xsqlite v0.1.0
 	github.com/google/uuid v1.3.0
+	github.com/mattn/go-sqlite3 v1.14.16
 )
 
 require (
-	github.com/go-ping/ping v1.1.0 // indirect
 	github.com/golang/geo v0.0.0-20210211234256-740aa86cb551 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.1 // indirect
 	golang.org/x/crypto v0.5.0 // indirect
-	golang.org/x/net v0.5.0 // indirect
-	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
 	golang.org/x/sys v0.4.0 // indirect
 	golang.org/x/text v0.6.0 // indirect
 	google.golang.org/protobuf v1.28.1 // indirect
 )
+
+// mob depends on APIs of the local modules which haven't been published yet
+replace (
+	code.olapie.com/sugar/v2 => ../
+	code.olapie.com/sugar/v2/xsqlite => ../xsqlite
+)
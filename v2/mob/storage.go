@@ -2,13 +2,12 @@ package mob
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"io"
-	"mime/multipart"
-	"net/http"
 	"os"
 	"path/filepath"
 
+	"code.olapie.com/sugar/v2/xhttp"
 	"github.com/google/uuid"
 )
 
@@ -35,54 +34,27 @@ type ProgressHandler interface {
 	OnProgress(size int)
 }
 
-type progressBuffer struct {
-	buf bytes.Buffer
-	h   ProgressHandler
-}
-
-func (b *progressBuffer) Write(p []byte) (n int, err error) {
-	n, err = b.buf.Write(p)
-	if n > 0 && b.h != nil {
-		b.h.OnProgress(n)
-	}
-	return
-}
-
-func (b *progressBuffer) Read(p []byte) (n int, err error) {
-	n, err = b.buf.Read(p)
-	if n > 0 && b.h != nil {
-		b.h.OnProgress(n)
-	}
-	return
-}
-
 func (s *Storage) UploadImage(name string, data []byte, handler ProgressHandler) *StringE {
 	res := new(StringE)
-	buf := new(progressBuffer)
-	w := multipart.NewWriter(buf)
-	part, err := w.CreateFormFile("images", name)
-	if err != nil {
-		res.Error = ToError(err)
-		return res
-	}
-	if _, err = part.Write(data); err != nil {
-		res.Error = ToError(err)
-		return res
-	}
-	w.Close()
-
-	buf.h = handler
-	resp, err := http.Post(s.imageURL, w.FormDataContentType(), buf)
-	if err != nil {
-		res.Error = ToError(err)
-		return res
+	c := xhttp.NewPost[*xhttp.MultipartForm, []byte](s.imageURL)
+	if handler != nil {
+		var reported int64
+		c.UploadProgress = func(transferred, total int64) {
+			handler.OnProgress(int(transferred - reported))
+			reported = transferred
+		}
 	}
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.Call(context.Background(), &xhttp.MultipartForm{
+		Files: []*xhttp.FilePart{{
+			FieldName: "images",
+			FileName:  name,
+			Body:      bytes.NewReader(data),
+		}},
+	})
 	if err != nil {
 		res.Error = ToError(err)
 		return res
 	}
-	resp.Body.Close()
 	var url string
 	if err = json.Unmarshal(body, &url); err != nil {
 		res.Error = ToError(err)
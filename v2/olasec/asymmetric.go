@@ -33,18 +33,18 @@ func MustEncodePublicKey[K *ecdsa.PublicKey](k K) []byte {
 	return data
 }
 
-func EncodePrivateKey[K *ecdsa.PrivateKey](k K, passphrase string) ([]byte, error) {
+func EncodePrivateKey[K *ecdsa.PrivateKey](k K, passphrase string, optFns ...func(options *Options)) ([]byte, error) {
 	pk := (*ecdsa.PrivateKey)(k)
 	data, err := x509.MarshalECPrivateKey(pk)
 	if err != nil {
 		return nil, err
 	}
 
-	return Encrypt(data, passphrase)
+	return Encrypt(data, passphrase, optFns...)
 }
 
-func MustEncodePrivateKey[K *ecdsa.PrivateKey](k K, passphrase string) []byte {
-	data, err := EncodePrivateKey(k, passphrase)
+func MustEncodePrivateKey[K *ecdsa.PrivateKey](k K, passphrase string, optFns ...func(options *Options)) []byte {
+	data, err := EncodePrivateKey(k, passphrase, optFns...)
 	if err != nil {
 		panic(err)
 	}
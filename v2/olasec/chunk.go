@@ -0,0 +1,282 @@
+package olasec
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	chunkSizeFieldSize = 4
+	maxChunkSize       = 16 << 20
+	gcmNonceSize       = 12
+	gcmTagSize         = 16
+)
+
+// headerV2 layout: magic number | chunk size | kdf id | kdf params | salt | nonce prefix | key checksum
+type headerV2 struct {
+	chunkSize   int
+	kdf         KDF
+	salt        [SaltSize]byte
+	noncePrefix [NoncePrefixSize]byte
+	keyHash     keyHashType
+}
+
+func (h *headerV2) MarshalBinary() ([]byte, error) {
+	params := h.kdf.Params()
+	if len(params) > KDFParamsSize {
+		return nil, fmt.Errorf("kdf params exceed %d bytes", KDFParamsSize)
+	}
+	b := make([]byte, 0, HeaderSizeV2)
+	b = append(b, MagicNumberV2...)
+	b = binary.BigEndian.AppendUint32(b, uint32(h.chunkSize))
+	b = append(b, byte(h.kdf.ID()))
+	b = append(b, params...)
+	b = append(b, make([]byte, KDFParamsSize-len(params))...)
+	b = append(b, h.salt[:]...)
+	b = append(b, h.noncePrefix[:]...)
+	b = append(b, h.keyHash[:]...)
+	return b, nil
+}
+
+func (h *headerV2) UnmarshalBinary(data []byte) error {
+	if len(data) < HeaderSizeV2 || string(data[:MagicNumberSize]) != MagicNumberV2 {
+		return ErrKey
+	}
+	data = data[MagicNumberSize:]
+	chunkSize := binary.BigEndian.Uint32(data)
+	if chunkSize == 0 || chunkSize > maxChunkSize {
+		return ErrTampered
+	}
+	h.chunkSize = int(chunkSize)
+	data = data[chunkSizeFieldSize:]
+	kdf, err := decodeKDF(KDFID(data[0]), data[KDFIDSize:KDFIDSize+KDFParamsSize])
+	if err != nil {
+		return err
+	}
+	h.kdf = kdf
+	data = data[KDFIDSize+KDFParamsSize:]
+	data = data[copy(h.salt[:], data):]
+	data = data[copy(h.noncePrefix[:], data):]
+	copy(h.keyHash[:], data)
+	return nil
+}
+
+// chunkCipher seals and opens V2 chunks.
+// Every chunk is authenticated with the header as additional data,
+// and its nonce carries the chunk index and a last-chunk flag,
+// so that reordered, truncated or extended ciphertext is rejected
+type chunkCipher struct {
+	aead      cipher.AEAD
+	header    []byte
+	chunkSize int
+	prefix    [NoncePrefixSize]byte
+}
+
+func newEncryptionCipher(password string, options *Options) (*chunkCipher, error) {
+	h := &headerV2{
+		chunkSize: ChunkSize,
+		kdf:       options.KDF,
+	}
+	if _, err := io.ReadFull(rand.Reader, h.salt[:]); err != nil {
+		panic(err)
+	}
+	if _, err := io.ReadFull(rand.Reader, h.noncePrefix[:]); err != nil {
+		panic(err)
+	}
+	key, keyHash := deriveKeyV2(h.kdf, password, h.salt[:])
+	h.keyHash = keyHash
+	header, err := h.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return newChunkCipher(key, h.chunkSize, h.noncePrefix, header), nil
+}
+
+func newDecryptionCipher(header []byte, password string) (*chunkCipher, error) {
+	h := new(headerV2)
+	if err := h.UnmarshalBinary(header); err != nil {
+		return nil, err
+	}
+	key, keyHash := deriveKeyV2(h.kdf, password, h.salt[:])
+	if subtle.ConstantTimeCompare(keyHash[:], h.keyHash[:]) != 1 {
+		return nil, ErrKey
+	}
+	// copy header as data may be decrypted in place
+	return newChunkCipher(key, h.chunkSize, h.noncePrefix, append([]byte(nil), header[:HeaderSizeV2]...)), nil
+}
+
+func newChunkCipher(key Key, chunkSize int, noncePrefix [NoncePrefixSize]byte, header []byte) *chunkCipher {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return &chunkCipher{
+		aead:      aead,
+		header:    header,
+		chunkSize: chunkSize,
+		prefix:    noncePrefix,
+	}
+}
+
+// deriveKeyV2 derives the data key and its checksum from password and per-file salt
+func deriveKeyV2(kdf KDF, password string, salt []byte) (key Key, keyHash keyHashType) {
+	if len(password) == 0 {
+		panic("password is empty")
+	}
+	master := kdf.DeriveKey([]byte(password), salt, KeySize)
+	r := hkdf.New(sha256.New, master, salt, []byte(MagicNumberV2))
+	if _, err := io.ReadFull(r, key[:]); err != nil {
+		panic(err)
+	}
+	if _, err := io.ReadFull(r, keyHash[:]); err != nil {
+		panic(err)
+	}
+	return key, keyHash
+}
+
+func (c *chunkCipher) nonce(index int64, last bool) ([gcmNonceSize]byte, error) {
+	var nonce [gcmNonceSize]byte
+	if index < 0 || index > math.MaxUint32 {
+		return nonce, fmt.Errorf("chunk index out of range: %d", index)
+	}
+	copy(nonce[:], c.prefix[:])
+	binary.BigEndian.PutUint32(nonce[NoncePrefixSize:], uint32(index))
+	if last {
+		nonce[gcmNonceSize-1] = 1
+	}
+	return nonce, nil
+}
+
+func (c *chunkCipher) Seal(dst, plaintext []byte, index int64, last bool) ([]byte, error) {
+	nonce, err := c.nonce(index, last)
+	if err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(dst, nonce[:], plaintext, c.header), nil
+}
+
+func (c *chunkCipher) Open(dst, ciphertext []byte, index int64, last bool) ([]byte, error) {
+	nonce, err := c.nonce(index, last)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := c.aead.Open(dst, nonce[:], ciphertext, c.header)
+	if err != nil {
+		return nil, ErrTampered
+	}
+	return plaintext, nil
+}
+
+// EncryptedChunkSize returns size of a sealed full chunk
+func (c *chunkCipher) EncryptedChunkSize() int {
+	return c.chunkSize + gcmTagSize
+}
+
+// chunkReader reads fixed-size chunks from r.
+// It reads one byte ahead to tell whether a chunk is the last one
+type chunkReader struct {
+	r    io.Reader
+	buf  []byte
+	size int
+	n    int
+}
+
+func newChunkReader(r io.Reader, size int) *chunkReader {
+	return &chunkReader{
+		r:    r,
+		buf:  make([]byte, size+1),
+		size: size,
+	}
+}
+
+// Next returns the next chunk which is only valid until the following call
+func (c *chunkReader) Next() (chunk []byte, last bool, err error) {
+	if c.n > c.size {
+		c.buf[0] = c.buf[c.size]
+		c.n = 1
+	} else {
+		c.n = 0
+	}
+	n, err := io.ReadFull(c.r, c.buf[c.n:])
+	c.n += n
+	switch err {
+	case nil:
+		return c.buf[:c.size], false, nil
+	case io.EOF, io.ErrUnexpectedEOF:
+		return c.buf[:c.n], true, nil
+	default:
+		return nil, false, err
+	}
+}
+
+// readHeader reads header from r, and returns V1 stream or V2 chunk cipher according to magic number
+func readHeader(r io.Reader, password string) (*cipherStream, *chunkCipher, error) {
+	header := make([]byte, HeaderSizeV2)
+	if _, err := io.ReadFull(r, header[:MagicNumberSize]); err != nil {
+		return nil, nil, headerReadError(err)
+	}
+
+	size := headerSize(header)
+	if size == 0 {
+		return nil, nil, ErrKey
+	}
+
+	if _, err := io.ReadFull(r, header[MagicNumberSize:size]); err != nil {
+		return nil, nil, headerReadError(err)
+	}
+	return parseHeader(header[:size], password)
+}
+
+func parseHeader(header []byte, password string) (*cipherStream, *chunkCipher, error) {
+	switch string(header[:MagicNumberSize]) {
+	case MagicNumberV1:
+		stream := getCipherStream(password)
+		if !stream.ValidatePassword(header) {
+			return nil, nil, ErrKey
+		}
+		return stream, nil, nil
+	case MagicNumberV2:
+		c, err := newDecryptionCipher(header, password)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, c, nil
+	default:
+		return nil, nil, ErrKey
+	}
+}
+
+// headerSize returns header size according to magic number, or 0 if it's unknown
+func headerSize(data []byte) int {
+	if len(data) < MagicNumberSize {
+		return 0
+	}
+	switch string(data[:MagicNumberSize]) {
+	case MagicNumberV1:
+		return HeaderSize
+	case MagicNumberV2:
+		return HeaderSizeV2
+	default:
+		return 0
+	}
+}
+
+func headerReadError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTampered
+	}
+	return err
+}
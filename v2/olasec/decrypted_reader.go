@@ -7,36 +7,71 @@ import (
 var _ io.Reader = (*DecryptedReader)(nil)
 
 // DecryptedReader reads and decrypt data from original reader
+// Reading V2 data returns ErrTampered if it's modified or truncated
 type DecryptedReader struct {
 	r          io.Reader
-	stream     *cipherStream
+	open       func(r io.Reader) (*cipherStream, *chunkCipher, error)
 	readHeader bool
+
+	// V1
+	stream *cipherStream
+
+	// V2
+	cipher *chunkCipher
+	chunks *chunkReader
+	plain  []byte
+	buf    []byte
+	index  int64
+	done   bool
 }
 
 func NewDecryptedReader(r io.Reader, password string) *DecryptedReader {
 	return &DecryptedReader{
-		r:      r,
-		stream: getCipherStream(password),
+		r: r,
+		open: func(r io.Reader) (*cipherStream, *chunkCipher, error) {
+			return readHeader(r, password)
+		},
 	}
 }
 
 func (r *DecryptedReader) Read(p []byte) (n int, err error) {
 	if !r.readHeader {
-		r.readHeader = true
-		var header [HeaderSize]byte
-		_, err = r.r.Read(header[:])
+		r.stream, r.cipher, err = r.open(r.r)
 		if err != nil {
 			return 0, err
 		}
-		if !r.stream.ValidatePassword(header[:]) {
-			return 0, ErrKey
+		r.readHeader = true
+		if r.cipher != nil {
+			r.chunks = newChunkReader(r.r, r.cipher.EncryptedChunkSize())
 		}
 	}
 
-	n, err = r.r.Read(p)
-	if err != nil {
+	if r.stream != nil {
+		n, err = r.r.Read(p)
+		if n > 0 {
+			r.stream.XORKeyStream(p[:n], p[:n])
+		}
 		return n, err
 	}
-	r.stream.XORKeyStream(p, p)
+
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		chunk, last, err := r.chunks.Next()
+		if err != nil {
+			return 0, err
+		}
+		r.plain, err = r.cipher.Open(r.plain[:0], chunk, r.index, last)
+		if err != nil {
+			return 0, err
+		}
+		r.buf = r.plain
+		r.index++
+		r.done = last
+	}
+
+	n = copy(p, r.buf)
+	r.buf = r.buf[n:]
 	return n, nil
 }
@@ -0,0 +1,234 @@
+package olasec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+var (
+	_ io.ReaderAt   = (*DecryptedReaderAt)(nil)
+	_ io.ReadSeeker = (*DecryptedReaderAt)(nil)
+)
+
+// DecryptedReaderAt decrypts data at any offset of encrypted data, without decrypting data ahead of it
+// It implements io.ReadSeeker, so it can be served by http.ServeContent
+type DecryptedReaderAt struct {
+	r          io.ReaderAt
+	headerSize int64
+	size       int64
+	pos        int64
+
+	// V1
+	stream *cipherStream
+
+	// V2
+	cipher    *chunkCipher
+	numChunks int64
+
+	mu          sync.Mutex
+	cachedIndex int64
+	cached      []byte
+	buf         []byte
+}
+
+// NewDecryptedReaderAt creates DecryptedReaderAt on r which contains size bytes of encrypted data
+func NewDecryptedReaderAt(r io.ReaderAt, size int64, password string) (*DecryptedReaderAt, error) {
+	stream, c, err := readHeader(io.NewSectionReader(r, 0, size), password)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, MagicNumberSize+chunkSizeFieldSize)
+	n, _ := r.ReadAt(header, 0)
+	plainSize, err := decryptedSize(header[:n], size)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &DecryptedReaderAt{
+		r:           r,
+		headerSize:  int64(headerSize(header)),
+		size:        plainSize,
+		stream:      stream,
+		cipher:      c,
+		cachedIndex: -1,
+	}
+	if c != nil {
+		reader.numChunks = (size - reader.headerSize + int64(c.EncryptedChunkSize()) - 1) / int64(c.EncryptedChunkSize())
+	}
+	return reader, nil
+}
+
+// Size returns size of decrypted data
+func (r *DecryptedReaderAt) Size() int64 {
+	return r.size
+}
+
+func (r *DecryptedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.stream != nil {
+		return r.readAtV1(p, off)
+	}
+
+	n := 0
+	for n < len(p) && off < r.size {
+		m, err := r.readChunkAt(p[n:], off)
+		n += m
+		off += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *DecryptedReaderAt) readAtV1(p []byte, off int64) (int, error) {
+	var eof error
+	if remain := r.size - off; int64(len(p)) > remain {
+		p = p[:remain]
+		eof = io.EOF
+	}
+	n, err := r.r.ReadAt(p, r.headerSize+off)
+	r.stream.StreamAt(off).XORKeyStream(p[:n], p[:n])
+	if err == nil {
+		err = eof
+	}
+	return n, err
+}
+
+// readChunkAt copies data from the chunk which contains off
+func (r *DecryptedReaderAt) readChunkAt(p []byte, off int64) (int, error) {
+	chunkSize := int64(r.cipher.chunkSize)
+	index := off / chunkSize
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cachedIndex != index {
+		encSize := int64(r.cipher.EncryptedChunkSize())
+		encOff := r.headerSize + index*encSize
+		if cap(r.buf) < int(encSize) {
+			r.buf = make([]byte, encSize)
+		}
+		buf := r.buf[:encSize]
+		last := index == r.numChunks-1
+		if last {
+			buf = buf[:r.size-index*chunkSize+gcmTagSize]
+		}
+
+		n, err := r.r.ReadAt(buf, encOff)
+		if n < len(buf) {
+			if err == nil || err == io.EOF {
+				err = ErrTampered
+			}
+			return 0, err
+		}
+
+		r.cachedIndex = -1
+		r.cached, err = r.cipher.Open(r.cached[:0], buf, index, last)
+		if err != nil {
+			return 0, err
+		}
+		r.cachedIndex = index
+	}
+	return copy(p, r.cached[off-index*chunkSize:]), nil
+}
+
+func (r *DecryptedReaderAt) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *DecryptedReaderAt) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+// DecryptedSize returns size of decrypted data without decrypting it
+// r contains size bytes of encrypted data
+func DecryptedSize(r io.ReaderAt, size int64) (int64, error) {
+	header := make([]byte, MagicNumberSize+chunkSizeFieldSize)
+	n, err := r.ReadAt(header, 0)
+	if n < MagicNumberSize {
+		if err == nil || err == io.EOF {
+			err = ErrTampered
+		}
+		return 0, err
+	}
+	return decryptedSize(header[:n], size)
+}
+
+func DecryptedFileSize(filename string) (int64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat: %w", err)
+	}
+	return DecryptedSize(f, fi.Size())
+}
+
+func decryptedSize(header []byte, size int64) (int64, error) {
+	hSize := int64(headerSize(header))
+	if hSize == 0 {
+		return 0, ErrKey
+	}
+
+	if size < hSize {
+		return 0, ErrTampered
+	}
+
+	if string(header[:MagicNumberSize]) == MagicNumberV1 {
+		return size - hSize, nil
+	}
+
+	if len(header) < MagicNumberSize+chunkSizeFieldSize {
+		return 0, ErrTampered
+	}
+
+	chunkSize := int64(binary.BigEndian.Uint32(header[MagicNumberSize:]))
+	if chunkSize == 0 || chunkSize > maxChunkSize {
+		return 0, ErrTampered
+	}
+
+	// Only the last chunk can be shorter than a full chunk, and it's empty only if all data is empty
+	body := size - hSize
+	encChunkSize := chunkSize + gcmTagSize
+	numChunks := (body + encChunkSize - 1) / encChunkSize
+	lastSize := body - (numChunks-1)*encChunkSize
+	if body < gcmTagSize || (numChunks > 1 && lastSize <= gcmTagSize) {
+		return 0, ErrTampered
+	}
+	return body - numChunks*gcmTagSize, nil
+}
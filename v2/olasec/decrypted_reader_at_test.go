@@ -0,0 +1,92 @@
+package olasec_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"code.olapie.com/sugar/v2/olasec"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+func TestDecryptedReaderAt(t *testing.T) {
+	for _, size := range []int{0, 10, olasec.ChunkSize, 3*olasec.ChunkSize + 100} {
+		raw := xtest.RandomBytes(size)
+		enc, err := olasec.Encrypt(raw, "123")
+		xtest.NoError(t, err)
+
+		plainSize, err := olasec.DecryptedSize(bytes.NewReader(enc), int64(len(enc)))
+		xtest.NoError(t, err)
+		xtest.Equal(t, int64(size), plainSize)
+
+		r, err := olasec.NewDecryptedReaderAt(bytes.NewReader(enc), int64(len(enc)), "123")
+		xtest.NoError(t, err)
+		xtest.Equal(t, int64(size), r.Size())
+		testReadAt(t, r, raw)
+	}
+}
+
+func TestDecryptedReaderAt_V1(t *testing.T) {
+	enc, err := hex.DecodeString(v1Data)
+	xtest.NoError(t, err)
+	r, err := olasec.NewDecryptedReaderAt(bytes.NewReader(enc), int64(len(enc)), "123")
+	xtest.NoError(t, err)
+	xtest.Equal(t, int64(len(v1Raw)), r.Size())
+	testReadAt(t, r, []byte(v1Raw))
+}
+
+func testReadAt(t *testing.T, r *olasec.DecryptedReaderAt, raw []byte) {
+	all, err := io.ReadAll(r)
+	xtest.NoError(t, err)
+	xtest.Equal(t, raw, append([]byte{}, all...))
+
+	for i := 0; i < 20 && len(raw) > 0; i++ {
+		off := rand.Intn(len(raw))
+		n := rand.Intn(len(raw)-off) + 1
+		p := make([]byte, n)
+		m, err := r.ReadAt(p, int64(off))
+		xtest.NoError(t, err)
+		xtest.Equal(t, n, m)
+		xtest.Equal(t, raw[off:off+n], p)
+	}
+
+	_, err = r.ReadAt(make([]byte, 1), int64(len(raw)))
+	xtest.True(t, errors.Is(err, io.EOF))
+}
+
+func TestDecryptedReaderAt_ServeContent(t *testing.T) {
+	raw := xtest.RandomBytes(2*olasec.ChunkSize + 100)
+	enc, err := olasec.Encrypt(raw, "123")
+	xtest.NoError(t, err)
+	r, err := olasec.NewDecryptedReaderAt(bytes.NewReader(enc), int64(len(enc)), "123")
+	xtest.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/video.mp4", nil)
+	req.Header.Set("Range", "bytes=65530-65545")
+	rec := httptest.NewRecorder()
+	http.ServeContent(rec, req, "video.mp4", time.Time{}, r)
+	xtest.Equal(t, http.StatusPartialContent, rec.Code)
+	xtest.Equal(t, raw[65530:65546], rec.Body.Bytes())
+}
+
+func TestDecryptedReaderAt_Tampered(t *testing.T) {
+	raw := xtest.RandomBytes(2*olasec.ChunkSize + 100)
+	enc, err := olasec.Encrypt(raw, "123")
+	xtest.NoError(t, err)
+	enc[len(enc)-20] ^= 1
+	r, err := olasec.NewDecryptedReaderAt(bytes.NewReader(enc), int64(len(enc)), "123")
+	xtest.NoError(t, err)
+	_, err = r.ReadAt(make([]byte, 10), 10)
+	xtest.NoError(t, err)
+	_, err = r.ReadAt(make([]byte, 10), int64(len(raw)-10))
+	xtest.True(t, errors.Is(err, olasec.ErrTampered), err)
+
+	_, err = olasec.DecryptedSize(bytes.NewReader(enc[:len(enc)-100]), int64(len(enc)-100))
+	xtest.True(t, errors.Is(err, olasec.ErrTampered), err)
+}
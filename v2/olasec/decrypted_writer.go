@@ -1,52 +1,114 @@
 package olasec
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 )
 
-var _ io.Writer = (*DecryptedWriter)(nil)
+var _ io.WriteCloser = (*DecryptedWriter)(nil)
 
 // DecryptedWriter decrypts and writes data into original Writer
+// Close must be called to decrypt the last chunk of V2 data, it doesn't close the original writer
 type DecryptedWriter struct {
 	w               io.Writer
-	stream          *cipherStream
-	buf             bytes.Buffer
+	password        string
+	buf             []byte
 	headerDecrypted bool
+	closed          bool
+
+	// V1
+	stream *cipherStream
+
+	// V2
+	cipher *chunkCipher
+	plain  []byte
+	index  int64
 }
 
 func NewDecryptedWriter(w io.Writer, password string) *DecryptedWriter {
 	return &DecryptedWriter{
-		w:      w,
-		stream: getCipherStream(password),
+		w:        w,
+		password: password,
 	}
 }
 
 func (w *DecryptedWriter) Write(p []byte) (n int, err error) {
-	n, err = w.buf.Write(p)
-	if err != nil {
-		return 0, err
+	if w.closed {
+		return 0, io.ErrClosedPipe
 	}
 
+	w.buf = append(w.buf, p...)
 	if !w.headerDecrypted {
-		if w.buf.Len() < HeaderSize {
+		if len(w.buf) < MagicNumberSize {
 			return len(p), nil
 		}
 
-		w.headerDecrypted = true
-		header := w.buf.Next(HeaderSize)
-		if !w.stream.ValidatePassword(header) {
+		size := headerSize(w.buf)
+		if size == 0 {
 			return 0, ErrKey
 		}
+
+		if len(w.buf) < size {
+			return len(p), nil
+		}
+
+		w.stream, w.cipher, err = parseHeader(w.buf[:size], w.password)
+		if err != nil {
+			return 0, err
+		}
+		w.headerDecrypted = true
+		w.buf = w.buf[size:]
 	}
 
-	offset := n - w.buf.Len()
-	w.stream.XORKeyStream(w.buf.Bytes(), w.buf.Bytes())
-	n, err = w.w.Write(w.buf.Bytes())
-	w.buf.Reset()
-	if err != nil {
-		return n + offset, fmt.Errorf("cannot write: %w", err)
+	if w.stream != nil {
+		w.stream.XORKeyStream(w.buf, w.buf)
+		_, err = w.w.Write(w.buf)
+		w.buf = w.buf[:0]
+		if err != nil {
+			return 0, fmt.Errorf("cannot write: %w", err)
+		}
+		return len(p), nil
 	}
+
+	// Keep at least one chunk in buffer, as the last chunk can only be decrypted in Close
+	size := w.cipher.EncryptedChunkSize()
+	offset := 0
+	for len(w.buf)-offset > size {
+		if err = w.writeChunk(w.buf[offset:offset+size], false); err != nil {
+			return 0, err
+		}
+		offset += size
+	}
+	w.buf = append(w.buf[:0], w.buf[offset:]...)
 	return len(p), nil
 }
+
+// Close decrypts the last chunk
+// It returns ErrTampered if data is truncated
+func (w *DecryptedWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if !w.headerDecrypted {
+		return ErrTampered
+	}
+	if w.stream != nil {
+		return nil
+	}
+	return w.writeChunk(w.buf, true)
+}
+
+func (w *DecryptedWriter) writeChunk(chunk []byte, last bool) error {
+	plain, err := w.cipher.Open(w.plain[:0], chunk, w.index, last)
+	if err != nil {
+		return err
+	}
+	w.plain = plain
+	w.index++
+	_, err = w.w.Write(plain)
+	if err != nil {
+		return fmt.Errorf("cannot write: %w", err)
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package olasec_test
 
 import (
 	"bytes"
+	"encoding/hex"
+	"errors"
 	"io"
 	"testing"
 	"time"
@@ -21,5 +23,27 @@ func TestDecryptedWriter(t *testing.T) {
 	n, err := io.Copy(w, bytes.NewReader(enc))
 	t.Log(n)
 	xtest.NoError(t, err)
+	xtest.NoError(t, w.Close())
 	xtest.Equal(t, raw, dec.Bytes())
 }
+
+func TestDecryptedWriter_V1(t *testing.T) {
+	enc, err := hex.DecodeString(v1Data)
+	xtest.NoError(t, err)
+	dec := &bytes.Buffer{}
+	w := olasec.NewDecryptedWriter(dec, "123")
+	_, err = io.Copy(w, bytes.NewReader(enc))
+	xtest.NoError(t, err)
+	xtest.NoError(t, w.Close())
+	xtest.Equal(t, v1Raw, dec.String())
+}
+
+func TestDecryptedWriter_Truncated(t *testing.T) {
+	raw := xtest.RandomBytes(2*olasec.ChunkSize + 5)
+	enc, err := olasec.Encrypt(raw, "123")
+	xtest.NoError(t, err)
+	w := olasec.NewDecryptedWriter(io.Discard, "123")
+	_, err = w.Write(enc[:len(enc)-10])
+	xtest.NoError(t, err)
+	xtest.True(t, errors.Is(w.Close(), olasec.ErrTampered))
+}
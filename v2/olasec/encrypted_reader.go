@@ -8,38 +8,49 @@ var _ io.Reader = (*EncryptedReader)(nil)
 
 // EncryptedReader reads and encrypts data from original reader
 type EncryptedReader struct {
-	r      io.Reader
-	stream *cipherStream
-	header []byte
+	r      *chunkReader
+	cipher *chunkCipher
+	out    []byte
+	buf    []byte
+	index  int64
+	done   bool
+	err    error
 }
 
-func NewEncryptedReader(r io.Reader, password string) *EncryptedReader {
-	reader := &EncryptedReader{
-		r:      r,
-		stream: getCipherStream(password),
+func NewEncryptedReader(r io.Reader, password string, optFns ...func(options *Options)) *EncryptedReader {
+	c, err := newEncryptionCipher(password, getOptions(optFns))
+	if err != nil {
+		return &EncryptedReader{err: err}
+	}
+	return &EncryptedReader{
+		r:      newChunkReader(r, c.chunkSize),
+		cipher: c,
+		buf:    c.header,
 	}
-
-	reader.header = []byte(MagicNumberV1)
-	reader.header = append(reader.header, reader.stream.keyHash[:]...)
-	return reader
 }
 
 func (r *EncryptedReader) Read(p []byte) (int, error) {
-	offset := 0
-	data := p
-	if len(r.header) > 0 {
-		n := copy(p, r.header)
-		r.header = r.header[n:]
-		if n == len(p) {
-			return n, nil
+	if r.err != nil {
+		return 0, r.err
+	}
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
 		}
-		data = p[n:]
-		offset = n
+		chunk, last, err := r.r.Next()
+		if err != nil {
+			return 0, err
+		}
+		r.out, err = r.cipher.Seal(r.out[:0], chunk, r.index, last)
+		if err != nil {
+			return 0, err
+		}
+		r.buf = r.out
+		r.index++
+		r.done = last
 	}
 
-	n, err := r.r.Read(data)
-	if n > 0 {
-		r.stream.XORKeyStream(data[:n], data[:n])
-	}
-	return offset + n, err
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
 }
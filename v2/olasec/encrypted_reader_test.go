@@ -13,17 +13,19 @@ import (
 )
 
 func TestEncryptedReader(t *testing.T) {
-	raw := []byte(xhash.SHA1(time.Now().String()))
-	enc := &bytes.Buffer{}
-	{
+	for _, raw := range [][]byte{
+		[]byte(xhash.SHA1(time.Now().String())),
+		xtest.RandomBytes(olasec.ChunkSize),
+		xtest.RandomBytes(3*olasec.ChunkSize + 7),
+	} {
+		enc := &bytes.Buffer{}
 		r := olasec.NewEncryptedReader(bytes.NewReader(raw), "123")
 		n, err := io.Copy(enc, r)
 		xtest.NoError(t, err)
 		t.Log(n)
-	}
-	{
-		data, err := olasec.Encrypt(raw, "123")
+		xtest.True(t, olasec.IsEncrypted(enc.Bytes()))
+		dec, err := olasec.Decrypt(enc.Bytes(), "123")
 		xtest.NoError(t, err)
-		xtest.Equal(t, enc.Bytes(), data)
+		xtest.Equal(t, raw, dec)
 	}
 }
@@ -1,47 +1,103 @@
 package olasec
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 )
 
-var _ io.Writer = (*EncryptedWriter)(nil)
+var _ io.WriteCloser = (*EncryptedWriter)(nil)
 
 // EncryptedWriter encrypts and write data into original writer
+// Close must be called to write the last chunk, it doesn't close the original writer
 type EncryptedWriter struct {
 	w             io.Writer
-	stream        *cipherStream
-	buf           bytes.Buffer
+	cipher        *chunkCipher
+	buf           []byte
+	out           []byte
+	index         int64
+	err           error
 	headerWritten bool
+	closed        bool
 }
 
-func NewEncryptedWriter(w io.Writer, password string) *EncryptedWriter {
+func NewEncryptedWriter(w io.Writer, password string, optFns ...func(options *Options)) *EncryptedWriter {
+	c, err := newEncryptionCipher(password, getOptions(optFns))
+	return newEncryptedWriter(w, c, err)
+}
+
+func newEncryptedWriter(w io.Writer, c *chunkCipher, err error) *EncryptedWriter {
+	if err != nil {
+		return &EncryptedWriter{w: w, err: err}
+	}
 	return &EncryptedWriter{
 		w:      w,
-		stream: getCipherStream(password),
+		cipher: c,
+		buf:    make([]byte, 0, c.chunkSize),
 	}
 }
 
 func (w *EncryptedWriter) Write(p []byte) (int, error) {
-	if !w.headerWritten {
-		_, err := w.w.Write([]byte(MagicNumberV1))
-		if err != nil {
-			return 0, err
-		}
-		_, err = w.w.Write(w.stream.keyHash[:])
-		if err != nil {
-			return 0, err
+	if w.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	if err := w.writeHeader(); err != nil {
+		return 0, err
+	}
+
+	total := len(p)
+	for len(p) > 0 {
+		// A full chunk is followed by more data, so it isn't the last one
+		if len(w.buf) == w.cipher.chunkSize {
+			if err := w.writeChunk(false); err != nil {
+				return total - len(p), err
+			}
 		}
-		w.headerWritten = true
+		n := copy(w.buf[len(w.buf):w.cipher.chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close writes the last chunk
+func (w *EncryptedWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err := w.writeHeader(); err != nil {
+		return err
 	}
+	return w.writeChunk(true)
+}
 
-	w.buf.Write(p)
-	w.stream.XORKeyStream(w.buf.Bytes(), w.buf.Bytes())
-	n, err := w.w.Write(w.buf.Bytes())
-	w.buf.Reset()
+func (w *EncryptedWriter) writeHeader() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.headerWritten {
+		return nil
+	}
+	_, err := w.w.Write(w.cipher.header)
+	if err != nil {
+		return err
+	}
+	w.headerWritten = true
+	return nil
+}
+
+func (w *EncryptedWriter) writeChunk(last bool) error {
+	out, err := w.cipher.Seal(w.out[:0], w.buf, w.index, last)
+	if err != nil {
+		return err
+	}
+	w.out = out
+	w.buf = w.buf[:0]
+	w.index++
+	_, err = w.w.Write(out)
 	if err != nil {
-		return n, fmt.Errorf("cannot write: %w", err)
+		return fmt.Errorf("cannot write: %w", err)
 	}
-	return n, nil
+	return nil
 }
@@ -13,13 +13,19 @@ import (
 )
 
 func TestEncryptedWriter(t *testing.T) {
-	raw := []byte(xhash.SHA1(time.Now().String()))
-	enc := &bytes.Buffer{}
-	w := olasec.NewEncryptedWriter(enc, "123")
-	n, err := io.Copy(w, bytes.NewReader(raw))
-	xtest.NoError(t, err)
-	t.Log(n)
-	data, err := olasec.Encrypt(raw, "123")
-	xtest.NoError(t, err)
-	xtest.Equal(t, enc.Bytes(), data)
+	for _, raw := range [][]byte{
+		[]byte(xhash.SHA1(time.Now().String())),
+		xtest.RandomBytes(olasec.ChunkSize),
+		xtest.RandomBytes(3*olasec.ChunkSize + 7),
+	} {
+		enc := &bytes.Buffer{}
+		w := olasec.NewEncryptedWriter(enc, "123")
+		n, err := io.Copy(w, bytes.NewReader(raw))
+		xtest.NoError(t, err)
+		t.Log(n)
+		xtest.NoError(t, w.Close())
+		dec, err := olasec.Decrypt(enc.Bytes(), "123")
+		xtest.NoError(t, err)
+		xtest.Equal(t, raw, dec)
+	}
 }
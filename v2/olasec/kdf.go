@@ -0,0 +1,219 @@
+package olasec
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+type KDFID uint8
+
+const (
+	KDFArgon2ID     KDFID = 1
+	KDFScrypt       KDFID = 2
+	KDFPBKDF2SHA256 KDFID = 3
+
+	KDFIDSize     = 1
+	KDFParamsSize = 12
+)
+
+// KDF derives key from password and salt
+// ID and Params are written into V2 header, so that data can be decrypted after cost parameters are changed
+type KDF interface {
+	ID() KDFID
+	// Params returns encoded cost parameters which is no longer than KDFParamsSize
+	Params() []byte
+	DeriveKey(password, salt []byte, keyLen int) []byte
+}
+
+// KDFDecoder decodes KDF from its encoded cost parameters
+type KDFDecoder func(params []byte) (KDF, error)
+
+var (
+	// ServerKDF is for password protected data on servers
+	ServerKDF KDF = Argon2ID{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+	// MobileKDF is cheaper than ServerKDF for mobile devices
+	MobileKDF KDF = Argon2ID{Time: 2, Memory: 19 * 1024, Threads: 1}
+
+	// DefaultKDF is used by encryption if no other KDF is provided.
+	// Callers which encrypt many small records with high entropy keys should provide a cheaper KDF explicitly
+	DefaultKDF = MobileKDF
+)
+
+var kdfMu sync.RWMutex
+var kdfDecoders = map[KDFID]KDFDecoder{
+	KDFArgon2ID:     decodeArgon2ID,
+	KDFScrypt:       decodeScrypt,
+	KDFPBKDF2SHA256: decodePBKDF2SHA256,
+}
+
+// RegisterKDF registers decoder for KDF id, it overrides the previous registered one
+func RegisterKDF(id KDFID, decoder KDFDecoder) {
+	if decoder == nil {
+		panic("decoder is nil")
+	}
+	kdfMu.Lock()
+	kdfDecoders[id] = decoder
+	kdfMu.Unlock()
+}
+
+func decodeKDF(id KDFID, params []byte) (KDF, error) {
+	kdfMu.RLock()
+	decoder := kdfDecoders[id]
+	kdfMu.RUnlock()
+	if decoder == nil {
+		return nil, fmt.Errorf("unsupported kdf: %d", id)
+	}
+	return decoder(params)
+}
+
+// Argon2ID is argon2id with Memory in KiB
+type Argon2ID struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+var _ KDF = Argon2ID{}
+
+// Limits of cost parameters decoded from headers, which are 4 times of ServerKDF,
+// so that crafted data can't exhaust memory or CPU while decrypting
+const (
+	maxArgon2Time    = 12
+	maxArgon2Memory  = 256 * 1024
+	maxArgon2Threads = 16
+)
+
+func (a Argon2ID) ID() KDFID {
+	return KDFArgon2ID
+}
+
+func (a Argon2ID) Params() []byte {
+	b := binary.BigEndian.AppendUint32(nil, a.Time)
+	b = binary.BigEndian.AppendUint32(b, a.Memory)
+	return append(b, a.Threads)
+}
+
+func (a Argon2ID) DeriveKey(password, salt []byte, keyLen int) []byte {
+	return argon2.IDKey(password, salt, a.Time, a.Memory, a.Threads, uint32(keyLen))
+}
+
+func decodeArgon2ID(params []byte) (KDF, error) {
+	a := Argon2ID{
+		Time:    binary.BigEndian.Uint32(params),
+		Memory:  binary.BigEndian.Uint32(params[4:]),
+		Threads: params[8],
+	}
+	if a.Time == 0 || a.Time > maxArgon2Time || a.Threads == 0 || a.Threads > maxArgon2Threads ||
+		a.Memory == 0 || a.Memory > maxArgon2Memory {
+		return nil, fmt.Errorf("invalid argon2id params: %+v", a)
+	}
+	return a, nil
+}
+
+// Scrypt is scrypt with N = 1<<LogN
+type Scrypt struct {
+	LogN uint8
+	R    uint32
+	P    uint32
+}
+
+var _ KDF = Scrypt{}
+
+// Limits of scrypt, which uses 128*R*N bytes of memory and runs in time proportional to N*R*P
+const (
+	maxScryptLogN   = 20
+	maxScryptMemory = 256 << 20
+	maxScryptWork   = 1 << 24
+)
+
+func (s Scrypt) ID() KDFID {
+	return KDFScrypt
+}
+
+func (s Scrypt) Params() []byte {
+	b := []byte{s.LogN}
+	b = binary.BigEndian.AppendUint32(b, s.R)
+	return binary.BigEndian.AppendUint32(b, s.P)
+}
+
+func (s Scrypt) DeriveKey(password, salt []byte, keyLen int) []byte {
+	k, err := scrypt.Key(password, salt, 1<<s.LogN, int(s.R), int(s.P), keyLen)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+func decodeScrypt(params []byte) (KDF, error) {
+	s := Scrypt{
+		LogN: params[0],
+		R:    binary.BigEndian.Uint32(params[1:]),
+		P:    binary.BigEndian.Uint32(params[5:]),
+	}
+	if s.LogN == 0 || s.LogN > maxScryptLogN || s.R == 0 || s.P == 0 ||
+		128*uint64(s.R)<<s.LogN > maxScryptMemory || uint64(s.R)*uint64(s.P)<<s.LogN > maxScryptWork {
+		return nil, fmt.Errorf("invalid scrypt params: %+v", s)
+	}
+	return s, nil
+}
+
+// PBKDF2SHA256 is PBKDF2 with HMAC-SHA256
+type PBKDF2SHA256 struct {
+	Iterations uint32
+}
+
+var _ KDF = PBKDF2SHA256{}
+
+// maxPBKDF2Iterations is about 4 times of the recommended 600,000
+const maxPBKDF2Iterations = 1 << 22
+
+func (p PBKDF2SHA256) ID() KDFID {
+	return KDFPBKDF2SHA256
+}
+
+func (p PBKDF2SHA256) Params() []byte {
+	return binary.BigEndian.AppendUint32(nil, p.Iterations)
+}
+
+func (p PBKDF2SHA256) DeriveKey(password, salt []byte, keyLen int) []byte {
+	return pbkdf2.Key(password, salt, int(p.Iterations), keyLen, sha256.New)
+}
+
+func decodePBKDF2SHA256(params []byte) (KDF, error) {
+	p := PBKDF2SHA256{
+		Iterations: binary.BigEndian.Uint32(params),
+	}
+	if p.Iterations == 0 || p.Iterations > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("invalid pbkdf2 params: %+v", p)
+	}
+	return p, nil
+}
+
+// Options of encryption
+type Options struct {
+	// KDF derives key from password, DefaultKDF is used if it's nil
+	KDF KDF
+}
+
+func getOptions(optFns []func(options *Options)) *Options {
+	options := &Options{}
+	for _, fn := range optFns {
+		fn(options)
+	}
+	if options.KDF == nil {
+		options.KDF = DefaultKDF
+	}
+	return options
+}
+
+// sameKDF reports whether a and b are the same algorithm with the same cost parameters
+func sameKDF(a, b KDF) bool {
+	return a.ID() == b.ID() && string(a.Params()) == string(b.Params())
+}
@@ -0,0 +1,114 @@
+package olasec_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"code.olapie.com/sugar/v2/olasec"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+func TestKDF(t *testing.T) {
+	raw := xtest.RandomBytes(100)
+	for _, kdf := range []olasec.KDF{
+		olasec.Argon2ID{Time: 1, Memory: 1024, Threads: 2},
+		olasec.Scrypt{LogN: 10, R: 8, P: 1},
+		olasec.PBKDF2SHA256{Iterations: 1000},
+	} {
+		enc, err := olasec.Encrypt(raw, "123", func(options *olasec.Options) {
+			options.KDF = kdf
+		})
+		xtest.NoError(t, err)
+		xtest.True(t, olasec.ValidatePassword(enc, "123"))
+		xtest.False(t, olasec.ValidatePassword(enc, "1234"))
+		dec, err := olasec.Decrypt(enc, "123")
+		xtest.NoError(t, err)
+		xtest.Equal(t, raw, dec)
+		xtest.True(t, olasec.IsOutdated(enc))
+	}
+}
+
+func TestReEncrypt_Upgrade(t *testing.T) {
+	raw := xtest.RandomBytes(100)
+	enc, err := olasec.Encrypt(raw, "123")
+	xtest.NoError(t, err)
+	xtest.False(t, olasec.IsOutdated(enc))
+
+	stronger := func(options *olasec.Options) {
+		options.KDF = olasec.Argon2ID{Time: 2, Memory: 1024, Threads: 1}
+	}
+	xtest.True(t, olasec.IsOutdated(enc, stronger))
+	upgraded, err := olasec.ReEncrypt(enc, "123", "123", stronger)
+	xtest.NoError(t, err)
+	xtest.False(t, olasec.IsOutdated(upgraded, stronger))
+	dec, err := olasec.Decrypt(upgraded, "123")
+	xtest.NoError(t, err)
+	xtest.Equal(t, raw, dec)
+}
+
+type xorKDF struct {
+	b byte
+}
+
+func (k xorKDF) ID() olasec.KDFID {
+	return 100
+}
+
+func (k xorKDF) Params() []byte {
+	return []byte{k.b}
+}
+
+func (k xorKDF) DeriveKey(password, salt []byte, keyLen int) []byte {
+	key := bytes.Repeat([]byte{k.b}, keyLen)
+	for i, c := range append(password, salt...) {
+		key[i%keyLen] ^= c
+	}
+	return key
+}
+
+func TestRegisterKDF(t *testing.T) {
+	raw := xtest.RandomBytes(100)
+	enc, err := olasec.Encrypt(raw, "123", func(options *olasec.Options) {
+		options.KDF = xorKDF{b: 7}
+	})
+	xtest.NoError(t, err)
+	_, err = olasec.Decrypt(enc, "123")
+	xtest.Error(t, err)
+
+	olasec.RegisterKDF(100, func(params []byte) (olasec.KDF, error) {
+		return xorKDF{b: params[0]}, nil
+	})
+	dec, err := olasec.Decrypt(enc, "123")
+	xtest.NoError(t, err)
+	xtest.Equal(t, raw, dec)
+}
+
+func TestDecrypt_ExcessiveKDFCost(t *testing.T) {
+	paramsOffset := olasec.HeaderSizeV2 - olasec.KeyHashSize - olasec.NoncePrefixSize - olasec.SaltSize - olasec.KDFParamsSize
+	for name, kdf := range map[string]olasec.KDF{
+		"Argon2Memory": olasec.Argon2ID{Time: 1, Memory: 1 << 30, Threads: 1},
+		"Argon2Time":   olasec.Argon2ID{Time: 1 << 20, Memory: 1024, Threads: 1},
+		"ScryptLogN":   olasec.Scrypt{LogN: 24, R: 8, P: 1},
+		"ScryptWork":   olasec.Scrypt{LogN: 16, R: 8, P: 1 << 20},
+		"PBKDF2":       olasec.PBKDF2SHA256{Iterations: 1 << 30},
+	} {
+		t.Run(name, func(t *testing.T) {
+			enc, err := olasec.Encrypt(xtest.RandomBytes(100), "123", func(options *olasec.Options) {
+				options.KDF = olasec.PBKDF2SHA256{Iterations: 1}
+			})
+			xtest.NoError(t, err)
+			// forge header with excessive cost parameters of the same kdf
+			enc[paramsOffset-olasec.KDFIDSize] = byte(kdf.ID())
+			params := make([]byte, olasec.KDFParamsSize)
+			copy(params, kdf.Params())
+			copy(enc[paramsOffset:], params)
+
+			start := time.Now()
+			xtest.False(t, olasec.ValidatePassword(enc, "123"))
+			_, err = olasec.Decrypt(enc, "123")
+			xtest.Error(t, err)
+			xtest.True(t, time.Since(start) < time.Second)
+		})
+	}
+}
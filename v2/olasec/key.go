@@ -53,16 +53,40 @@ func getCipherStream(password string) *cipherStream {
 	if err != nil {
 		panic(err)
 	}
-	stream := cipher.NewCTR(block, (key)[KeySize/2:])
+	iv := (key)[KeySize/2:]
+	stream := cipher.NewCTR(block, iv)
 	return &cipherStream{
 		keyHash: hashKey(key),
 		Stream:  stream,
+		block:   block,
+		iv:      iv,
 	}
 }
 
 type cipherStream struct {
 	keyHash keyHashType
 	cipher.Stream
+	block cipher.Block
+	iv    []byte
+}
+
+// StreamAt returns a new stream which starts from offset of data
+func (i *cipherStream) StreamAt(offset int64) cipher.Stream {
+	// CTR counter is the big-endian iv increased by one for every block
+	iv := make([]byte, len(i.iv))
+	copy(iv, i.iv)
+	carry := uint64(offset / aes.BlockSize)
+	for j := len(iv) - 1; j >= 0 && carry > 0; j-- {
+		sum := uint64(iv[j]) + carry&0xff
+		iv[j] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+	stream := cipher.NewCTR(i.block, iv)
+	if skip := offset % aes.BlockSize; skip > 0 {
+		var discard [aes.BlockSize]byte
+		stream.XORKeyStream(discard[:skip], discard[:skip])
+	}
+	return stream
 }
 
 func (i *cipherStream) ValidatePassword(data []byte) bool {
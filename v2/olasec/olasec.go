@@ -11,16 +11,25 @@ import (
 
 // MagicNumberV1 is a defined 4-byte number to identify file type
 // refer to https://en.wikipedia.org/wiki/List_of_file_signatures
-// Header layout: magic number | key checksum
+// V1 header layout: magic number | key checksum, followed by AES-CTR stream
+// V2 header layout: magic number | chunk size | kdf id | kdf params | salt | nonce prefix | key checksum,
+// followed by AES-GCM sealed chunks. The last chunk may be shorter than chunk size
 const (
 	MagicNumberV1 = "\xFE\xF1\xFD\x01"
+	MagicNumberV2 = "\xFE\xF1\xFD\x02"
 
 	MagicNumberSize = len(MagicNumberV1)
 	KeySize         = 32
 	KeyHashSize     = 16
 	HeaderSize      = MagicNumberSize + KeyHashSize
 
-	ErrKey xerror.String = "invalid key"
+	SaltSize        = 16
+	NoncePrefixSize = 7
+	ChunkSize       = 64 * 1024
+	HeaderSizeV2    = MagicNumberSize + chunkSizeFieldSize + KDFIDSize + KDFParamsSize + SaltSize + NoncePrefixSize + KeyHashSize
+
+	ErrKey      xerror.String = "invalid key"
+	ErrTampered xerror.String = "data is tampered or truncated"
 )
 
 type Key [KeySize]byte
@@ -44,10 +53,8 @@ func DeriveKey(password string, salt []byte) Key {
 }
 
 func IsEncrypted(data []byte) bool {
-	if len(data) < HeaderSize {
-		return false
-	}
-	return string(data[:MagicNumberSize]) == MagicNumberV1
+	size := headerSize(data)
+	return size > 0 && len(data) >= size
 }
 
 func IsEncryptedFile(filename string) bool {
@@ -57,19 +64,17 @@ func IsEncryptedFile(filename string) bool {
 	}
 	defer f.Close()
 
-	var header [HeaderSize]byte
-	_, err = io.ReadFull(f, header[:])
-	if err != nil {
-		return false
-	}
-	return string(header[:MagicNumberSize]) == MagicNumberV1
+	var header [HeaderSizeV2]byte
+	n, _ := io.ReadFull(f, header[:])
+	return IsEncrypted(header[:n])
 }
 
 func ValidatePassword(data []byte, password string) bool {
-	if len(data) < HeaderSize {
+	if !IsEncrypted(data) {
 		return false
 	}
-	return getCipherStream(password).ValidatePassword(data)
+	_, _, err := parseHeader(data[:headerSize(data)], password)
+	return err == nil
 }
 
 func ValidateFilePassword(filename, password string) bool {
@@ -78,22 +83,20 @@ func ValidateFilePassword(filename, password string) bool {
 		return false
 	}
 	defer f.Close()
-
-	var header [HeaderSize]byte
-	_, err = io.ReadFull(f, header[:])
-	if err != nil {
-		return false
-	}
-	return getCipherStream(password).ValidatePassword(header[:])
+	_, _, err = readHeader(f, password)
+	return err == nil
 }
 
-func Encrypt(raw []byte, password string) ([]byte, error) {
+func Encrypt(raw []byte, password string, optFns ...func(options *Options)) ([]byte, error) {
 	buf := bytes.NewBuffer(nil)
-	w := NewEncryptedWriter(buf, password)
-	_, err := io.Copy(w, bytes.NewReader(raw))
+	w := NewEncryptedWriter(buf, password, optFns...)
+	_, err := w.Write(raw)
 	if err != nil {
 		return nil, err
 	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
@@ -110,40 +113,94 @@ func Decrypt(data []byte, password string) ([]byte, error) {
 // DecryptInPlace will write decrypted data into parameter data
 // input data parameter will be modified after decrypting
 func DecryptInPlace(data []byte, password string) ([]byte, error) {
-	if len(data) < HeaderSize {
+	if !IsEncrypted(data) {
 		return nil, ErrKey
 	}
-	stream := getCipherStream(password)
-	if !stream.ValidatePassword(data[:HeaderSize]) {
-		return nil, ErrKey
+	size := headerSize(data)
+	stream, c, err := parseHeader(data[:size], password)
+	if err != nil {
+		return nil, err
+	}
+
+	if stream != nil {
+		stream.XORKeyStream(data[size:], data[size:])
+		return data[size:], nil
+	}
+
+	// Open every chunk in its own place, then move plaintext forward to make it contiguous
+	plain := data[:0]
+	encrypted := data[size:]
+	for i := int64(0); ; i++ {
+		n := c.EncryptedChunkSize()
+		last := len(encrypted) <= n
+		if last {
+			n = len(encrypted)
+		}
+		chunk, err := c.Open(encrypted[:0], encrypted[:n], i, last)
+		if err != nil {
+			return nil, err
+		}
+		plain = append(plain, chunk...)
+		if last {
+			return plain, nil
+		}
+		encrypted = encrypted[n:]
 	}
-	stream.XORKeyStream(data[HeaderSize:], data[HeaderSize:])
-	return data[HeaderSize:], nil
 }
 
-func ReEncrypt(data []byte, oldPassword, newPassword string) ([]byte, error) {
+// ReEncrypt decrypts data with oldPassword and encrypts it with newPassword in the latest format
+// It can upgrade data to current KDF parameters if oldPassword and newPassword are the same
+func ReEncrypt(data []byte, oldPassword, newPassword string, optFns ...func(options *Options)) ([]byte, error) {
 	raw, err := Decrypt(data, oldPassword)
 	if err != nil {
 		return nil, err
 	}
-	return Encrypt(raw, newPassword)
+	return Encrypt(raw, newPassword, optFns...)
+}
+
+// IsOutdated reports whether encrypted data is in V1 format or derives key with KDF other than the one in options
+// Outdated data can be upgraded by ReEncrypt
+func IsOutdated(data []byte, optFns ...func(options *Options)) bool {
+	if len(data) < HeaderSizeV2 || string(data[:MagicNumberSize]) != MagicNumberV2 {
+		return true
+	}
+	h := new(headerV2)
+	if err := h.UnmarshalBinary(data); err != nil {
+		return true
+	}
+	return !sameKDF(h.kdf, getOptions(optFns).KDF)
+}
+
+func IsFileOutdated(filename string, optFns ...func(options *Options)) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	var header [HeaderSizeV2]byte
+	n, _ := io.ReadFull(f, header[:])
+	return IsOutdated(header[:n], optFns...)
 }
 
-func EncryptFile(src SourceFile, dst DestFile, password string) error {
+func EncryptFile(src SourceFile, dst DestFile, password string, optFns ...func(options *Options)) error {
 	sf, err := os.Open(string(src))
 	if err != nil {
 		return fmt.Errorf("os.Open: %s, %w", src, err)
 	}
 	defer sf.Close()
 
-	df, err := os.OpenFile(string(dst), os.O_CREATE|os.O_WRONLY, 0644)
+	df, err := os.OpenFile(string(dst), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("os.OpenFile: %s, %w", dst, err)
 	}
 	defer df.Close()
-	w := NewEncryptedWriter(df, password)
+	w := NewEncryptedWriter(df, password, optFns...)
 	_, err = io.Copy(w, sf)
-	return err
+	if err != nil {
+		return err
+	}
+	return w.Close()
 }
 
 func DecryptFile(src SourceFile, dst DestFile, password string) error {
@@ -153,7 +210,7 @@ func DecryptFile(src SourceFile, dst DestFile, password string) error {
 	}
 	defer sf.Close()
 	r := NewDecryptedReader(sf, password)
-	df, err := os.OpenFile(string(dst), os.O_CREATE|os.O_WRONLY, 0644)
+	df, err := os.OpenFile(string(dst), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("os.OpenFile: %s, %w", dst, err)
 	}
@@ -177,9 +234,9 @@ func DecryptFileChunks(chunks []SourceFile, dst DestFile, password string) error
 		return nil
 	}
 
-	df, err := os.Open(string(dst))
+	df, err := os.OpenFile(string(dst), os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
-		return fmt.Errorf("os.Open:%s, %w", dst, err)
+		return fmt.Errorf("os.OpenFile:%s, %w", dst, err)
 	}
 	defer df.Close()
 
@@ -199,7 +256,8 @@ func DecryptFileChunks(chunks []SourceFile, dst DestFile, password string) error
 	return nil
 }
 
-func ReEncryptFile(src SourceFile, dst DestFile, srcPassword, dstPassword string) error {
+// ReEncryptFile decrypts src with srcPassword and encrypts it into dst with dstPassword in the latest format
+func ReEncryptFile(src SourceFile, dst DestFile, srcPassword, dstPassword string, optFns ...func(options *Options)) error {
 	if !ValidateFilePassword(string(src), srcPassword) {
 		return ErrKey
 	}
@@ -210,14 +268,17 @@ func ReEncryptFile(src SourceFile, dst DestFile, srcPassword, dstPassword string
 	}
 	defer sf.Close()
 
-	df, err := os.OpenFile(string(dst), os.O_CREATE|os.O_WRONLY, 0644)
+	df, err := os.OpenFile(string(dst), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("cannot open file %s: %w", dst, err)
 	}
 	defer df.Close()
 
 	dr := NewDecryptedReader(sf, srcPassword)
-	ew := NewEncryptedWriter(df, dstPassword)
+	ew := NewEncryptedWriter(df, dstPassword, optFns...)
 	_, err = io.Copy(ew, dr)
-	return err
+	if err != nil {
+		return err
+	}
+	return ew.Close()
 }
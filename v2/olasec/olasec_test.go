@@ -2,6 +2,8 @@ package olasec_test
 
 import (
 	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
@@ -14,9 +16,17 @@ import (
 	"code.olapie.com/sugar/v2/xtest"
 )
 
+// v1Data is encrypted from v1Raw with password "123" in V1 format
+const (
+	v1Raw  = "hello, olasec v1"
+	v1Data = "fef1fd01cf116f0290d49174eba72941b06589da395eac5e77b6edd99d7ac354023d875f"
+)
+
 func TestEncrypt(t *testing.T) {
 	password := xhash.SHA1(time.Now().String())
+	testEncrypt(t, 0, password)
 	testEncrypt(t, 1<<4+9, password)
+	testEncrypt(t, olasec.ChunkSize, password)
 	testEncrypt(t, 1<<24, password)
 }
 
@@ -35,6 +45,57 @@ func testEncrypt(t *testing.T, size int, password string) {
 	xtest.NoError(t, err)
 	xtest.False(t, olasec.IsEncrypted(dec), dec[:olasec.HeaderSize])
 	xtest.Equal(t, raw, dec)
+
+	dec, err = olasec.DecryptInPlace(enc, password)
+	xtest.NoError(t, err)
+	xtest.Equal(t, raw, dec)
+}
+
+func TestDecrypt_V1(t *testing.T) {
+	enc, err := hex.DecodeString(v1Data)
+	xtest.NoError(t, err)
+	xtest.True(t, olasec.IsEncrypted(enc))
+	xtest.True(t, olasec.ValidatePassword(enc, "123"))
+	xtest.False(t, olasec.ValidatePassword(enc, "1234"))
+
+	dec, err := olasec.Decrypt(enc, "123")
+	xtest.NoError(t, err)
+	xtest.Equal(t, v1Raw, string(dec))
+
+	dec, err = olasec.DecryptInPlace(enc, "123")
+	xtest.NoError(t, err)
+	xtest.Equal(t, v1Raw, string(dec))
+}
+
+func TestDecrypt_Tampered(t *testing.T) {
+	raw := xtest.RandomBytes(2*olasec.ChunkSize + 100)
+	enc, err := olasec.Encrypt(raw, "123")
+	xtest.NoError(t, err)
+	xtest.True(t, olasec.ValidatePassword(enc, "123"))
+	xtest.False(t, olasec.ValidatePassword(enc, "1234"))
+
+	_, err = olasec.Decrypt(enc, "1234")
+	xtest.True(t, errors.Is(err, olasec.ErrKey), err)
+
+	t.Run("Modified", func(t *testing.T) {
+		data := append([]byte(nil), enc...)
+		data[olasec.HeaderSizeV2+olasec.ChunkSize+10] ^= 1
+		_, err := olasec.Decrypt(data, "123")
+		xtest.True(t, errors.Is(err, olasec.ErrTampered), err)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		_, err := olasec.Decrypt(enc[:len(enc)-1], "123")
+		xtest.True(t, errors.Is(err, olasec.ErrTampered), err)
+		_, err = olasec.Decrypt(enc[:olasec.HeaderSizeV2+olasec.ChunkSize+16], "123")
+		xtest.True(t, errors.Is(err, olasec.ErrTampered), err)
+	})
+
+	t.Run("Extended", func(t *testing.T) {
+		data := append(append([]byte(nil), enc...), 0)
+		_, err := olasec.Decrypt(data, "123")
+		xtest.True(t, errors.Is(err, olasec.ErrTampered), err)
+	})
 }
 
 func TestEncryptFile(t *testing.T) {
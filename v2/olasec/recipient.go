@@ -0,0 +1,251 @@
+package olasec
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Recipient header layout: magic number | chunk size | nonce prefix | ephemeral public key | recipient count | recipients,
+// followed by the same chunks as V2.
+// Every recipient entry is: key id | wrapped data key
+// Data key is wrapped by the key derived from ECDH of ephemeral key and recipient's key
+const (
+	MagicNumberRecipient = "\xFE\xF1\xFD\x82"
+
+	PublicKeySize  = 65
+	KeyIDSize      = 8
+	WrappedKeySize = KeySize + gcmTagSize
+	MaxRecipients  = 1024
+
+	recipientFixedHeaderSize = MagicNumberSize + chunkSizeFieldSize + NoncePrefixSize + PublicKeySize + 2
+	recipientEntrySize       = KeyIDSize + WrappedKeySize
+)
+
+// EncryptFor encrypts raw with a random data key which can be unwrapped by any private key of pubKeys
+func EncryptFor(raw []byte, pubKeys ...*ecdsa.PublicKey) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	w := NewEncryptedWriterFor(buf, pubKeys...)
+	_, err := w.Write(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecryptWith decrypts data encrypted by EncryptFor with one recipient's private key
+func DecryptWith(data []byte, priv *ecdsa.PrivateKey) ([]byte, error) {
+	r := NewDecryptedReaderWith(bytes.NewReader(data), priv)
+	w := bytes.NewBuffer(nil)
+	_, err := io.Copy(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+func IsEncryptedFor(data []byte) bool {
+	return len(data) >= recipientFixedHeaderSize && string(data[:MagicNumberSize]) == MagicNumberRecipient
+}
+
+// NewEncryptedWriterFor creates EncryptedWriter which encrypts data for pubKeys
+func NewEncryptedWriterFor(w io.Writer, pubKeys ...*ecdsa.PublicKey) *EncryptedWriter {
+	c, err := newRecipientCipher(pubKeys)
+	return newEncryptedWriter(w, c, err)
+}
+
+// NewDecryptedReaderWith creates DecryptedReader which decrypts data encrypted for priv's public key
+func NewDecryptedReaderWith(r io.Reader, priv *ecdsa.PrivateKey) *DecryptedReader {
+	return &DecryptedReader{
+		r: r,
+		open: func(r io.Reader) (*cipherStream, *chunkCipher, error) {
+			c, err := readRecipientHeader(r, priv)
+			return nil, c, err
+		},
+	}
+}
+
+func EncryptFileFor(src SourceFile, dst DestFile, pubKeys ...*ecdsa.PublicKey) error {
+	sf, err := os.Open(string(src))
+	if err != nil {
+		return fmt.Errorf("os.Open: %s, %w", src, err)
+	}
+	defer sf.Close()
+
+	df, err := os.OpenFile(string(dst), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile: %s, %w", dst, err)
+	}
+	defer df.Close()
+	w := NewEncryptedWriterFor(df, pubKeys...)
+	_, err = io.Copy(w, sf)
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func DecryptFileWith(src SourceFile, dst DestFile, priv *ecdsa.PrivateKey) error {
+	sf, err := os.Open(string(src))
+	if err != nil {
+		return fmt.Errorf("os.Open: %s, %w", src, err)
+	}
+	defer sf.Close()
+	r := NewDecryptedReaderWith(sf, priv)
+	df, err := os.OpenFile(string(dst), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile: %s, %w", dst, err)
+	}
+	defer df.Close()
+	_, err = io.Copy(df, r)
+	return err
+}
+
+// GetKeyID returns id of public key which is used to find its entry in recipient header
+func GetKeyID(pub *ecdsa.PublicKey) [KeyIDSize]byte {
+	sum := sha256.Sum256(elliptic.Marshal(pub.Curve, pub.X, pub.Y))
+	var id [KeyIDSize]byte
+	copy(id[:], sum[:])
+	return id
+}
+
+func newRecipientCipher(pubKeys []*ecdsa.PublicKey) (*chunkCipher, error) {
+	if len(pubKeys) == 0 {
+		return nil, errors.New("no recipients")
+	}
+
+	if len(pubKeys) > MaxRecipients {
+		return nil, fmt.Errorf("recipients exceed %d", MaxRecipients)
+	}
+
+	for _, pub := range pubKeys {
+		if pub == nil || pub.Curve != elliptic.P256() {
+			return nil, errors.New("recipient key is not P-256 public key")
+		}
+	}
+
+	var dataKey Key
+	var noncePrefix [NoncePrefixSize]byte
+	if _, err := io.ReadFull(rand.Reader, dataKey[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, noncePrefix[:]); err != nil {
+		return nil, err
+	}
+
+	ephemeral, err := GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	ephemeralPub := elliptic.Marshal(ephemeral.Curve, ephemeral.X, ephemeral.Y)
+
+	header := make([]byte, 0, recipientFixedHeaderSize+len(pubKeys)*recipientEntrySize)
+	header = append(header, MagicNumberRecipient...)
+	header = binary.BigEndian.AppendUint32(header, ChunkSize)
+	header = append(header, noncePrefix[:]...)
+	header = append(header, ephemeralPub...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(pubKeys)))
+	for _, pub := range pubKeys {
+		wrapper, err := getKeyWrapper(ecdh(ephemeral, pub), ephemeralPub, pub)
+		if err != nil {
+			return nil, err
+		}
+		id := GetKeyID(pub)
+		header = append(header, id[:]...)
+		header = wrapper.Seal(header, make([]byte, wrapper.NonceSize()), dataKey[:], nil)
+	}
+	return newChunkCipher(dataKey, ChunkSize, noncePrefix, header), nil
+}
+
+func readRecipientHeader(r io.Reader, priv *ecdsa.PrivateKey) (*chunkCipher, error) {
+	if priv == nil || priv.Curve != elliptic.P256() {
+		return nil, ErrKey
+	}
+
+	header := make([]byte, recipientFixedHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, headerReadError(err)
+	}
+
+	if string(header[:MagicNumberSize]) != MagicNumberRecipient {
+		return nil, ErrKey
+	}
+
+	fields := header[MagicNumberSize:]
+	chunkSize := binary.BigEndian.Uint32(fields)
+	if chunkSize == 0 || chunkSize > maxChunkSize {
+		return nil, ErrTampered
+	}
+	fields = fields[chunkSizeFieldSize:]
+	var noncePrefix [NoncePrefixSize]byte
+	fields = fields[copy(noncePrefix[:], fields):]
+	ephemeralPub := fields[:PublicKeySize]
+	count := int(binary.BigEndian.Uint16(fields[PublicKeySize:]))
+	if count == 0 || count > MaxRecipients {
+		return nil, ErrTampered
+	}
+
+	x, y := elliptic.Unmarshal(elliptic.P256(), ephemeralPub)
+	if x == nil {
+		return nil, ErrTampered
+	}
+	ephemeral := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+
+	entries := make([]byte, count*recipientEntrySize)
+	if _, err := io.ReadFull(r, entries); err != nil {
+		return nil, headerReadError(err)
+	}
+	header = append(header, entries...)
+
+	id := GetKeyID(&priv.PublicKey)
+	for ; len(entries) > 0; entries = entries[recipientEntrySize:] {
+		if !bytes.Equal(entries[:KeyIDSize], id[:]) {
+			continue
+		}
+
+		unwrapper, err := getKeyWrapper(ecdh(priv, ephemeral), ephemeralPub, &priv.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		var dataKey Key
+		_, err = unwrapper.Open(dataKey[:0], make([]byte, unwrapper.NonceSize()), entries[KeyIDSize:recipientEntrySize], nil)
+		if err != nil {
+			return nil, ErrKey
+		}
+		return newChunkCipher(dataKey, int(chunkSize), noncePrefix, header), nil
+	}
+	return nil, ErrKey
+}
+
+func ecdh(priv *ecdsa.PrivateKey, pub *ecdsa.PublicKey) []byte {
+	x, _ := priv.Curve.ScalarMult(pub.X, pub.Y, priv.D.Bytes())
+	return x.FillBytes(make([]byte, KeySize))
+}
+
+// getKeyWrapper returns AEAD which wraps data key with the key derived from ECDH shared secret
+func getKeyWrapper(secret, ephemeralPub []byte, recipient *ecdsa.PublicKey) (cipher.AEAD, error) {
+	salt := append(append([]byte(nil), ephemeralPub...), elliptic.Marshal(recipient.Curve, recipient.X, recipient.Y)...)
+	var kek Key
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(MagicNumberRecipient)), kek[:]); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(kek[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,68 @@
+package olasec_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"io"
+	"testing"
+
+	"code.olapie.com/sugar/v2/olasec"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+func TestEncryptFor(t *testing.T) {
+	k1 := olasec.MustGeneratePrivateKey()
+	k2 := olasec.MustGeneratePrivateKey()
+	k3 := olasec.MustGeneratePrivateKey()
+	for _, size := range []int{0, 100, 2*olasec.ChunkSize + 1} {
+		raw := xtest.RandomBytes(size)
+		enc, err := olasec.EncryptFor(raw, &k1.PublicKey, &k2.PublicKey)
+		xtest.NoError(t, err)
+		xtest.True(t, olasec.IsEncryptedFor(enc))
+		xtest.False(t, olasec.IsEncrypted(enc))
+
+		for _, k := range []*ecdsa.PrivateKey{k1, k2} {
+			dec, err := olasec.DecryptWith(enc, k)
+			xtest.NoError(t, err)
+			xtest.Equal(t, raw, dec)
+		}
+
+		_, err = olasec.DecryptWith(enc, k3)
+		xtest.True(t, errors.Is(err, olasec.ErrKey), err)
+	}
+}
+
+func TestEncryptFor_Stream(t *testing.T) {
+	k := olasec.MustGeneratePrivateKey()
+	raw := xtest.RandomBytes(3*olasec.ChunkSize + 7)
+	enc := &bytes.Buffer{}
+	w := olasec.NewEncryptedWriterFor(enc, &k.PublicKey)
+	_, err := io.Copy(w, bytes.NewReader(raw))
+	xtest.NoError(t, err)
+	xtest.NoError(t, w.Close())
+
+	dec := &bytes.Buffer{}
+	_, err = io.Copy(dec, olasec.NewDecryptedReaderWith(bytes.NewReader(enc.Bytes()), k))
+	xtest.NoError(t, err)
+	xtest.Equal(t, raw, dec.Bytes())
+}
+
+func TestEncryptFor_Tampered(t *testing.T) {
+	k1 := olasec.MustGeneratePrivateKey()
+	k2 := olasec.MustGeneratePrivateKey()
+	enc, err := olasec.EncryptFor(xtest.RandomBytes(100), &k1.PublicKey)
+	xtest.NoError(t, err)
+
+	// Replacing recipient's key id makes it unrecoverable
+	data := append([]byte(nil), enc...)
+	id := olasec.GetKeyID(&k2.PublicKey)
+	copy(data[len(data)-116-olasec.WrappedKeySize-olasec.KeyIDSize:], id[:])
+	_, err = olasec.DecryptWith(data, k2)
+	xtest.True(t, errors.Is(err, olasec.ErrKey), err)
+
+	data = append([]byte(nil), enc...)
+	data[len(data)-1] ^= 1
+	_, err = olasec.DecryptWith(data, k1)
+	xtest.True(t, errors.Is(err, olasec.ErrTampered), err)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Dialect is the database which generated code targets
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	// SQLite is supported by github.com/mattn/go-sqlite3 and modernc.org/sqlite.
+	// Arrays, JSON and xpsql columns are encoded as JSON text
+	SQLite Dialect = "sqlite"
+)
+
+func ParseDialect(s string) (Dialect, error) {
+	switch d := Dialect(s); d {
+	case Postgres, SQLite:
+		return d, nil
+	case "":
+		return Postgres, nil
+	default:
+		return "", fmt.Errorf("unsupported dialect %s", s)
+	}
+}
+
+// ParamPrefix is the prefix of numbered placeholders.
+// SQLite supports ?NNN, so that arguments can be referred multiple times like $NNN of postgres
+func (d Dialect) ParamPrefix() string {
+	if d == SQLite {
+		return "?"
+	}
+	return "$"
+}
+
+func (d Dialect) Placeholder(i int) string {
+	return fmt.Sprintf("%s%d", d.ParamPrefix(), i)
+}
+
+// Now returns expression of current time
+func (d Dialect) Now() string {
+	if d == SQLite {
+		return "CURRENT_TIMESTAMP"
+	}
+	return "now()"
+}
+
+// TimeArg converts time.Time expression arg into argument which is comparable with Now.
+// SQLite compares time as text, so it's formatted in UTC as CURRENT_TIMESTAMP
+func (d Dialect) TimeArg(arg string) string {
+	if d == SQLite {
+		return arg + `.UTC().Format("2006-01-02 15:04:05")`
+	}
+	return arg
+}
+
+// knownPackages are import paths of packages which may be referred by generated code
+var knownPackages = map[string]string{
+	"context":  "context",
+	"sql":      "database/sql",
+	"fmt":      "fmt",
+	"strings":  "strings",
+	"time":     "time",
+	"json":     "encoding/json",
+	"xtype":    "code.olapie.com/sugar/v2/xtype",
+	"xcontact": "code.olapie.com/sugar/v2/xcontact",
+	"xsql":     "code.olapie.com/sugar/v2/xsql",
+	"xpsql":    "code.olapie.com/sugar/v2/xpsql",
+	"pq":       "github.com/lib/pq",
+}
+
+var packageRefRegexp = regexp.MustCompile(`\b([a-zA-Z_]\w*)\.`)
+
+// getImports returns import paths of packages referred by code snippets,
+// which are grouped into standard and other packages
+func getImports(snippets ...string) [][]string {
+	added := map[string]bool{}
+	var std, others []string
+	for _, s := range snippets {
+		for _, m := range packageRefRegexp.FindAllStringSubmatch(s, -1) {
+			path, ok := knownPackages[m[1]]
+			if !ok || added[path] {
+				continue
+			}
+			added[path] = true
+			if strings.Contains(path, ".") {
+				others = append(others, path)
+			} else {
+				std = append(std, path)
+			}
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(others)
+	return [][]string{std, others}
+}
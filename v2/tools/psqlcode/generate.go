@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"go/format"
 	"os"
+	"strings"
 
 	"code.olapie.com/log"
 	"code.olapie.com/sugar/v2/xname"
@@ -13,7 +14,10 @@ const generateTestCode = `
 package generate
 
 import (
-    "code.olapie.com/sugar/v2/xpsql"
+	"database/sql"
+	"testing"
+
+	"code.olapie.com/sugar/v2/xpsql"
 )
 
 func setupTestDB(t *testing.T) *sql.DB {
@@ -26,15 +30,72 @@ func setupTestDB(t *testing.T) *sql.DB {
 }
 `
 
-func Generate(filename string) {
+// generateSQLiteTestCode opens an in-memory database with generated schema for every test
+const generateSQLiteTestCode = `
+package generate
+
+import (
+	"database/sql"
+	_ "embed"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//go:embed schema.sql
+var schema string
+
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection opens a distinct in-memory database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	if _, err = db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+`
+
+func Generate(filename string, dialect Dialect) {
 	os.Mkdir("generate", 0755)
 	var model struct {
 		Entities []Entity
+		Imports  [][]string
 	}
+	snippets := []string{"context.", "sql."}
+	var tables []*TableSchema
 	for _, e := range ParseYAML(filename) {
+		e.Dialect = dialect
 		generateSQLForEntity(e)
-		model.Entities = append(model.Entities, getEntity(e))
+		entity := getEntity(e)
+		model.Entities = append(model.Entities, entity)
+		for _, f := range entity.Fields {
+			snippets = append(snippets, f.Type)
+		}
+		t, err := e.GetTableSchema()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		tables = append(tables, t)
 	}
+	model.Imports = getImports(snippets...)
+
+	testCode := generateTestCode
+	if dialect == SQLite {
+		testCode = generateSQLiteTestCode
+		if err := GenerateSQLiteSchema("generate", tables); err != nil {
+			log.Fatalln(err)
+		}
+	} else if err := GenerateSchema("generate", tables); err != nil {
+		log.Fatalln(err)
+	}
+	log.Infof("Generate schema")
 
 	var b bytes.Buffer
 	err := globalTemplate.ExecuteTemplate(&b, "model", model)
@@ -52,7 +113,7 @@ func Generate(filename string) {
 		log.Fatalln(err)
 	}
 
-	err = os.WriteFile("generate/generate_test.go", []byte(generateTestCode), 0644)
+	err = os.WriteFile("generate/generate_test.go", []byte(testCode), 0644)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -89,11 +150,27 @@ func generateSQLForEntity(r *RepoModel) {
 		BatchKeyConditions string
 		BatchKeyArgs       string
 		NumKeys            int
+		KeyArgConditions   string
+		EntityKeyArgs      string
+		SoftDelete         bool
+		Dialect            Dialect
+		ParamPrefix        string
+		Now                string
+		PurgeDeletedArg    string
+		Imports            [][]string
+		NotDeleted         string
+		Filters            []*QueryField
+		CursorFields       []*QueryField
+		SortColumns        string
+		OrderBy            string
+		CursorOp           string
+		CursorArgs         string
+		CursorPlaceholders string
 	}
 
 	m := &Model{
 		Name:               xname.ToClassName(r.Name) + "Repo",
-		Table:              r.Table,
+		Table:              r.TableName(),
 		Columns:            r.GetColumns(),
 		KeyParams:          r.KeyParams(),
 		KeyConditions:      r.KeyConditions(),
@@ -107,13 +184,70 @@ func generateSQLForEntity(r *RepoModel) {
 		BatchKeyConditions: r.BatchKeyConditions(),
 		BatchKeyArgs:       r.BatchKeyArgs(),
 		NumKeys:            len(r.PrimaryKey),
+		KeyArgConditions:   r.KeyArgConditions(),
+		EntityKeyArgs:      r.EntityKeyArgs(),
+		SoftDelete:         r.SoftDelete,
+		Dialect:            r.Dialect,
+		ParamPrefix:        r.Dialect.ParamPrefix(),
+		Now:                r.Dialect.Now(),
+		PurgeDeletedArg:    r.Dialect.TimeArg("t"),
+		NotDeleted:         r.NotDeleted(),
+	}
+
+	var err error
+	m.Filters, err = r.GetFilterFields()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	m.CursorFields, err = r.GetCursorFields()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if len(m.CursorFields) > 0 {
+		order, op := "ASC", ">"
+		if r.Pagination.Desc {
+			order, op = "DESC", "<"
+		}
+		columns := make([]string, len(m.CursorFields))
+		orders := make([]string, len(m.CursorFields))
+		args := make([]string, len(m.CursorFields))
+		placeholders := make([]string, len(m.CursorFields))
+		for i, f := range m.CursorFields {
+			columns[i] = f.Column
+			orders[i] = f.Column + " " + order
+			args[i] = "after." + f.Field
+			placeholders[i] = r.Dialect.Placeholder(i + 1)
+		}
+		m.SortColumns = strings.Join(columns, ", ")
+		m.OrderBy = strings.Join(orders, ", ")
+		m.CursorOp = op
+		m.CursorArgs = strings.Join(args, ", ")
+		m.CursorPlaceholders = strings.Join(placeholders, ", ")
+	}
+
+	snippets := []string{"context.", "sql.", "strings.", m.KeyParams, m.Args, m.ScanHolders}
+	if m.NumKeys == 1 {
+		snippets = append(snippets, m.BatchKeyParams, m.BatchKeyArgs)
+	}
+	if len(m.Filters) > 0 || len(m.CursorFields) > 0 {
+		snippets = append(snippets, "fmt.")
+	}
+	for _, f := range append(append([]*QueryField{}, m.Filters...), m.CursorFields...) {
+		snippets = append(snippets, f.Type)
+	}
+	if m.SoftDelete {
+		// PurgeDeleted
+		snippets = append(snippets, "time.")
 	}
+	m.Imports = getImports(snippets...)
 
 	tplName := "repo"
 	testTplName := "repotest"
 	m.Entity = getEntity(r)
 	var b bytes.Buffer
-	err := globalTemplate.ExecuteTemplate(&b, tplName, m)
+	err = globalTemplate.ExecuteTemplate(&b, tplName, m)
 	if err != nil {
 		log.Fatalln(err)
 	}
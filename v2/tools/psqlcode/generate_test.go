@@ -5,5 +5,9 @@ import (
 )
 
 func TestGenerate(t *testing.T) {
-	Generate("testdata/model.yml")
+	Generate("testdata/model.yml", Postgres)
+}
+
+func TestGenerate_SQLite(t *testing.T) {
+	Generate("testdata/model.yml", SQLite)
 }
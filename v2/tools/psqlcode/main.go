@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 )
@@ -32,9 +33,16 @@ import (
 */
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Printf("Usage: %s {modelFilename}", os.Args[0])
+	dialectName := flag.String("dialect", string(Postgres), "postgres or sqlite")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Printf("Usage: %s [--dialect sqlite] {modelFilename}", os.Args[0])
 		return
 	}
-	Generate(os.Args[1])
+	dialect, err := ParseDialect(*dialectName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	Generate(flag.Arg(0), dialect)
 }
@@ -24,6 +24,60 @@ type RepoModel struct {
 	PrimaryKey  []string      `yaml:"primaryKey"`
 	Columns     yaml.MapSlice `yaml:"columns"`
 	JsonColumns []string      `yaml:"jsonColumns"`
+	// XpsqlColumns are read and written by xpsql.Scan and xpsql.Value, see xpsqlTypes for supported go types
+	XpsqlColumns []string `yaml:"xpsqlColumns"`
+
+	// SQLTypes overrides postgres types mapped from go types
+	SQLTypes map[string]string `yaml:"sqlTypes"`
+	// NullableColumns are NOT NULL by default unless their go types are pointers
+	NullableColumns []string           `yaml:"nullableColumns"`
+	Defaults        map[string]string  `yaml:"defaults"`
+	Indexes         []*IndexModel      `yaml:"indexes"`
+	Uniques         []*UniqueModel     `yaml:"uniques"`
+	ForeignKeys     []*ForeignKeyModel `yaml:"foreignKeys"`
+	Comment         string             `yaml:"comment"`
+	ColumnComments  map[string]string  `yaml:"columnComments"`
+
+	// Filters are columns which can be matched by filter struct in Count and ListPage
+	Filters    []string         `yaml:"filters"`
+	Pagination *PaginationModel `yaml:"pagination"`
+	// SoftDelete marks deleted records with deleted_at column, which is added if it's not declared
+	SoftDelete bool `yaml:"softDelete"`
+
+	// Dialect is set by Generate rather than YAML, so that one model serves multiple databases
+	Dialect Dialect `yaml:"-"`
+}
+
+// PaginationModel generates keyset pagination ordered by SortColumns and then primary key
+type PaginationModel struct {
+	SortColumns []string `yaml:"sortColumns"`
+	Desc        bool     `yaml:"desc"`
+}
+
+// QueryField is a column used in filter or cursor struct
+type QueryField struct {
+	Column string
+	Field  string
+	// Type is the column type without pointer
+	Type    string
+	Pointer bool
+}
+
+const deletedAtColumn = "deleted_at"
+
+// Normalize adds implicit columns
+func (r *RepoModel) Normalize() {
+	if r.SoftDelete && r.GetColType(deletedAtColumn) == "" {
+		r.Columns = append(r.Columns, yaml.MapItem{Key: deletedAtColumn, Value: "*time.Time"})
+	}
+}
+
+// TableName returns table name in r.Dialect. SQLite doesn't support schemas, so they are removed
+func (r *RepoModel) TableName() string {
+	if r.Dialect == SQLite {
+		return getTableBaseName(r.Table)
+	}
+	return r.Table
 }
 
 func (r *RepoModel) IsKey(col string) bool {
@@ -44,21 +98,48 @@ func (r *RepoModel) IsJSON(col string) bool {
 	return false
 }
 
+func (r *RepoModel) IsXpsql(col string) bool {
+	for _, v := range r.XpsqlColumns {
+		if v == col {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *RepoModel) IsArray(col string) bool {
 	return strings.Index(col, "[]") == 0 && col != "[]byte"
 }
 
+// IsJSONText returns true if col is encoded as JSON text in r.Dialect
+func (r *RepoModel) IsJSONText(col string) bool {
+	return r.Dialect == SQLite && (r.IsJSON(col) || r.IsXpsql(col) || r.IsArray(r.GetColType(col)))
+}
+
+// wrapArg wraps field value or address with function which converts it from or to column value
+func (r *RepoModel) wrapArg(col, arg, xpsqlFunc string) string {
+	switch {
+	case r.IsJSONText(col):
+		return "xsql.JSONText(" + arg + ")"
+	case r.IsJSON(col):
+		return "xsql.JSON(" + arg + ")"
+	case r.IsXpsql(col):
+		if t, ok := xpsqlTypes[r.GetColType(col)]; ok && t.Valuer != "" && xpsqlFunc == "xpsql.Value" {
+			xpsqlFunc = t.Valuer
+		}
+		return xpsqlFunc + "(" + arg + ")"
+	case r.IsArray(r.GetColType(col)):
+		return "pq.Array(" + arg + ")"
+	default:
+		return arg
+	}
+}
+
 func (r *RepoModel) Args() string {
 	args := make([]string, len(r.Columns))
 	for i, c := range r.Columns {
 		name := c.Key.(string)
-		value := c.Value.(string)
-		args[i] = "v." + xname.ToClassName(name)
-		if r.IsJSON(name) {
-			args[i] = "xsql.JSON(" + args[i] + ")"
-		} else if r.IsArray(value) {
-			args[i] = "pq.Array(" + args[i] + ")"
-		}
+		args[i] = r.wrapArg(name, "v."+xname.ToClassName(name), "xpsql.Value")
 	}
 	return strings.Join(args, ", ")
 }
@@ -66,7 +147,7 @@ func (r *RepoModel) Args() string {
 func (r *RepoModel) Placeholders() string {
 	placeholders := make([]string, len(r.Columns))
 	for i := range r.Columns {
-		placeholders[i] = "$" + fmt.Sprint(i+1)
+		placeholders[i] = r.Dialect.Placeholder(i + 1)
 	}
 	return strings.Join(placeholders, ", ")
 }
@@ -76,7 +157,7 @@ func (r *RepoModel) UpdateColumns() string {
 	for i, c := range r.Columns {
 		name := c.Key.(string)
 		if !r.IsKey(name) {
-			updates = append(updates, fmt.Sprintf("%s=$%d", name, i+1))
+			updates = append(updates, name+"="+r.Dialect.Placeholder(i+1))
 		}
 	}
 
@@ -88,13 +169,92 @@ func (r *RepoModel) KeyConditions() string {
 	for i, c := range r.Columns {
 		name := c.Key.(string)
 		if r.IsKey(name) {
-			keys = append(keys, fmt.Sprintf("%s=$%d", name, i+1))
+			keys = append(keys, name+"="+r.Dialect.Placeholder(i+1))
 		}
 	}
 
 	return strings.Join(keys, " AND ")
 }
 
+// KeyArgConditions matches primary key with arguments in the order of primary key
+func (r *RepoModel) KeyArgConditions() string {
+	keys := make([]string, len(r.PrimaryKey))
+	for i, k := range r.PrimaryKey {
+		keys[i] = k + "=" + r.Dialect.Placeholder(i+1)
+	}
+	return strings.Join(keys, " AND ")
+}
+
+// NotDeleted returns condition which excludes soft deleted records
+func (r *RepoModel) NotDeleted() string {
+	if !r.SoftDelete {
+		return ""
+	}
+	return deletedAtColumn + " IS NULL"
+}
+
+// EntityKeyArgs returns primary key fields of entity v
+func (r *RepoModel) EntityKeyArgs() string {
+	args := make([]string, len(r.PrimaryKey))
+	for i, k := range r.PrimaryKey {
+		args[i] = "v." + xname.ToClassName(k)
+	}
+	return strings.Join(args, ", ")
+}
+
+func (r *RepoModel) getQueryField(col string) (*QueryField, error) {
+	typ := r.GetColType(col)
+	if typ == "" {
+		return nil, fmt.Errorf("unknown column %s of %s", col, r.Name)
+	}
+	if r.IsJSON(col) || r.IsXpsql(col) || r.IsArray(typ) || typ == "[]byte" {
+		return nil, fmt.Errorf("column %s of %s is not comparable", col, r.Name)
+	}
+	return &QueryField{
+		Column:  col,
+		Field:   xname.ToClassName(col),
+		Type:    strings.TrimPrefix(typ, "*"),
+		Pointer: strings.HasPrefix(typ, "*"),
+	}, nil
+}
+
+func (r *RepoModel) GetFilterFields() ([]*QueryField, error) {
+	fields := make([]*QueryField, len(r.Filters))
+	for i, col := range r.Filters {
+		f, err := r.getQueryField(col)
+		if err != nil {
+			return nil, fmt.Errorf("filter: %w", err)
+		}
+		fields[i] = f
+	}
+	return fields, nil
+}
+
+// GetCursorFields returns sort columns followed by primary key, which identify position of a record
+func (r *RepoModel) GetCursorFields() ([]*QueryField, error) {
+	if r.Pagination == nil {
+		return nil, nil
+	}
+
+	var fields []*QueryField
+	added := map[string]bool{}
+	for _, col := range append(append([]string{}, r.Pagination.SortColumns...), r.PrimaryKey...) {
+		if added[col] {
+			continue
+		}
+		added[col] = true
+		if r.IsNullable(col) {
+			return nil, fmt.Errorf("pagination: column %s of %s is nullable", col, r.Name)
+		}
+		f, err := r.getQueryField(col)
+		if err != nil {
+			return nil, fmt.Errorf("pagination: %w", err)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
 func (r *RepoModel) GetColType(col string) string {
 	for _, c := range r.Columns {
 		if c.Key == col {
@@ -124,14 +284,23 @@ func (r *RepoModel) BatchKeyConditions() string {
 	if len(r.PrimaryKey) != 1 {
 		return ""
 	}
-	return fmt.Sprintf("%s=ANY($%d)", r.PrimaryKey[0], len(r.Columns)+1)
+	if r.Dialect == SQLite {
+		// keys are passed as JSON array
+		return fmt.Sprintf("%s IN (SELECT value FROM json_each(?1))", r.PrimaryKey[0])
+	}
+	return fmt.Sprintf("%s=ANY($1)", r.PrimaryKey[0])
 }
 
+// BatchKeyArgs returns the array argument of BatchKeyConditions
 func (r *RepoModel) BatchKeyArgs() string {
 	if len(r.PrimaryKey) != 1 {
 		return ""
 	}
-	return strings.Split(r.BatchKeyParams(), " ")[0]
+	arg := strings.Split(r.BatchKeyParams(), " ")[0]
+	if r.Dialect == SQLite {
+		return "xsql.JSONText(" + arg + ")"
+	}
+	return "pq.Array(" + arg + ")"
 }
 
 func (r *RepoModel) GetKeys() string {
@@ -150,13 +319,7 @@ func (r *RepoModel) ScanHolders() string {
 	scanArgs := make([]string, len(r.Columns))
 	for i, c := range r.Columns {
 		name := c.Key.(string)
-		value := c.Value.(string)
-		scanArgs[i] = "&v." + xname.ToClassName(name)
-		if r.IsJSON(name) {
-			scanArgs[i] = "xsql.JSON(" + scanArgs[i] + ")"
-		} else if r.IsArray(value) {
-			scanArgs[i] = "pq.Array(" + scanArgs[i] + ")"
-		}
+		scanArgs[i] = r.wrapArg(name, "&v."+xname.ToClassName(name), "xpsql.Scan")
 	}
 
 	return strings.Join(scanArgs, ", ")
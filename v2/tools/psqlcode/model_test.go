@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestRepoModel_Normalize(t *testing.T) {
+	r := &RepoModel{
+		Name:       "user",
+		PrimaryKey: []string{"id"},
+		Columns:    yaml.MapSlice{{Key: "id", Value: "int64"}},
+		SoftDelete: true,
+	}
+	r.Normalize()
+	r.Normalize()
+	if len(r.Columns) != 2 || r.GetColType(deletedAtColumn) != "*time.Time" {
+		t.Fatalf("unexpected columns: %v", r.Columns)
+	}
+	if !r.IsNullable(deletedAtColumn) {
+		t.Fatal("want nullable deleted_at")
+	}
+}
+
+func TestRepoModel_GetCursorFields(t *testing.T) {
+	r := &RepoModel{
+		Name:       "user",
+		PrimaryKey: []string{"id"},
+		Columns: yaml.MapSlice{
+			{Key: "id", Value: "int64"},
+			{Key: "created_at", Value: "time.Time"},
+			{Key: "tags", Value: "[]string"},
+			{Key: "email", Value: "*string"},
+		},
+		Pagination: &PaginationModel{SortColumns: []string{"created_at", "id"}},
+	}
+	fields, err := r.GetCursorFields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*QueryField{
+		{Column: "created_at", Field: "CreatedAt", Type: "time.Time"},
+		{Column: "id", Field: "ID", Type: "int64"},
+	}
+	if !reflect.DeepEqual(want, fields) {
+		t.Fatalf("want %v, got %v", want, fields)
+	}
+
+	r.Pagination.SortColumns = []string{"email"}
+	if _, err = r.GetCursorFields(); err == nil {
+		t.Fatal("want error of nullable column")
+	}
+
+	r.Filters = []string{"tags"}
+	if _, err = r.GetFilterFields(); err == nil {
+		t.Fatal("want error of array column")
+	}
+}
+
+func TestRepoModel_Xpsql(t *testing.T) {
+	r := &RepoModel{
+		Name:       "user",
+		PrimaryKey: []string{"id"},
+		Columns: yaml.MapSlice{
+			{Key: "id", Value: "int64"},
+			{Key: "place", Value: "*xtype.Place"},
+			{Key: "attrs", Value: "map[string]string"},
+			{Key: "location", Value: "*xtype.Point"},
+		},
+		XpsqlColumns: []string{"place", "attrs", "location"},
+	}
+	if args := r.Args(); args != "v.ID, xpsql.Value(v.Place), xpsql.Value(v.Attrs), xpsql.NativePoint(v.Location)" {
+		t.Fatal(args)
+	}
+	if holders := r.ScanHolders(); holders != "&v.ID, xpsql.Scan(&v.Place), xpsql.Scan(&v.Attrs), xpsql.Scan(&v.Location)" {
+		t.Fatal(holders)
+	}
+
+	r.Filters = []string{"place"}
+	if _, err := r.GetFilterFields(); err == nil {
+		t.Fatal("want error of xpsql column")
+	}
+}
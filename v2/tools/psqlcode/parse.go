@@ -18,5 +18,8 @@ func ParseYAML(filename string) []*RepoModel {
 	if err != nil {
 		log.Fatalln(err)
 	}
+	for _, r := range repos {
+		r.Normalize()
+	}
 	return repos
 }
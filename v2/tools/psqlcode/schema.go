@@ -0,0 +1,702 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type IndexModel struct {
+	// Name is {table}_{columns}_idx by default
+	Name    string   `yaml:"name"`
+	Columns []string `yaml:"columns"`
+	Unique  bool     `yaml:"unique"`
+}
+
+type UniqueModel struct {
+	// Name is {table}_{columns}_key by default
+	Name    string   `yaml:"name"`
+	Columns []string `yaml:"columns"`
+}
+
+type ForeignKeyModel struct {
+	// Name is {table}_{columns}_fkey by default
+	Name       string   `yaml:"name"`
+	Columns    []string `yaml:"columns"`
+	RefTable   string   `yaml:"refTable"`
+	RefColumns []string `yaml:"refColumns"`
+	OnDelete   string   `yaml:"onDelete"`
+	OnUpdate   string   `yaml:"onUpdate"`
+}
+
+// TableSchema is the postgres schema of RepoModel, which is saved as snapshot to diff with the next version
+type TableSchema struct {
+	Name        string             `yaml:"name"`
+	Columns     []*ColumnSchema    `yaml:"columns"`
+	PrimaryKey  []string           `yaml:"primaryKey"`
+	Indexes     []*IndexModel      `yaml:"indexes,omitempty"`
+	Uniques     []*UniqueModel     `yaml:"uniques,omitempty"`
+	ForeignKeys []*ForeignKeyModel `yaml:"foreignKeys,omitempty"`
+	Comment     string             `yaml:"comment,omitempty"`
+}
+
+type ColumnSchema struct {
+	Name    string `yaml:"name"`
+	Type    string `yaml:"type"`
+	NotNull bool   `yaml:"notNull"`
+	Default string `yaml:"default,omitempty"`
+	Comment string `yaml:"comment,omitempty"`
+}
+
+func (t *TableSchema) GetColumn(name string) *ColumnSchema {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+var goToSQLTypes = map[string]string{
+	"int":           "BIGINT",
+	"int64":         "BIGINT",
+	"uint":          "BIGINT",
+	"uint64":        "BIGINT",
+	"int32":         "INTEGER",
+	"uint32":        "INTEGER",
+	"int16":         "SMALLINT",
+	"uint16":        "SMALLINT",
+	"int8":          "SMALLINT",
+	"uint8":         "SMALLINT",
+	"float64":       "DOUBLE PRECISION",
+	"float32":       "REAL",
+	"string":        "TEXT",
+	"bool":          "BOOLEAN",
+	"[]byte":        "BYTEA",
+	"time.Time":     "TIMESTAMPTZ",
+	"time.Duration": "BIGINT",
+}
+
+// xpsqlType is postgres type of go type supported by xpsql.Scan and xpsql.Value
+type xpsqlType struct {
+	SQLType string
+	// Fields defines composite type SQLType, which is created before tables
+	Fields string
+	// Extension provides SQLType
+	Extension string
+	// Valuer converts field into column value, which is xpsql.Value by default
+	Valuer string
+}
+
+var xpsqlTypes = map[string]*xpsqlType{
+	"*xtype.FullName": {
+		SQLType: "full_name",
+		Fields:  "first TEXT, middle TEXT, last TEXT",
+	},
+	// money is a builtin type of postgres
+	"*xtype.Money": {
+		SQLType: "money_amount",
+		Fields:  "currency TEXT, amount NUMERIC",
+	},
+	"*xcontact.PhoneNumber": {
+		SQLType: "phone_number",
+		Fields:  "code INTEGER, number BIGINT, extension TEXT",
+	},
+	// points are native POINT, which is read and written by xpsql in text format (x,y)
+	"*xtype.Place": {
+		SQLType: "place",
+		Fields:  "code TEXT, name TEXT, coordinate POINT",
+	},
+	"*xtype.Point": {
+		SQLType: "POINT",
+		Valuer:  "xpsql.NativePoint",
+	},
+	"map[string]string": {
+		SQLType:   "HSTORE",
+		Extension: "hstore",
+	},
+}
+
+// getXpsqlTypeBySQLType returns xpsqlType whose SQLType is t, or nil if t is not from xpsqlTypes
+func getXpsqlTypeBySQLType(t string) *xpsqlType {
+	for _, v := range xpsqlTypes {
+		if v.SQLType == t {
+			return v
+		}
+	}
+	return nil
+}
+
+// GetSQLType returns postgres type of col, which is declared in sqlTypes, or mapped from go type
+func (r *RepoModel) GetSQLType(col string) (string, error) {
+	if t, ok := r.SQLTypes[col]; ok {
+		return t, nil
+	}
+
+	if r.Dialect == SQLite {
+		return r.getSQLiteType(col)
+	}
+
+	if r.IsJSON(col) {
+		return "JSONB", nil
+	}
+
+	if r.IsXpsql(col) {
+		if t, ok := xpsqlTypes[r.GetColType(col)]; ok {
+			return t.SQLType, nil
+		}
+		return "", fmt.Errorf("go type %s of %s.%s is not supported by xpsql", r.GetColType(col), r.Name, col)
+	}
+
+	goType := strings.TrimPrefix(r.GetColType(col), "*")
+	if t, ok := goToSQLTypes[goType]; ok {
+		return t, nil
+	}
+
+	if r.IsArray(goType) {
+		if t, ok := goToSQLTypes[strings.TrimPrefix(goType, "[]")]; ok {
+			return t + "[]", nil
+		}
+	}
+	return "", fmt.Errorf("unknown sql type of %s.%s, declare it in sqlTypes", r.Name, col)
+}
+
+func (r *RepoModel) IsNullable(col string) bool {
+	if r.IsKey(col) {
+		return false
+	}
+
+	for _, v := range r.NullableColumns {
+		if v == col {
+			return true
+		}
+	}
+	return strings.HasPrefix(r.GetColType(col), "*")
+}
+
+func (r *RepoModel) GetTableSchema() (*TableSchema, error) {
+	t := &TableSchema{
+		Name:       r.TableName(),
+		PrimaryKey: r.PrimaryKey,
+		Comment:    r.Comment,
+	}
+
+	for _, c := range r.Columns {
+		name := c.Key.(string)
+		typ, err := r.GetSQLType(name)
+		if err != nil {
+			return nil, err
+		}
+		// JSON text columns are nullable, as nil slices and maps are encoded as NULL
+		t.Columns = append(t.Columns, &ColumnSchema{
+			Name:    name,
+			Type:    typ,
+			NotNull: !r.IsNullable(name) && !r.IsJSONText(name),
+			Default: r.Defaults[name],
+			Comment: r.ColumnComments[name],
+		})
+	}
+
+	base := getTableBaseName(r.Table)
+	for _, idx := range r.Indexes {
+		if err := r.checkColumns(idx.Columns); err != nil {
+			return nil, fmt.Errorf("index %s: %w", idx.Name, err)
+		}
+		i := *idx
+		if i.Name == "" {
+			i.Name = base + "_" + strings.Join(i.Columns, "_") + "_idx"
+		}
+		t.Indexes = append(t.Indexes, &i)
+	}
+
+	for _, u := range r.Uniques {
+		if err := r.checkColumns(u.Columns); err != nil {
+			return nil, fmt.Errorf("unique %s: %w", u.Name, err)
+		}
+		v := *u
+		if v.Name == "" {
+			v.Name = base + "_" + strings.Join(v.Columns, "_") + "_key"
+		}
+		t.Uniques = append(t.Uniques, &v)
+	}
+
+	for _, fk := range r.ForeignKeys {
+		if err := r.checkColumns(fk.Columns); err != nil {
+			return nil, fmt.Errorf("foreign key %s: %w", fk.Name, err)
+		}
+		if fk.RefTable == "" || len(fk.RefColumns) != len(fk.Columns) {
+			return nil, fmt.Errorf("foreign key %v of %s: invalid reference", fk.Columns, r.Name)
+		}
+		f := *fk
+		if f.Name == "" {
+			f.Name = base + "_" + strings.Join(f.Columns, "_") + "_fkey"
+		}
+		if r.Dialect == SQLite {
+			f.RefTable = getTableBaseName(f.RefTable)
+		}
+		t.ForeignKeys = append(t.ForeignKeys, &f)
+	}
+	return t, nil
+}
+
+func (r *RepoModel) checkColumns(columns []string) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("no columns")
+	}
+	for _, c := range columns {
+		if r.GetColType(c) == "" {
+			return fmt.Errorf("unknown column %s of %s", c, r.Name)
+		}
+	}
+	return nil
+}
+
+// getTableBaseName returns table name without schema
+func getTableBaseName(table string) string {
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		return table[i+1:]
+	}
+	return table
+}
+
+// getSchemaPrefix returns schema with dot, or empty string if table isn't qualified
+func getSchemaPrefix(table string) string {
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		return table[:i+1]
+	}
+	return ""
+}
+
+func getColumnDefinition(c *ColumnSchema) string {
+	def := c.Name + " " + c.Type
+	if c.NotNull {
+		def += " NOT NULL"
+	}
+	if c.Default != "" {
+		def += " DEFAULT " + c.Default
+	}
+	return def
+}
+
+// createTable declares uniques in table if withUniques is true, otherwise they are added by ALTER TABLE
+func createTable(t *TableSchema, withUniques bool) []string {
+	var b strings.Builder
+	b.WriteString("CREATE TABLE IF NOT EXISTS " + t.Name + " (\n")
+	for _, c := range t.Columns {
+		b.WriteString("\t" + getColumnDefinition(c) + ",\n")
+	}
+	b.WriteString("\tCONSTRAINT " + getTableBaseName(t.Name) + "_pkey PRIMARY KEY (" + strings.Join(t.PrimaryKey, ", ") + ")")
+	if withUniques {
+		for _, u := range t.Uniques {
+			b.WriteString(",\n\tCONSTRAINT " + u.Name + " UNIQUE (" + strings.Join(u.Columns, ", ") + ")")
+		}
+	}
+	b.WriteString("\n)")
+
+	stmts := []string{b.String()}
+	if t.Comment != "" {
+		stmts = append(stmts, commentOnTable(t))
+	}
+	for _, c := range t.Columns {
+		if c.Comment != "" {
+			stmts = append(stmts, commentOnColumn(t, c))
+		}
+	}
+	return stmts
+}
+
+func commentOnTable(t *TableSchema) string {
+	if t.Comment == "" {
+		return "COMMENT ON TABLE " + t.Name + " IS NULL"
+	}
+	return "COMMENT ON TABLE " + t.Name + " IS " + quoteLiteral(t.Comment)
+}
+
+func commentOnColumn(t *TableSchema, c *ColumnSchema) string {
+	if c.Comment == "" {
+		return "COMMENT ON COLUMN " + t.Name + "." + c.Name + " IS NULL"
+	}
+	return "COMMENT ON COLUMN " + t.Name + "." + c.Name + " IS " + quoteLiteral(c.Comment)
+}
+
+func createIndex(t *TableSchema, idx *IndexModel) string {
+	unique := ""
+	if idx.Unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s ON %s(%s)", unique, idx.Name, t.Name, strings.Join(idx.Columns, ", "))
+}
+
+func dropIndex(t *TableSchema, idx *IndexModel) string {
+	return "DROP INDEX IF EXISTS " + getSchemaPrefix(t.Name) + idx.Name
+}
+
+func addUnique(t *TableSchema, u *UniqueModel) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s UNIQUE (%s)", t.Name, u.Name, strings.Join(u.Columns, ", "))
+}
+
+func addForeignKey(t *TableSchema, fk *ForeignKeyModel) string {
+	stmt := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s(%s)",
+		t.Name, fk.Name, strings.Join(fk.Columns, ", "), fk.RefTable, strings.Join(fk.RefColumns, ", "))
+	if fk.OnDelete != "" {
+		stmt += " ON DELETE " + fk.OnDelete
+	}
+	if fk.OnUpdate != "" {
+		stmt += " ON UPDATE " + fk.OnUpdate
+	}
+	return stmt
+}
+
+// addForeignKeyIfNotExists adds foreign key unless it exists, as postgres doesn't support ADD CONSTRAINT IF NOT EXISTS
+func addForeignKeyIfNotExists(t *TableSchema, fk *ForeignKeyModel) string {
+	return "DO $$ BEGIN " + addForeignKey(t, fk) + "; EXCEPTION WHEN duplicate_object THEN NULL; END $$"
+}
+
+func dropConstraint(t *TableSchema, name string) string {
+	return "ALTER TABLE " + t.Name + " DROP CONSTRAINT IF EXISTS " + name
+}
+
+// getXpsqlTypes returns composite types and extensions used by tables in order of appearance
+func getXpsqlTypes(tables []*TableSchema) (composites []string, extensions []string) {
+	added := map[string]bool{}
+	for _, t := range tables {
+		for _, c := range t.Columns {
+			xt := getXpsqlTypeBySQLType(c.Type)
+			if xt == nil {
+				continue
+			}
+			if xt.Extension != "" && !added[xt.Extension] {
+				added[xt.Extension] = true
+				extensions = append(extensions, xt.Extension)
+			}
+			if xt.Fields != "" && !added[xt.SQLType] {
+				added[xt.SQLType] = true
+				composites = append(composites, xt.SQLType)
+			}
+		}
+	}
+	return composites, extensions
+}
+
+// createType creates composite type unless it exists, as postgres doesn't support CREATE TYPE IF NOT EXISTS
+func createType(name string) string {
+	return fmt.Sprintf("DO $$ BEGIN CREATE TYPE %s AS (%s); EXCEPTION WHEN duplicate_object THEN NULL; END $$",
+		name, getXpsqlTypeBySQLType(name).Fields)
+}
+
+func containsString(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// CreateSchema returns statements which create tables, and can be run again against the created database.
+// Unlike DiffSchema from nil, uniques are declared in tables, and foreign keys are added unless they exist
+func CreateSchema(tables []*TableSchema) []string {
+	var stmts, indexes, fks []string
+	composites, extensions := getXpsqlTypes(tables)
+	for _, e := range extensions {
+		stmts = append(stmts, "CREATE EXTENSION IF NOT EXISTS "+e)
+	}
+	for _, c := range composites {
+		stmts = append(stmts, createType(c))
+	}
+	for _, t := range tables {
+		stmts = append(stmts, createTable(t, true)...)
+		for _, idx := range t.Indexes {
+			indexes = append(indexes, createIndex(t, idx))
+		}
+		// foreign keys are added after all tables are created, as they may refer to tables created later
+		for _, fk := range t.ForeignKeys {
+			fks = append(fks, addForeignKeyIfNotExists(t, fk))
+		}
+	}
+	return append(append(stmts, indexes...), fks...)
+}
+
+// DiffSchema returns statements which migrate tables from one version to another.
+// Statements are ordered so that constraints never refer to missing tables or columns,
+// and columns never refer to missing types
+func DiffSchema(from, to []*TableSchema) []string {
+	fromTables := map[string]*TableSchema{}
+	for _, t := range from {
+		fromTables[t.Name] = t
+	}
+	toTables := map[string]*TableSchema{}
+	for _, t := range to {
+		toTables[t.Name] = t
+	}
+
+	var types, drops, creates, alters, adds, fks, dropTables, dropTypes []string
+	fromComposites, fromExtensions := getXpsqlTypes(from)
+	toComposites, toExtensions := getXpsqlTypes(to)
+	for _, e := range toExtensions {
+		if !containsString(fromExtensions, e) {
+			types = append(types, "CREATE EXTENSION IF NOT EXISTS "+e)
+		}
+	}
+	for _, c := range toComposites {
+		if !containsString(fromComposites, c) {
+			types = append(types, createType(c))
+		}
+	}
+	// extensions may be shared by other schemas, so they are never dropped
+	for i := len(fromComposites) - 1; i >= 0; i-- {
+		if !containsString(toComposites, fromComposites[i]) {
+			dropTypes = append(dropTypes, "DROP TYPE IF EXISTS "+fromComposites[i])
+		}
+	}
+
+	for _, t := range to {
+		old := fromTables[t.Name]
+		if old == nil {
+			creates = append(creates, createTable(t, false)...)
+			for _, idx := range t.Indexes {
+				adds = append(adds, createIndex(t, idx))
+			}
+			for _, u := range t.Uniques {
+				adds = append(adds, addUnique(t, u))
+			}
+			for _, fk := range t.ForeignKeys {
+				fks = append(fks, addForeignKey(t, fk))
+			}
+			continue
+		}
+
+		for _, fk := range old.ForeignKeys {
+			if !containsForeignKey(t.ForeignKeys, fk) {
+				drops = append(drops, dropConstraint(old, fk.Name))
+			}
+		}
+		for _, fk := range t.ForeignKeys {
+			if !containsForeignKey(old.ForeignKeys, fk) {
+				fks = append(fks, addForeignKey(t, fk))
+			}
+		}
+
+		for _, u := range old.Uniques {
+			if !containsUnique(t.Uniques, u) {
+				drops = append(drops, dropConstraint(old, u.Name))
+			}
+		}
+		for _, u := range t.Uniques {
+			if !containsUnique(old.Uniques, u) {
+				adds = append(adds, addUnique(t, u))
+			}
+		}
+
+		for _, idx := range old.Indexes {
+			if !containsIndex(t.Indexes, idx) {
+				drops = append(drops, dropIndex(old, idx))
+			}
+		}
+		for _, idx := range t.Indexes {
+			if !containsIndex(old.Indexes, idx) {
+				adds = append(adds, createIndex(t, idx))
+			}
+		}
+
+		alters = append(alters, alterTable(old, t)...)
+	}
+
+	for i := len(from) - 1; i >= 0; i-- {
+		if toTables[from[i].Name] == nil {
+			dropTables = append(dropTables, "DROP TABLE IF EXISTS "+from[i].Name)
+		}
+	}
+
+	var stmts []string
+	for _, l := range [][]string{types, drops, creates, alters, adds, fks, dropTables, dropTypes} {
+		stmts = append(stmts, l...)
+	}
+	return stmts
+}
+
+func alterTable(old, t *TableSchema) []string {
+	var stmts []string
+	prefix := "ALTER TABLE " + t.Name + " "
+	pkChanged := !reflect.DeepEqual(old.PrimaryKey, t.PrimaryKey)
+	if pkChanged {
+		stmts = append(stmts, dropConstraint(old, getTableBaseName(old.Name)+"_pkey"))
+	}
+
+	for _, c := range t.Columns {
+		oc := old.GetColumn(c.Name)
+		if oc == nil {
+			stmts = append(stmts, prefix+"ADD COLUMN "+getColumnDefinition(c))
+			if c.Comment != "" {
+				stmts = append(stmts, commentOnColumn(t, c))
+			}
+			continue
+		}
+
+		column := prefix + "ALTER COLUMN " + c.Name + " "
+		if oc.Type != c.Type {
+			stmts = append(stmts, column+"TYPE "+c.Type+" USING "+c.Name+"::"+c.Type)
+		}
+		if oc.Default != c.Default {
+			if c.Default == "" {
+				stmts = append(stmts, column+"DROP DEFAULT")
+			} else {
+				stmts = append(stmts, column+"SET DEFAULT "+c.Default)
+			}
+		}
+		if oc.NotNull != c.NotNull {
+			if c.NotNull {
+				stmts = append(stmts, column+"SET NOT NULL")
+			} else {
+				stmts = append(stmts, column+"DROP NOT NULL")
+			}
+		}
+		if oc.Comment != c.Comment {
+			stmts = append(stmts, commentOnColumn(t, c))
+		}
+	}
+
+	for _, oc := range old.Columns {
+		if t.GetColumn(oc.Name) == nil {
+			stmts = append(stmts, prefix+"DROP COLUMN "+oc.Name)
+		}
+	}
+
+	if pkChanged {
+		stmts = append(stmts, prefix+"ADD CONSTRAINT "+getTableBaseName(t.Name)+"_pkey PRIMARY KEY ("+strings.Join(t.PrimaryKey, ", ")+")")
+	}
+
+	if old.Comment != t.Comment {
+		stmts = append(stmts, commentOnTable(t))
+	}
+	return stmts
+}
+
+func containsIndex(l []*IndexModel, idx *IndexModel) bool {
+	for _, v := range l {
+		if reflect.DeepEqual(v, idx) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsUnique(l []*UniqueModel, u *UniqueModel) bool {
+	for _, v := range l {
+		if reflect.DeepEqual(v, u) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsForeignKey(l []*ForeignKeyModel, fk *ForeignKeyModel) bool {
+	for _, v := range l {
+		if reflect.DeepEqual(v, fk) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinStatements(stmts []string) string {
+	if len(stmts) == 0 {
+		return ""
+	}
+	return strings.Join(stmts, ";\n\n") + ";\n"
+}
+
+const (
+	schemaFilename   = "schema.sql"
+	snapshotFilename = "schema.snapshot.yml"
+	migrationDir     = "migrations"
+)
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_.+\.sql$`)
+
+// GenerateSchema writes DDL of tables into dir/schema.sql, which can be run repeatedly.
+// If tables are different from the snapshot of previous generation,
+// the migration is written into dir/migrations as {version}_{name}.up.sql and {version}_{name}.down.sql,
+// which can be applied by xsql.Migrator
+func GenerateSchema(dir string, tables []*TableSchema) error {
+	err := os.WriteFile(filepath.Join(dir, schemaFilename), []byte(joinStatements(CreateSchema(tables))), 0644)
+	if err != nil {
+		return fmt.Errorf("write schema: %w", err)
+	}
+
+	snapshotFile := filepath.Join(dir, snapshotFilename)
+	var previous []*TableSchema
+	name := "init"
+	data, err := os.ReadFile(snapshotFile)
+	if err == nil {
+		if err = yaml.Unmarshal(data, &previous); err != nil {
+			return fmt.Errorf("parse snapshot: %w", err)
+		}
+		name = "alter"
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	up := DiffSchema(previous, tables)
+	if len(up) == 0 {
+		return nil
+	}
+	down := DiffSchema(tables, previous)
+
+	version, err := getNextMigrationVersion(filepath.Join(dir, migrationDir))
+	if err != nil {
+		return err
+	}
+
+	prefix := filepath.Join(dir, migrationDir, fmt.Sprintf("%04d_%s", version, name))
+	if err = os.WriteFile(prefix+".up.sql", []byte(joinStatements(up)), 0644); err != nil {
+		return fmt.Errorf("write migration: %w", err)
+	}
+	if err = os.WriteFile(prefix+".down.sql", []byte(joinStatements(down)), 0644); err != nil {
+		return fmt.Errorf("write migration: %w", err)
+	}
+
+	data, err = yaml.Marshal(tables)
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %w", err)
+	}
+	if err = os.WriteFile(snapshotFile, data, 0644); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	return nil
+}
+
+func getNextMigrationVersion(dir string) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, fmt.Errorf("create migration dir: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("read migration dir: %w", err)
+	}
+
+	var versions []int
+	for _, e := range entries {
+		if m := migrationFileRegexp.FindStringSubmatch(e.Name()); m != nil {
+			v, _ := strconv.Atoi(m[1])
+			versions = append(versions, v)
+		}
+	}
+	sort.Ints(versions)
+	if len(versions) == 0 {
+		return 1, nil
+	}
+	return versions[len(versions)-1] + 1, nil
+}
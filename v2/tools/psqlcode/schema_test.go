@@ -0,0 +1,245 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func parseTestTables(t *testing.T, s string) []*TableSchema {
+	var repos []*RepoModel
+	if err := yaml.Unmarshal([]byte(s), &repos); err != nil {
+		t.Fatal(err)
+	}
+
+	var tables []*TableSchema
+	for _, r := range repos {
+		table, err := r.GetTableSchema()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+const testSchemaV1 = `
+- name: user
+  table: test.users
+  primaryKey: [id]
+  columns:
+    id: int64
+    name: string
+    age: int32
+  indexes:
+    - columns: [name]
+`
+
+const testSchemaV2 = `
+- name: user
+  table: test.users
+  primaryKey: [id]
+  columns:
+    id: int64
+    name: string
+    age: int64
+    email: "*string"
+  defaults:
+    name: "''"
+  uniques:
+    - columns: [email]
+  comment: users
+`
+
+func TestDiffSchema(t *testing.T) {
+	v1 := parseTestTables(t, testSchemaV1)
+	v2 := parseTestTables(t, testSchemaV2)
+	up := DiffSchema(v1, v2)
+	want := []string{
+		"DROP INDEX IF EXISTS test.users_name_idx",
+		"ALTER TABLE test.users ALTER COLUMN name SET DEFAULT ''",
+		"ALTER TABLE test.users ALTER COLUMN age TYPE BIGINT USING age::BIGINT",
+		"ALTER TABLE test.users ADD COLUMN email TEXT",
+		"COMMENT ON TABLE test.users IS 'users'",
+		"ALTER TABLE test.users ADD CONSTRAINT users_email_key UNIQUE (email)",
+	}
+	if !reflect.DeepEqual(want, up) {
+		t.Fatalf("want %q, got %q", want, up)
+	}
+
+	down := DiffSchema(v2, v1)
+	want = []string{
+		"ALTER TABLE test.users DROP CONSTRAINT IF EXISTS users_email_key",
+		"ALTER TABLE test.users ALTER COLUMN name DROP DEFAULT",
+		"ALTER TABLE test.users ALTER COLUMN age TYPE INTEGER USING age::INTEGER",
+		"ALTER TABLE test.users DROP COLUMN email",
+		"COMMENT ON TABLE test.users IS NULL",
+		"CREATE INDEX IF NOT EXISTS users_name_idx ON test.users(name)",
+	}
+	if !reflect.DeepEqual(want, down) {
+		t.Fatalf("want %q, got %q", want, down)
+	}
+
+	if l := DiffSchema(v2, v2); len(l) != 0 {
+		t.Fatalf("want no diff, got %q", l)
+	}
+}
+
+func TestCreateSchema(t *testing.T) {
+	tables := parseTestTables(t, testSchemaV2+`
+- name: post
+  table: test.posts
+  primaryKey: [id]
+  columns:
+    id: int64
+    user_id: int64
+  foreignKeys:
+    - columns: [user_id]
+      refTable: test.users
+      refColumns: [id]
+`)
+	stmts := CreateSchema(tables)
+	want := []string{
+		"CREATE TABLE IF NOT EXISTS test.users (\n\tid BIGINT NOT NULL,\n\tname TEXT NOT NULL DEFAULT '',\n\tage BIGINT NOT NULL,\n\temail TEXT,\n" +
+			"\tCONSTRAINT users_pkey PRIMARY KEY (id),\n\tCONSTRAINT users_email_key UNIQUE (email)\n)",
+		"COMMENT ON TABLE test.users IS 'users'",
+		"CREATE TABLE IF NOT EXISTS test.posts (\n\tid BIGINT NOT NULL,\n\tuser_id BIGINT NOT NULL,\n\tCONSTRAINT posts_pkey PRIMARY KEY (id)\n)",
+		"DO $$ BEGIN ALTER TABLE test.posts ADD CONSTRAINT posts_user_id_fkey FOREIGN KEY (user_id) REFERENCES test.users(id); " +
+			"EXCEPTION WHEN duplicate_object THEN NULL; END $$",
+	}
+	if !reflect.DeepEqual(want, stmts) {
+		t.Fatalf("want %q, got %q", want, stmts)
+	}
+}
+
+func TestGenerateSchema(t *testing.T) {
+	dir := t.TempDir()
+	if err := GenerateSchema(dir, parseTestTables(t, testSchemaV1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateSchema(dir, parseTestTables(t, testSchemaV1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateSchema(dir, parseTestTables(t, testSchemaV2)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, migrationDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"0001_init.down.sql", "0001_init.up.sql", "0002_alter.down.sql", "0002_alter.up.sql"}
+	if !reflect.DeepEqual(want, names) {
+		t.Fatalf("want %v, got %v", want, names)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, migrationDir, "0001_init.down.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "DROP TABLE IF EXISTS test.users;\n" {
+		t.Fatalf("unexpected down migration: %s", data)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, schemaFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\temail TEXT,\n") {
+		t.Fatalf("unexpected schema: %s", data)
+	}
+}
+
+func TestGetSQLType(t *testing.T) {
+	r := &RepoModel{
+		Name:        "user",
+		Columns:     yaml.MapSlice{{Key: "tags", Value: "[]int64"}, {Key: "gender", Value: "xtype.Gender"}, {Key: "place", Value: "xtype.Place"}},
+		JsonColumns: []string{"place"},
+	}
+	if typ, err := r.GetSQLType("tags"); err != nil || typ != "BIGINT[]" {
+		t.Fatal(typ, err)
+	}
+	if typ, err := r.GetSQLType("place"); err != nil || typ != "JSONB" {
+		t.Fatal(typ, err)
+	}
+	if _, err := r.GetSQLType("gender"); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+const testSchemaXpsql = `
+- name: user
+  table: test.users
+  primaryKey: [id]
+  columns:
+    id: int64
+    name: "*xtype.FullName"
+    balance: "*xtype.Money"
+    attrs: map[string]string
+  xpsqlColumns: [name, balance, attrs]
+`
+
+func TestDiffSchema_Xpsql(t *testing.T) {
+	v1 := parseTestTables(t, testSchemaV1)
+	v2 := parseTestTables(t, testSchemaXpsql)
+	up := DiffSchema(v1, v2)
+	want := []string{
+		"CREATE EXTENSION IF NOT EXISTS hstore",
+		"DO $$ BEGIN CREATE TYPE full_name AS (first TEXT, middle TEXT, last TEXT); EXCEPTION WHEN duplicate_object THEN NULL; END $$",
+		"DO $$ BEGIN CREATE TYPE money_amount AS (currency TEXT, amount NUMERIC); EXCEPTION WHEN duplicate_object THEN NULL; END $$",
+		"DROP INDEX IF EXISTS test.users_name_idx",
+		"ALTER TABLE test.users ALTER COLUMN name TYPE full_name USING name::full_name",
+		"ALTER TABLE test.users ALTER COLUMN name DROP NOT NULL",
+		"ALTER TABLE test.users ADD COLUMN balance money_amount",
+		"ALTER TABLE test.users ADD COLUMN attrs HSTORE NOT NULL",
+		"ALTER TABLE test.users DROP COLUMN age",
+	}
+	if !reflect.DeepEqual(want, up) {
+		t.Fatalf("want %q, got %q", want, up)
+	}
+
+	down := DiffSchema(v2, v1)
+	want = []string{
+		"DROP TYPE IF EXISTS money_amount",
+		"DROP TYPE IF EXISTS full_name",
+	}
+	if got := down[len(down)-2:]; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	if l := DiffSchema(v2, v2); len(l) != 0 {
+		t.Fatalf("want no diff, got %q", l)
+	}
+}
+
+func TestGetSQLType_Xpsql(t *testing.T) {
+	r := &RepoModel{
+		Name:         "user",
+		Columns:      yaml.MapSlice{{Key: "phone", Value: "*xcontact.PhoneNumber"}, {Key: "place", Value: "xtype.Place"}},
+		XpsqlColumns: []string{"phone", "place"},
+	}
+	if typ, err := r.GetSQLType("phone"); err != nil || typ != "phone_number" {
+		t.Fatal(typ, err)
+	}
+	if _, err := r.GetSQLType("place"); err == nil {
+		t.Fatal("want error of non-pointer place")
+	}
+
+	// points are native POINT, as xpsql can't scan postgis geometry
+	r.Columns = yaml.MapSlice{{Key: "location", Value: "*xtype.Point"}, {Key: "place", Value: "*xtype.Place"}}
+	r.XpsqlColumns = []string{"location", "place"}
+	if typ, err := r.GetSQLType("location"); err != nil || typ != "POINT" {
+		t.Fatal(typ, err)
+	}
+	if typ := xpsqlTypes["*xtype.Place"]; typ.Fields != "code TEXT, name TEXT, coordinate POINT" || typ.Extension != "" {
+		t.Fatal(typ)
+	}
+}
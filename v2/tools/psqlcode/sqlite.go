@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var goToSQLiteTypes = map[string]string{
+	"int":           "INTEGER",
+	"int64":         "INTEGER",
+	"uint":          "INTEGER",
+	"uint64":        "INTEGER",
+	"int32":         "INTEGER",
+	"uint32":        "INTEGER",
+	"int16":         "INTEGER",
+	"uint16":        "INTEGER",
+	"int8":          "INTEGER",
+	"uint8":         "INTEGER",
+	"float64":       "REAL",
+	"float32":       "REAL",
+	"string":        "TEXT",
+	"bool":          "BOOLEAN",
+	"[]byte":        "BLOB",
+	"time.Time":     "DATETIME",
+	"time.Duration": "INTEGER",
+}
+
+// getSQLiteType returns declared type of col, which makes drivers convert values into go types, e.g. DATETIME to time.Time
+func (r *RepoModel) getSQLiteType(col string) (string, error) {
+	if r.IsJSONText(col) {
+		return "TEXT", nil
+	}
+
+	goType := strings.TrimPrefix(r.GetColType(col), "*")
+	if t, ok := goToSQLiteTypes[goType]; ok {
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown sql type of %s.%s, declare it in sqlTypes", r.Name, col)
+}
+
+func getSQLiteDefault(v string) string {
+	if strings.EqualFold(v, "now()") {
+		return "CURRENT_TIMESTAMP"
+	}
+	return v
+}
+
+// createSQLiteTable declares constraints in table, as sqlite can't add them by ALTER TABLE
+func createSQLiteTable(t *TableSchema) []string {
+	var defs []string
+	for _, c := range t.Columns {
+		def := c.Name + " " + c.Type
+		if c.NotNull {
+			def += " NOT NULL"
+		}
+		if c.Default != "" {
+			def += " DEFAULT " + getSQLiteDefault(c.Default)
+		}
+		defs = append(defs, def)
+	}
+	defs = append(defs, "PRIMARY KEY ("+strings.Join(t.PrimaryKey, ", ")+")")
+	for _, u := range t.Uniques {
+		defs = append(defs, "CONSTRAINT "+u.Name+" UNIQUE ("+strings.Join(u.Columns, ", ")+")")
+	}
+	for _, fk := range t.ForeignKeys {
+		def := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s(%s)",
+			fk.Name, strings.Join(fk.Columns, ", "), fk.RefTable, strings.Join(fk.RefColumns, ", "))
+		if fk.OnDelete != "" {
+			def += " ON DELETE " + fk.OnDelete
+		}
+		if fk.OnUpdate != "" {
+			def += " ON UPDATE " + fk.OnUpdate
+		}
+		defs = append(defs, def)
+	}
+
+	stmts := []string{"CREATE TABLE IF NOT EXISTS " + t.Name + " (\n\t" + strings.Join(defs, ",\n\t") + "\n)"}
+	for _, idx := range t.Indexes {
+		stmts = append(stmts, createIndex(t, idx))
+	}
+	return stmts
+}
+
+// GenerateSQLiteSchema writes DDL of tables into dir/schema.sql.
+// Migrations are not generated, as sqlite doesn't support altering column types or constraints
+func GenerateSQLiteSchema(dir string, tables []*TableSchema) error {
+	var stmts []string
+	for _, t := range tables {
+		stmts = append(stmts, createSQLiteTable(t)...)
+	}
+	err := os.WriteFile(filepath.Join(dir, schemaFilename), []byte(joinStatements(stmts)), 0644)
+	if err != nil {
+		return fmt.Errorf("write schema: %w", err)
+	}
+	return nil
+}
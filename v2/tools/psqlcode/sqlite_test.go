@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestRepoModel_SQLite(t *testing.T) {
+	r := &RepoModel{
+		Name:       "user",
+		Table:      "test.users",
+		PrimaryKey: []string{"id"},
+		Columns: yaml.MapSlice{
+			{Key: "id", Value: "int64"},
+			{Key: "tags", Value: "[]string"},
+			{Key: "phone", Value: "*xcontact.PhoneNumber"},
+			{Key: "created_at", Value: "time.Time"},
+		},
+		XpsqlColumns: []string{"phone"},
+		Defaults:     map[string]string{"created_at": "now()"},
+		Dialect:      SQLite,
+	}
+	if s := r.TableName(); s != "users" {
+		t.Fatal(s)
+	}
+	if s := r.UpdateColumns(); s != "tags=?2, phone=?3, created_at=?4" {
+		t.Fatal(s)
+	}
+	if s := r.Args(); s != "v.ID, xsql.JSONText(v.Tags), xsql.JSONText(v.Phone), v.CreatedAt" {
+		t.Fatal(s)
+	}
+	if s := r.BatchKeyConditions() + " " + r.BatchKeyArgs(); s != "id IN (SELECT value FROM json_each(?1)) xsql.JSONText(ids)" {
+		t.Fatal(s)
+	}
+
+	table, err := r.GetTableSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts := createSQLiteTable(table)
+	want := "CREATE TABLE IF NOT EXISTS users (\n" +
+		"\tid INTEGER NOT NULL,\n" +
+		"\ttags TEXT,\n" +
+		"\tphone TEXT,\n" +
+		"\tcreated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+		"\tPRIMARY KEY (id)\n)"
+	if !reflect.DeepEqual([]string{want}, stmts) {
+		t.Fatalf("want %q, got %q", want, stmts)
+	}
+}
+
+func TestGetImports(t *testing.T) {
+	imports := getImports("context.", "sql.", "v.ID, xsql.JSON(v.Place), pq.Array(v.Tags)", "time.Time", "*xtype.Place")
+	want := [][]string{
+		{"context", "database/sql", "time"},
+		{"code.olapie.com/sugar/v2/xsql", "code.olapie.com/sugar/v2/xtype", "github.com/lib/pq"},
+	}
+	if !reflect.DeepEqual(want, imports) {
+		t.Fatalf("want %v, got %v", want, imports)
+	}
+}
+
+func TestParseDialect(t *testing.T) {
+	if d, err := ParseDialect(""); err != nil || d != Postgres {
+		t.Fatal(d, err)
+	}
+	if d, err := ParseDialect("sqlite"); err != nil || d != SQLite {
+		t.Fatal(d, err)
+	}
+	if _, err := ParseDialect("mysql"); err == nil || !strings.Contains(err.Error(), "mysql") {
+		t.Fatal("want error")
+	}
+}
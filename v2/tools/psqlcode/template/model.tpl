@@ -1,8 +1,19 @@
 {{ define `model` }}package generate
 import (
-	"time"
+{{- range .Imports}}
+{{range .}}
+	"{{.}}"
+{{- end}}
+{{- end}}
 )
 
+// executor is implemented by *sql.DB and *sql.Tx
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 {{range .Entities}}
 
 type {{.Name}} struct {
@@ -1,11 +1,11 @@
 {{ define `repo` }}package generate
 
 import (
-	"context"
-	"database/sql"
-	"time"
-
-	"github.com/lib/pq"
+{{- range .Imports}}
+{{range .}}
+	"{{.}}"
+{{- end}}
+{{- end}}
 )
 
 type {{.Name}} struct {
@@ -49,18 +49,18 @@ func (r *{{.Name}}) SaveTx(ctx context.Context, tx *sql.Tx, v *{{.Entity.Name}})
 }
 
 func (r *{{.Name}}) Delete(ctx context.Context, {{.KeyParams}}) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM {{.Table}} WHERE {{.KeyConditions}}`, {{.KeyArgs}})
+	_, err := r.db.ExecContext(ctx, `{{template "deleteByKey" .}}`, {{.KeyArgs}})
 	return err
 }
 
 func (r *{{.Name}}) DeleteTx(ctx context.Context, tx *sql.Tx, {{.KeyParams}}) error {
-	_, err := tx.ExecContext(ctx, `DELETE FROM {{.Table}} WHERE {{.KeyConditions}}`, {{.KeyArgs}})
+	_, err := tx.ExecContext(ctx, `{{template "deleteByKey" .}}`, {{.KeyArgs}})
 	return err
 }
 
 func (r *{{.Name}}) Get(ctx context.Context, {{.KeyParams}}) (v *{{.Entity.Name}}, err error) {
     v = new({{.Entity.Name}})
-	row := r.db.QueryRowContext(ctx, `SELECT {{.Columns}} FROM {{.Table}} WHERE {{.KeyConditions}}`, {{.KeyArgs}})
+	row := r.db.QueryRowContext(ctx, `SELECT {{.Columns}} FROM {{.Table}} WHERE {{.KeyArgConditions}}{{if .SoftDelete}} AND {{.NotDeleted}}{{end}}`, {{.KeyArgs}})
 	err = row.Scan({{.ScanHolders}})
 	if err != nil {
 	    return nil, err
@@ -70,7 +70,7 @@ func (r *{{.Name}}) Get(ctx context.Context, {{.KeyParams}}) (v *{{.Entity.Name}
 
 func (r *{{.Name}}) GetTx(ctx context.Context, tx *sql.Tx, {{.KeyParams}}) (v *{{.Entity.Name}}, err error) {
     v = new({{.Entity.Name}})
-	row := tx.QueryRowContext(ctx, `SELECT {{.Columns}} FROM {{.Table}} WHERE {{.KeyConditions}}`, {{.KeyArgs}})
+	row := tx.QueryRowContext(ctx, `SELECT {{.Columns}} FROM {{.Table}} WHERE {{.KeyArgConditions}}{{if .SoftDelete}} AND {{.NotDeleted}}{{end}}`, {{.KeyArgs}})
 	err = row.Scan({{.ScanHolders}})
 	if err != nil {
 	    return nil, err
@@ -80,7 +80,7 @@ func (r *{{.Name}}) GetTx(ctx context.Context, tx *sql.Tx, {{.KeyParams}}) (v *{
 
 {{if eq .NumKeys 1}}
 func (r *{{.Name}}) BatchGet(ctx context.Context, {{.BatchKeyParams}}) (list []*{{.Entity.Name}}, err error) {
-	rows, err :=  r.db.QueryContext(ctx, `SELECT {{.Columns}} FROM {{.Table}} WHERE {{.BatchKeyConditions}}`, pq.Array({{.BatchKeyArgs}}))
+	rows, err :=  r.db.QueryContext(ctx, `SELECT {{.Columns}} FROM {{.Table}} WHERE {{.BatchKeyConditions}}{{if .SoftDelete}} AND {{.NotDeleted}}{{end}}`, {{.BatchKeyArgs}})
 	if err != nil {
         return nil, err
     }
@@ -97,7 +97,7 @@ func (r *{{.Name}}) BatchGet(ctx context.Context, {{.BatchKeyParams}}) (list []*
 }
 
 func (r *{{.Name}}) BatchGetTx(ctx context.Context, tx *sql.Tx, {{.BatchKeyParams}}) (list []*{{.Entity.Name}}, err error) {
-	rows, err :=  tx.QueryContext(ctx, `SELECT {{.Columns}} FROM {{.Table}} WHERE {{.BatchKeyConditions}}`, pq.Array({{.BatchKeyArgs}}))
+	rows, err :=  tx.QueryContext(ctx, `SELECT {{.Columns}} FROM {{.Table}} WHERE {{.BatchKeyConditions}}{{if .SoftDelete}} AND {{.NotDeleted}}{{end}}`, {{.BatchKeyArgs}})
 	if err != nil {
         return nil, err
     }
@@ -114,19 +114,19 @@ func (r *{{.Name}}) BatchGetTx(ctx context.Context, tx *sql.Tx, {{.BatchKeyParam
 }
 
 func (r *{{.Name}}) BatchDelete(ctx context.Context, {{.BatchKeyParams}}) error {
-	_, err :=  r.db.ExecContext(ctx, `DELETE FROM {{.Table}} WHERE {{.BatchKeyConditions}}`, pq.Array({{.BatchKeyArgs}}))
+	_, err :=  r.db.ExecContext(ctx, `{{if .SoftDelete}}UPDATE {{.Table}} SET deleted_at={{.Now}} WHERE {{.BatchKeyConditions}} AND {{.NotDeleted}}{{else}}DELETE FROM {{.Table}} WHERE {{.BatchKeyConditions}}{{end}}`, {{.BatchKeyArgs}})
 	return err
 }
 
 func (r *{{.Name}}) BatchDeleteTx(ctx context.Context, tx *sql.Tx, {{.BatchKeyParams}}) error {
-	_, err :=  tx.ExecContext(ctx, `DELETE FROM {{.Table}} WHERE {{.BatchKeyConditions}}`, pq.Array({{.BatchKeyArgs}}))
+	_, err :=  tx.ExecContext(ctx, `{{if .SoftDelete}}UPDATE {{.Table}} SET deleted_at={{.Now}} WHERE {{.BatchKeyConditions}} AND {{.NotDeleted}}{{else}}DELETE FROM {{.Table}} WHERE {{.BatchKeyConditions}}{{end}}`, {{.BatchKeyArgs}})
 	return err
 }
 
 {{end}}
 
 func (r *{{.Name}}) List(ctx context.Context) (list []*{{.Entity.Name}}, err error) {
-	rows, err := r.db.QueryContext(ctx, `SELECT {{.Columns}} FROM {{.Table}}`)
+	rows, err := r.db.QueryContext(ctx, `SELECT {{.Columns}} FROM {{.Table}}{{if .SoftDelete}} WHERE {{.NotDeleted}}{{end}}`)
     if err != nil {
         return nil, err
     }
@@ -143,7 +143,7 @@ func (r *{{.Name}}) List(ctx context.Context) (list []*{{.Entity.Name}}, err err
 }
 
 func (r *{{.Name}}) ListTx(ctx context.Context, tx *sql.Tx) (list []*{{.Entity.Name}}, err error) {
-	rows, err := tx.QueryContext(ctx, `SELECT {{.Columns}} FROM {{.Table}}`)
+	rows, err := tx.QueryContext(ctx, `SELECT {{.Columns}} FROM {{.Table}}{{if .SoftDelete}} WHERE {{.NotDeleted}}{{end}}`)
     if err != nil {
         return nil, err
     }
@@ -159,4 +159,162 @@ func (r *{{.Name}}) ListTx(ctx context.Context, tx *sql.Tx) (list []*{{.Entity.N
 	return list, nil
 }
 
+// whereClause joins conditions{{if .Filters}} with conditions of filter{{end}}{{if .SoftDelete}}, excluding soft deleted records{{end}}
+func (r *{{.Name}}) whereClause({{if .Filters}}filter *{{.Entity.Name}}Filter, {{end}}args []any, conds ...string) (string, []any) {
+	{{- if .Filters}}
+	conds, args = filter.appendConditions(conds, args)
+	{{- end}}
+	{{- if .SoftDelete}}
+	conds = append(conds, "{{.NotDeleted}}")
+	{{- end}}
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func (r *{{.Name}}) Count(ctx context.Context{{if .Filters}}, filter *{{.Entity.Name}}Filter{{end}}) (int64, error) {
+	return r.count(ctx, r.db{{if .Filters}}, filter{{end}})
+}
+
+func (r *{{.Name}}) CountTx(ctx context.Context, tx *sql.Tx{{if .Filters}}, filter *{{.Entity.Name}}Filter{{end}}) (int64, error) {
+	return r.count(ctx, tx{{if .Filters}}, filter{{end}})
+}
+
+func (r *{{.Name}}) count(ctx context.Context, exe executor{{if .Filters}}, filter *{{.Entity.Name}}Filter{{end}}) (n int64, err error) {
+	where, args := r.whereClause({{if .Filters}}filter, {{end}}nil)
+	err = exe.QueryRowContext(ctx, `SELECT COUNT(*) FROM {{.Table}}`+where, args...).Scan(&n)
+	return n, err
+}
+
+func (r *{{.Name}}) Exists(ctx context.Context, {{.KeyParams}}) (bool, error) {
+	return r.exists(ctx, r.db, {{.KeyArgs}})
+}
+
+func (r *{{.Name}}) ExistsTx(ctx context.Context, tx *sql.Tx, {{.KeyParams}}) (bool, error) {
+	return r.exists(ctx, tx, {{.KeyArgs}})
+}
+
+func (r *{{.Name}}) exists(ctx context.Context, exe executor, {{.KeyParams}}) (ok bool, err error) {
+	err = exe.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM {{.Table}} WHERE {{.KeyArgConditions}}{{if .SoftDelete}} AND {{.NotDeleted}}{{end}})`, {{.KeyArgs}}).Scan(&ok)
+	return ok, err
+}
+
+{{if .Filters}}
+// {{.Entity.Name}}Filter matches records whose columns equal non-nil fields
+type {{.Entity.Name}}Filter struct {
+{{- range .Filters}}
+	{{.Field}} *{{.Type}}
+{{- end}}
+}
+
+func (f *{{.Entity.Name}}Filter) appendConditions(conds []string, args []any) ([]string, []any) {
+	if f == nil {
+		return conds, args
+	}
+{{- range .Filters}}
+	if f.{{.Field}} != nil {
+		args = append(args, *f.{{.Field}})
+		conds = append(conds, fmt.Sprintf("{{.Column}}={{$.ParamPrefix}}%d", len(args)))
+	}
+{{- end}}
+	return conds, args
+}
+{{end}}
+
+{{if .CursorFields}}
+// {{.Entity.Name}}Cursor is the position of a record in order of {{.SortColumns}}
+type {{.Entity.Name}}Cursor struct {
+{{- range .CursorFields}}
+	{{.Field}} {{.Type}}
+{{- end}}
+}
+
+// ListPage returns at most limit records after cursor in order of {{.SortColumns}}.
+// The returned cursor is nil if there are no more records
+func (r *{{.Name}}) ListPage(ctx context.Context{{if .Filters}}, filter *{{.Entity.Name}}Filter{{end}}, after *{{.Entity.Name}}Cursor, limit int) ([]*{{.Entity.Name}}, *{{.Entity.Name}}Cursor, error) {
+	return r.listPage(ctx, r.db{{if .Filters}}, filter{{end}}, after, limit)
+}
+
+func (r *{{.Name}}) ListPageTx(ctx context.Context, tx *sql.Tx{{if .Filters}}, filter *{{.Entity.Name}}Filter{{end}}, after *{{.Entity.Name}}Cursor, limit int) ([]*{{.Entity.Name}}, *{{.Entity.Name}}Cursor, error) {
+	return r.listPage(ctx, tx{{if .Filters}}, filter{{end}}, after, limit)
+}
+
+func (r *{{.Name}}) listPage(ctx context.Context, exe executor{{if .Filters}}, filter *{{.Entity.Name}}Filter{{end}}, after *{{.Entity.Name}}Cursor, limit int) (list []*{{.Entity.Name}}, next *{{.Entity.Name}}Cursor, err error) {
+	var args []any
+	var conds []string
+	if after != nil {
+		args = append(args, {{.CursorArgs}})
+		conds = append(conds, "({{.SortColumns}}) {{.CursorOp}} ({{.CursorPlaceholders}})")
+	}
+	where, args := r.whereClause({{if .Filters}}filter, {{end}}args, conds...)
+	args = append(args, limit)
+	rows, err := exe.QueryContext(ctx, fmt.Sprintf(`SELECT {{.Columns}} FROM {{.Table}}%s ORDER BY {{.OrderBy}} LIMIT {{.ParamPrefix}}%d`, where, len(args)), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		v := new({{.Entity.Name}})
+		err = rows.Scan({{.ScanHolders}})
+		if err != nil {
+			return nil, nil, err
+		}
+		list = append(list, v)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if limit > 0 && len(list) == limit {
+		v := list[len(list)-1]
+		next = &{{.Entity.Name}}Cursor{
+		{{- range .CursorFields}}
+			{{.Field}}: v.{{.Field}},
+		{{- end}}
+		}
+	}
+	return list, next, nil
+}
+{{end}}
+
+{{if .SoftDelete}}
+// Restore undoes soft deletion
+func (r *{{.Name}}) Restore(ctx context.Context, {{.KeyParams}}) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE {{.Table}} SET deleted_at=NULL WHERE {{.KeyArgConditions}}`, {{.KeyArgs}})
+	return err
+}
+
+func (r *{{.Name}}) RestoreTx(ctx context.Context, tx *sql.Tx, {{.KeyParams}}) error {
+	_, err := tx.ExecContext(ctx, `UPDATE {{.Table}} SET deleted_at=NULL WHERE {{.KeyArgConditions}}`, {{.KeyArgs}})
+	return err
+}
+
+// Purge deletes record permanently, no matter whether it's soft deleted
+func (r *{{.Name}}) Purge(ctx context.Context, {{.KeyParams}}) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM {{.Table}} WHERE {{.KeyArgConditions}}`, {{.KeyArgs}})
+	return err
+}
+
+func (r *{{.Name}}) PurgeTx(ctx context.Context, tx *sql.Tx, {{.KeyParams}}) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM {{.Table}} WHERE {{.KeyArgConditions}}`, {{.KeyArgs}})
+	return err
+}
+
+// PurgeDeleted permanently deletes records which are soft deleted before t
+func (r *{{.Name}}) PurgeDeleted(ctx context.Context, t time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM {{.Table}} WHERE deleted_at<{{.ParamPrefix}}1`, {{.PurgeDeletedArg}})
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+{{end}}
+
+{{end}}{{ define `deleteByKey` }}
+{{- if .SoftDelete -}}
+UPDATE {{.Table}} SET deleted_at={{.Now}} WHERE {{.KeyArgConditions}} AND {{.NotDeleted}}
+{{- else -}}
+DELETE FROM {{.Table}} WHERE {{.KeyArgConditions}}
+{{- end -}}
 {{end}}
\ No newline at end of file
@@ -2,22 +2,32 @@
 
 import (
 	"context"
-    "testing"
-
-	"github.com/lib/pq"
+	"testing"
+	{{- if .SoftDelete}}
+	"time"
+	{{- end}}
 )
 
 func setupTest{{.Name}}(t *testing.T) *{{.Name}} {
     db := setupTestDB(t)
+    {{- if ne .Dialect "sqlite"}}
     _, err := db.Exec(`TRUNCATE TABLE {{.Table}}`)
     if err != nil {
         t.Error(err)
     }
+    {{- end}}
     return New{{.Name}}(db)
 }
 
 func newTest{{.Entity.Name}}() *{{.Entity.Name}} {
-    return new({{.Entity.Name}})
+    v := new({{.Entity.Name}})
+    {{- range .Entity.Fields}}
+    {{- if eq .Type "[]byte"}}
+    // nil bytes are NULL
+    v.{{toStructName .Name}} = []byte{}
+    {{- end}}
+    {{- end}}
+    return v
 }
 
 func TestInsert{{.Entity.Name}}(t *testing.T) {
@@ -76,4 +86,161 @@ func TestList{{.Entity.Name}}(t *testing.T) {
     // TODO:
 }
 
+func TestCount{{.Entity.Name}}(t *testing.T) {
+    ctx := context.TODO()
+    v := newTest{{.Entity.Name}}()
+    r := setupTest{{.Name}}(t)
+    err := r.Insert(ctx, v)
+    if err != nil {
+        t.Fatal(err)
+    }
+    n, err := r.Count(ctx{{if .Filters}}, nil{{end}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n != 1 {
+        t.Errorf("want 1, got %d", n)
+    }
+    {{- with .Filters}}
+    {{- $f := index . 0}}
+
+    n, err = r.Count(ctx, &{{$.Entity.Name}}Filter{ {{$f.Field}}: {{if $f.Pointer}}v.{{$f.Field}}{{else}}&v.{{$f.Field}}{{end}} })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n != 1 {
+        t.Errorf("want 1, got %d", n)
+    }
+    {{- end}}
+}
+
+func TestExists{{.Entity.Name}}(t *testing.T) {
+    ctx := context.TODO()
+    v := newTest{{.Entity.Name}}()
+    r := setupTest{{.Name}}(t)
+    ok, err := r.Exists(ctx, {{.EntityKeyArgs}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ok {
+        t.Error("want not exists")
+    }
+    err = r.Insert(ctx, v)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ok, err = r.Exists(ctx, {{.EntityKeyArgs}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !ok {
+        t.Error("want exists")
+    }
+}
+
+{{if .CursorFields}}
+func TestListPage{{.Entity.Name}}(t *testing.T) {
+    ctx := context.TODO()
+    v := newTest{{.Entity.Name}}()
+    r := setupTest{{.Name}}(t)
+    err := r.Insert(ctx, v)
+    if err != nil {
+        t.Fatal(err)
+    }
+    list, next, err := r.ListPage(ctx{{if .Filters}}, nil{{end}}, nil, 1)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(list) != 1 || next == nil {
+        t.Fatalf("want 1 record and next cursor, got %d, %v", len(list), next)
+    }
+    list, next, err = r.ListPage(ctx{{if .Filters}}, nil{{end}}, next, 1)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(list) != 0 || next != nil {
+        t.Fatalf("want no more records, got %d, %v", len(list), next)
+    }
+}
+{{end}}
+
+{{if .SoftDelete}}
+func TestSoftDelete{{.Entity.Name}}(t *testing.T) {
+    ctx := context.TODO()
+    v := newTest{{.Entity.Name}}()
+    r := setupTest{{.Name}}(t)
+    err := r.Insert(ctx, v)
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = r.Delete(ctx, {{.EntityKeyArgs}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    ok, err := r.Exists(ctx, {{.EntityKeyArgs}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ok {
+        t.Error("want soft deleted")
+    }
+
+    err = r.Restore(ctx, {{.EntityKeyArgs}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = r.Get(ctx, {{.EntityKeyArgs}})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    err = r.Purge(ctx, {{.EntityKeyArgs}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = r.Restore(ctx, {{.EntityKeyArgs}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    ok, err = r.Exists(ctx, {{.EntityKeyArgs}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ok {
+        t.Error("want purged")
+    }
+}
+
+func TestPurgeDeleted{{.Entity.Name}}(t *testing.T) {
+    ctx := context.TODO()
+    v := newTest{{.Entity.Name}}()
+    r := setupTest{{.Name}}(t)
+    err := r.Insert(ctx, v)
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = r.Delete(ctx, {{.EntityKeyArgs}})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    n, err := r.PurgeDeleted(ctx, time.Now().Add(-time.Hour))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n != 0 {
+        t.Errorf("want 0, got %d", n)
+    }
+
+    // time zone of t doesn't matter
+    n, err = r.PurgeDeleted(ctx, time.Now().Add(time.Hour).In(time.FixedZone("UTC-7", -7*3600)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n != 1 {
+        t.Errorf("want 1, got %d", n)
+    }
+}
+{{end}}
+
 {{end}}
\ No newline at end of file
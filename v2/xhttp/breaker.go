@@ -0,0 +1,116 @@
+package xhttp
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"code.olapie.com/sugar/v2/xerror"
+	"code.olapie.com/sugar/v2/xtime"
+)
+
+const ErrCircuitOpen xerror.String = "circuit is open"
+
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures which opens the circuit of a host
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open, after which a trial request is allowed
+	OpenTimeout time.Duration
+	Clock       xtime.Clock
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type circuit struct {
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+// CircuitBreaker fails requests to a host fast with ErrCircuitOpen after repeated failures,
+// which are network errors and 5xx responses
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	options  CircuitBreakerOptions
+	circuits map[string]*circuit
+}
+
+func NewCircuitBreaker(optFns ...func(options *CircuitBreakerOptions)) *CircuitBreaker {
+	b := &CircuitBreaker{
+		options: CircuitBreakerOptions{
+			FailureThreshold: 5,
+			OpenTimeout:      30 * time.Second,
+			Clock:            xtime.LocalClock{},
+		},
+		circuits: make(map[string]*circuit),
+	}
+	for _, fn := range optFns {
+		fn(&b.options)
+	}
+	return b
+}
+
+// Allow returns ErrCircuitOpen if requests to host should fail fast.
+// Only one trial request is allowed after OpenTimeout until its result is reported
+func (b *CircuitBreaker) Allow(host string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[host]
+	if c == nil {
+		return nil
+	}
+	switch c.state {
+	case circuitOpen:
+		if b.options.Clock.Now().Sub(c.openedAt) < b.options.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		c.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+// Report records result of request to host
+func (b *CircuitBreaker) Report(host string, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[host]
+	if success {
+		if c != nil {
+			delete(b.circuits, host)
+		}
+		return
+	}
+
+	if c == nil {
+		c = new(circuit)
+		b.circuits[host] = c
+	}
+	c.failures++
+	if c.state == circuitHalfOpen || c.failures >= b.options.FailureThreshold {
+		c.state = circuitOpen
+		c.openedAt = b.options.Clock.Now()
+	}
+}
+
+// release gives up the trial request of half-open circuit, so that another trial request is allowed
+func (b *CircuitBreaker) release(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.circuits[host]; c != nil && c.state == circuitHalfOpen {
+		c.state = circuitOpen
+	}
+}
+
+func isFailure(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,127 @@
+package xhttp_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code.olapie.com/sugar/v2/xhttp"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	clock := &testClock{now: time.Now()}
+	c := xhttp.NewGet[any, struct{}](server.URL)
+	c.CircuitBreaker = xhttp.NewCircuitBreaker(func(options *xhttp.CircuitBreakerOptions) {
+		options.FailureThreshold = 2
+		options.OpenTimeout = time.Minute
+		options.Clock = clock
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := c.Call(context.Background(), nil)
+		xtest.Error(t, err)
+		xtest.False(t, errors.Is(err, xhttp.ErrCircuitOpen))
+	}
+
+	_, err := c.Call(context.Background(), nil)
+	xtest.True(t, errors.Is(err, xhttp.ErrCircuitOpen))
+	xtest.Equal(t, int32(2), count.Load())
+
+	t.Run("HalfOpenFailure", func(t *testing.T) {
+		clock.now = clock.now.Add(time.Minute)
+		_, err := c.Call(context.Background(), nil)
+		xtest.False(t, errors.Is(err, xhttp.ErrCircuitOpen))
+		xtest.Equal(t, int32(3), count.Load())
+
+		_, err = c.Call(context.Background(), nil)
+		xtest.True(t, errors.Is(err, xhttp.ErrCircuitOpen))
+	})
+
+	t.Run("HalfOpenSuccess", func(t *testing.T) {
+		failing.Store(false)
+		clock.now = clock.now.Add(time.Minute)
+		_, err := c.Call(context.Background(), nil)
+		xtest.NoError(t, err)
+
+		_, err = c.Call(context.Background(), nil)
+		xtest.NoError(t, err)
+		xtest.Equal(t, int32(5), count.Load())
+	})
+}
+
+func TestCircuitBreaker_HalfOpenNotSent(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	blocked := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("block") != "" {
+			<-blocked
+			return
+		}
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	defer close(blocked)
+
+	clock := &testClock{now: time.Now()}
+	breaker := xhttp.NewCircuitBreaker(func(options *xhttp.CircuitBreakerOptions) {
+		options.FailureThreshold = 1
+		options.OpenTimeout = time.Minute
+		options.Clock = clock
+	})
+	c := xhttp.NewGet[any, struct{}](server.URL)
+	c.CircuitBreaker = breaker
+	_, err := c.Call(context.Background(), nil)
+	xtest.Error(t, err)
+	_, err = c.Call(context.Background(), nil)
+	xtest.True(t, errors.Is(err, xhttp.ErrCircuitOpen))
+	failing.Store(false)
+	clock.now = clock.now.Add(time.Minute)
+
+	// trial request fails before being sent
+	errBeforeCall := errors.New("before call")
+	c.BeforeCall = func(req *http.Request) error {
+		return errBeforeCall
+	}
+	_, err = c.Call(context.Background(), nil)
+	xtest.True(t, errors.Is(err, errBeforeCall), err)
+
+	// trial request is canceled by caller
+	c.BeforeCall = nil
+	blocking := xhttp.NewGet[any, struct{}](server.URL + "?block=1")
+	blocking.CircuitBreaker = breaker
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = blocking.Call(ctx, nil)
+	xtest.Error(t, err)
+	xtest.False(t, errors.Is(err, xhttp.ErrCircuitOpen))
+
+	_, err = c.Call(context.Background(), nil)
+	xtest.NoError(t, err)
+}
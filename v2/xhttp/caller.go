@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -30,6 +31,15 @@ type Caller[IN any, OUT any] struct {
 	Method     string
 	Endpoint   string
 	BeforeCall RequestInterceptorFunc
+	// Signer signs request after BeforeCall
+	Signer Signer
+	// Retry is nil by default, which means only one attempt per call.
+	// BeforeCall and Signer are applied again to every attempt
+	Retry *RetryPolicy
+	// CircuitBreaker fails calls with ErrCircuitOpen after repeated failures of the host
+	CircuitBreaker *CircuitBreaker
+	// UploadProgress is called while request body is being sent
+	UploadProgress ProgressFunc
 }
 
 func NewCaller[IN any, OUT any](method string, endpoint string) *Caller[IN, OUT] {
@@ -124,6 +134,14 @@ func (c *Caller[IN, OUT]) CallAndRewrite(ctx context.Context, input IN, writer i
 }
 
 func (c *Caller[IN, OUT]) call(ctx context.Context, input IN) (*http.Response, error) {
+	req, err := c.newRequest(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+func (c *Caller[IN, OUT]) newRequest(ctx context.Context, input IN) (*http.Request, error) {
 	var contentType string
 	endpoint, err := url.PathUnescape(c.Endpoint)
 	if err != nil {
@@ -140,34 +158,113 @@ func (c *Caller[IN, OUT]) call(ctx context.Context, input IN) (*http.Response, e
 	}
 	req.Header.Set(KeyContentType, contentType)
 	req.Header.Set(KeyTraceID, uuid.NewString())
+	return req, nil
+}
+
+// do sends req with retry policy and circuit breaker
+func (c *Caller[IN, OUT]) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.doAttempts(req)
+	if err != nil && req.Body != nil {
+		// body may not be closed by client if it's not sent, e.g. streaming multipart form
+		req.Body.Close()
+	}
+	return resp, err
+}
 
+func (c *Caller[IN, OUT]) doAttempts(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
 	client := http.DefaultClient
 	if c.Client != nil {
 		client = c.Client
 	}
 
+	for attempt := 1; ; attempt++ {
+		attemptReq, err := c.newAttemptRequest(req)
+		if err != nil {
+			return nil, err
+		}
+
+		// circuit is checked right before sending, as every allowed request must be reported
+		if c.CircuitBreaker != nil {
+			if err = c.CircuitBreaker.Allow(req.URL.Host); err != nil {
+				if attemptReq.Body != nil {
+					attemptReq.Body.Close()
+				}
+				return nil, fmt.Errorf("send request: %w", err)
+			}
+		}
+
+		resp, err := client.Do(attemptReq)
+		c.reportResult(req, resp, err)
+
+		if !c.Retry.shouldRetry(attempt, req, resp, err) {
+			if err != nil {
+				return nil, fmt.Errorf("send request: %w", toCallError(err))
+			}
+			return resp, nil
+		}
+
+		delay, ok := c.Retry.getDelay(attempt, resp)
+		if !ok {
+			return resp, nil
+		}
+		discardResponse(resp)
+		if err = sleep(ctx, delay); err != nil {
+			return nil, fmt.Errorf("send request: %w", toCallError(err))
+		}
+	}
+}
+
+// reportResult reports result of the request to circuit breaker
+func (c *Caller[IN, OUT]) reportResult(req *http.Request, resp *http.Response, err error) {
+	if c.CircuitBreaker == nil {
+		return
+	}
+	if err != nil && req.Context().Err() != nil {
+		// canceled by caller, which tells nothing about the host
+		c.CircuitBreaker.release(req.URL.Host)
+		return
+	}
+	c.CircuitBreaker.Report(req.URL.Host, !isFailure(resp, err))
+}
+
+// newAttemptRequest copies req with a fresh body, so that req can be sent again
+func (c *Caller[IN, OUT]) newAttemptRequest(req *http.Request) (*http.Request, error) {
+	attemptReq := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("get body: %w", err)
+		}
+		attemptReq.Body = body
+	}
+
 	if c.BeforeCall != nil {
-		if err = c.BeforeCall(req); err != nil {
+		if err := c.BeforeCall(attemptReq); err != nil {
 			return nil, fmt.Errorf("before call: %w", err)
 		}
 	}
 
-	fmt.Println(req.Method, req.URL.String())
-
-	resp, err := client.Do(req)
-	if err != nil {
-		if err == context.DeadlineExceeded {
-			err = xerror.RequestTimeout(err.Error())
-		} else {
-			if tr, ok := err.(interface{ Timeout() bool }); ok && tr.Timeout() {
-				err = xerror.RequestTimeout(err.Error())
-			} else {
-				err = xerror.Format(600, err.Error())
-			}
+	if c.Signer != nil {
+		if err := c.Signer.Sign(attemptReq.Context(), attemptReq); err != nil {
+			return nil, fmt.Errorf("sign: %w", err)
 		}
-		return nil, fmt.Errorf("send request: %w", err)
 	}
-	return resp, nil
+
+	if c.UploadProgress != nil && attemptReq.Body != nil && attemptReq.Body != http.NoBody {
+		attemptReq.Body = newProgressReader(attemptReq.Body, attemptReq.ContentLength, c.UploadProgress)
+	}
+	return attemptReq, nil
+}
+
+func toCallError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return xerror.RequestTimeout(err.Error())
+	}
+	if tr, ok := err.(interface{ Timeout() bool }); ok && tr.Timeout() {
+		return xerror.RequestTimeout(err.Error())
+	}
+	return xerror.Format(600, err.Error())
 }
 
 func (c *Caller[IN, OUT]) parseInput(contentType *string, endpoint *string, input any) (io.Reader, error) {
@@ -179,6 +276,17 @@ func (c *Caller[IN, OUT]) parseInput(contentType *string, endpoint *string, inpu
 		return bytes.NewReader(b), nil
 	}
 
+	switch v := input.(type) {
+	case *MultipartForm:
+		body, ct := v.newReader()
+		*contentType = ct
+		return body, nil
+	case *FilePart:
+		body, ct := (&MultipartForm{Files: []*FilePart{v}}).newReader()
+		*contentType = ct
+		return body, nil
+	}
+
 	body, ok := input.(io.Reader)
 	if ok {
 		if *contentType == "" {
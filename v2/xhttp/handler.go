@@ -0,0 +1,293 @@
+package xhttp
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"code.olapie.com/sugar/v2/xassign"
+	"code.olapie.com/sugar/v2/xcheck"
+	"code.olapie.com/sugar/v2/xerror"
+	"code.olapie.com/sugar/v2/xname"
+	"code.olapie.com/sugar/v2/xruntime"
+	"code.olapie.com/sugar/v2/xurl"
+)
+
+// Middleware wraps a handler, e.g. to authenticate or log requests
+type Middleware func(next http.Handler) http.Handler
+
+// Chain wraps h with middlewares, the first of which is the outermost one
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+type HandleOptions struct {
+	// Pattern is the path with params in braces like endpoint of Caller, e.g. /users/{id}.
+	// It's matched with the tail of request path, so that handler can be mounted under any prefix
+	Pattern string
+	// MaxMemory is the memory limit of parsing multipart form, the rest of which is stored in temporary files
+	MaxMemory int64
+	// MaxBodySize limits size of request body, which is 32 MiB by default. No limit if it's not positive
+	MaxBodySize int64
+}
+
+// Handle is the server side mirror of Caller.
+// IN is bound from headers, query, body and path params, the latter of which has higher priority.
+// Body can be JSON, form or multipart form, files of which are bound to fields of *multipart.FileHeader or []*multipart.FileHeader.
+// Fields in JSON body are not overwritten by headers or query, but path params.
+// If IN is []byte, it's bound to the raw body.
+// OUT is encoded according to Accept, and errors are responded with status code of xerror.GetCode.
+// Messages of 5xx errors which are not xerror.Error are hidden from clients
+func Handle[IN any, OUT any](fn func(ctx context.Context, in IN) (OUT, error), optFns ...func(options *HandleOptions)) http.Handler {
+	options := &HandleOptions{
+		MaxMemory:   32 << 20,
+		MaxBodySize: 32 << 20,
+	}
+	for _, f := range optFns {
+		f(options)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		if options.MaxBodySize > 0 && req.Body != nil {
+			req.Body = http.MaxBytesReader(w, req.Body, options.MaxBodySize)
+		}
+		in, err := bindRequest[IN](req, options)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				respondError(ctx, w, xerror.RequestEntityTooLarge("request body exceeds %d bytes", maxBytesErr.Limit))
+				return
+			}
+			respondError(ctx, w, xerror.BadRequest("%v", err))
+			return
+		}
+
+		if err = xcheck.Validate(in); err != nil {
+			respondError(ctx, w, xerror.BadRequest("%v", err))
+			return
+		}
+
+		out, err := fn(ctx, in)
+		if err != nil {
+			respondError(ctx, w, err)
+			return
+		}
+		respondResult(ctx, w, req, out)
+	})
+}
+
+func bindRequest[IN any](req *http.Request, options *HandleOptions) (IN, error) {
+	var in IN
+	if _, ok := any(in).([]byte); ok {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return in, fmt.Errorf("read body: %w", err)
+		}
+		return any(body).(IN), nil
+	}
+
+	pathParams := getPathParams(options.Pattern, req.URL.Path)
+	switch xruntime.IndirectKind(in) {
+	case reflect.Struct, reflect.Map:
+		break
+	default:
+		// scalar value can only be bound to the single path param or query param, e.g. /users/{id}
+		var v any
+		for _, p := range pathParams {
+			v = p
+		}
+		if v == nil {
+			if query := req.URL.Query(); len(query) == 1 {
+				for k := range query {
+					v = query.Get(k)
+				}
+			}
+		}
+		if v == nil {
+			return in, nil
+		}
+		if err := xassign.Assign(&in, v); err != nil {
+			return in, fmt.Errorf("assign: %w", err)
+		}
+		return in, nil
+	}
+
+	params, body, err := ParseRequest(req, options.MaxMemory)
+	if err != nil {
+		return in, err
+	}
+
+	m := map[string]any{}
+	for k, v := range headerToMapString(req.Header) {
+		m[k] = v
+	}
+	for k, v := range valuesToMap(req.URL.Query()) {
+		m[k] = v
+	}
+	if len(body) > 0 && IsJSON(req.Header) {
+		// JSON body is decoded directly, as it's more precise than assigning by names
+		if err = json.Unmarshal(body, &in); err != nil {
+			return in, fmt.Errorf("unmarshal json: %w", err)
+		}
+		// params are top level fields in body, which are not overwritten by headers or query
+		for k := range m {
+			for f := range params {
+				if xname.Check(k, f) {
+					delete(m, k)
+					break
+				}
+			}
+		}
+		params = map[string]any{}
+	}
+	for k, v := range params {
+		m[k] = v
+	}
+	for k, v := range pathParams {
+		m[k] = v
+	}
+	if err = xassign.Assign(&in, m); err != nil {
+		return in, fmt.Errorf("assign: %w", err)
+	}
+
+	if req.MultipartForm != nil && len(req.MultipartForm.File) > 0 {
+		bindFiles(&in, req.MultipartForm.File)
+	}
+	return in, nil
+}
+
+var (
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeaderSliceType = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+func bindFiles(dst any, files map[string][]*multipart.FileHeader) {
+	v := xruntime.IndirectWritableValue(reflect.ValueOf(dst), false)
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		ft := t.Field(i)
+		if !ft.IsExported() || (ft.Type != fileHeaderType && ft.Type != fileHeaderSliceType) {
+			continue
+		}
+		for name, fhs := range files {
+			if len(fhs) == 0 || !xname.Check(name, ft.Name) {
+				continue
+			}
+			if ft.Type == fileHeaderType {
+				v.Field(i).Set(reflect.ValueOf(fhs[0]))
+			} else {
+				v.Field(i).Set(reflect.ValueOf(fhs))
+			}
+			break
+		}
+	}
+}
+
+// getPathParams returns params in pattern, which is matched with the tail of path
+func getPathParams(pattern, path string) map[string]string {
+	if pattern == "" {
+		return nil
+	}
+	segments, paramIndexes := xurl.GetPathSegments(strings.TrimSuffix(pattern, "/"))
+	if len(paramIndexes) == 0 {
+		return nil
+	}
+	pathSegments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	offset := len(pathSegments) - len(segments)
+	if offset < 0 {
+		return nil
+	}
+	params := make(map[string]string, len(paramIndexes))
+	for _, i := range paramIndexes {
+		name := segments[i][1 : len(segments[i])-1]
+		params[name] = pathSegments[offset+i]
+	}
+	return params
+}
+
+func respondError(ctx context.Context, w http.ResponseWriter, err error) {
+	if e, ok := xerror.CauseOf[*xerror.Error](err); ok && e.Code >= 400 && e.Code < 600 {
+		e.Respond(ctx, w)
+		return
+	}
+
+	code := xerror.GetCode(err)
+	if code < 400 || code >= 600 {
+		code = http.StatusInternalServerError
+	}
+	e := &xerror.Error{
+		Code:    code,
+		Message: err.Error(),
+	}
+	if code >= 500 {
+		// unexpected errors may contain internal details, e.g. sql statements
+		log.Printf("xhttp.Handle: %v", err)
+		e.Message = http.StatusText(code)
+	}
+	e.Respond(ctx, w)
+}
+
+func respondResult[OUT any](ctx context.Context, w http.ResponseWriter, req *http.Request, out OUT) {
+	var body []byte
+	var contentType string
+	switch v := any(out).(type) {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case []byte:
+		body, contentType = v, OctetStream
+	case string:
+		body, contentType = []byte(v), PlainUTF8
+	default:
+		if val := reflect.ValueOf(out); val.Kind() == reflect.Struct && val.Type().NumField() == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var err error
+		if acceptsXML(req.Header) {
+			body, err = xml.Marshal(out)
+			contentType = XmlUTF8
+		} else {
+			body, err = json.Marshal(out)
+			contentType = JsonUTF8
+		}
+		if err != nil {
+			respondError(ctx, w, fmt.Errorf("marshal: %w", err))
+			return
+		}
+	}
+
+	w.Header().Set(KeyContentType, contentType)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Cannot write: %v", err)
+	}
+}
+
+// acceptsXML returns true if XML is preferred to JSON, regardless of quality values
+func acceptsXML(h http.Header) bool {
+	for _, a := range strings.Split(h.Get(KeyAccept), ",") {
+		t := strings.TrimSpace(strings.Split(a, ";")[0])
+		switch t {
+		case XML, XML2:
+			return true
+		case JSON, "*/*":
+			return false
+		}
+	}
+	return false
+}
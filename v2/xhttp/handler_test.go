@@ -0,0 +1,182 @@
+package xhttp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"code.olapie.com/sugar/v2/xerror"
+	"code.olapie.com/sugar/v2/xhttp"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+type updateUserInput struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	AppID   string `json:"app_id"`
+}
+
+func (u *updateUserInput) Validate() error {
+	if u.Name == "" {
+		return errors.New("name is empty")
+	}
+	return nil
+}
+
+type user struct {
+	ID   int64  `json:"id" xml:"id"`
+	Name string `json:"name" xml:"name"`
+}
+
+func TestHandle(t *testing.T) {
+	h := xhttp.Handle(func(ctx context.Context, in *updateUserInput) (*user, error) {
+		if in.ID == 0 {
+			return nil, xerror.NotFound("no user")
+		}
+		xtest.Equal(t, 3, in.Version)
+		xtest.Equal(t, "app", in.AppID)
+		return &user{ID: in.ID, Name: in.Name}, nil
+	}, func(options *xhttp.HandleOptions) {
+		options.Pattern = "/users/{id}"
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/api/users/10?version=3", strings.NewReader(`{"name":"tom"}`))
+		req.Header.Set(xhttp.KeyContentType, xhttp.JsonUTF8)
+		req.Header.Set(xhttp.KeyAppID, "app")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		xtest.Equal(t, http.StatusOK, w.Code)
+		xtest.Equal(t, xhttp.JsonUTF8, w.Header().Get(xhttp.KeyContentType))
+		xtest.Equal(t, `{"id":10,"name":"tom"}`, w.Body.String())
+	})
+
+	t.Run("JSONNotOverwritten", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/users/10?name=jim", strings.NewReader(`{"name":"tom","version":3}`))
+		req.Header.Set(xhttp.KeyContentType, xhttp.JSON)
+		req.Header.Set(xhttp.KeyAppID, "app")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		xtest.Equal(t, http.StatusOK, w.Code)
+		xtest.Equal(t, `{"id":10,"name":"tom"}`, w.Body.String())
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		h := xhttp.Handle(func(ctx context.Context, in *updateUserInput) (*user, error) {
+			return &user{ID: in.ID, Name: in.Name}, nil
+		}, func(options *xhttp.HandleOptions) {
+			options.MaxBodySize = 8
+		})
+		req := httptest.NewRequest(http.MethodPut, "/users/10", strings.NewReader(`{"name":"tom"}`))
+		req.Header.Set(xhttp.KeyContentType, xhttp.JSON)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		xtest.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("Form", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/users/10", strings.NewReader("name=tom&version=3"))
+		req.Header.Set(xhttp.KeyContentType, xhttp.FormURLEncoded)
+		req.Header.Set(xhttp.KeyAppID, "app")
+		req.Header.Set(xhttp.KeyAccept, xhttp.XML)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		xtest.Equal(t, http.StatusOK, w.Code)
+		xtest.Equal(t, xhttp.XmlUTF8, w.Header().Get(xhttp.KeyContentType))
+		xtest.Equal(t, `<user><id>10</id><name>tom</name></user>`, w.Body.String())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/users/10", strings.NewReader(`{}`))
+		req.Header.Set(xhttp.KeyContentType, xhttp.JSON)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		xtest.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/users/0", strings.NewReader(`{"name":"tom"}`))
+		req.Header.Set(xhttp.KeyContentType, xhttp.JSON)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		xtest.Equal(t, http.StatusNotFound, w.Code)
+		xtest.Equal(t, "no user", w.Body.String())
+	})
+}
+
+func TestHandle_Scalar(t *testing.T) {
+	h := xhttp.Handle(func(ctx context.Context, id int64) (struct{}, error) {
+		if id != 10 {
+			return struct{}{}, errors.New("unexpected id")
+		}
+		return struct{}{}, nil
+	}, func(options *xhttp.HandleOptions) {
+		options.Pattern = "/users/{id}"
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/users/10", nil))
+	xtest.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/users/11", nil))
+	xtest.Equal(t, http.StatusInternalServerError, w.Code)
+	xtest.Equal(t, http.StatusText(http.StatusInternalServerError), w.Body.String())
+}
+
+type uploadInput struct {
+	Title string
+	File  *multipart.FileHeader
+}
+
+func TestHandle_Multipart(t *testing.T) {
+	h := xhttp.Handle(func(ctx context.Context, in *uploadInput) (string, error) {
+		f, err := in.File.Open()
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		b, err := io.ReadAll(f)
+		return in.Title + ":" + string(b), err
+	})
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	xtest.NoError(t, mw.WriteField("title", "note"))
+	fw, err := mw.CreateFormFile("file", "note.txt")
+	xtest.NoError(t, err)
+	_, err = fw.Write([]byte("hello"))
+	xtest.NoError(t, err)
+	xtest.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set(xhttp.KeyContentType, mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	xtest.Equal(t, http.StatusOK, w.Code)
+	xtest.Equal(t, "note:hello", w.Body.String())
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	newMiddleware := func(name string) xhttp.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := xhttp.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	}), newMiddleware("a"), newMiddleware("b"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	xtest.Equal(t, []string{"a", "b", "handler"}, calls)
+}
@@ -11,6 +11,7 @@ import (
 
 const (
 	KeyAuthorization       = "Authorization"
+	KeyAccept              = "Accept"
 	KeyAcceptEncoding      = "Accept-Encoding"
 	KeyACLAllowCredentials = "Access-Control-Allow-Credentials"
 	KeyACLAllowHeaders     = "Access-Control-Allow-Headers"
@@ -28,6 +29,11 @@ const (
 	KeyWWWAuthenticate     = "WWW-Authenticate"
 	KeyAcceptLanguage      = "Accept-Language"
 	KeyETag                = "ETag"
+	KeyRetryAfter          = "Retry-After"
+	KeyIdempotencyKey      = "Idempotency-Key"
+	KeyRange               = "Range"
+	KeyContentRange        = "Content-Range"
+	KeyIfRange             = "If-Range"
 
 	KeyClientID  = "X-Client-Id"
 	KeyAppID     = "X-App-Id"
@@ -0,0 +1,771 @@
+package xhttp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.olapie.com/sugar/v2/base62"
+	"code.olapie.com/sugar/v2/xerror"
+	"code.olapie.com/sugar/v2/xtime"
+)
+
+// Headers of RFC 9421 HTTP Message Signatures and RFC 9530 Digest Fields
+const (
+	KeyContentDigest      = "Content-Digest"
+	KeyHTTPSignature      = "Signature"
+	KeyHTTPSignatureInput = "Signature-Input"
+)
+
+// Algorithms of HTTP Message Signatures
+const (
+	AlgEd25519         = "ed25519"
+	AlgECDSAP256SHA256 = "ecdsa-p256-sha256"
+	AlgECDSAP384SHA384 = "ecdsa-p384-sha384"
+	AlgRSAPSSSHA512    = "rsa-pss-sha512"
+	AlgRSAV15SHA256    = "rsa-v1_5-sha256"
+)
+
+// Rejection reasons of VerifyRequest and VerifyResponse, besides ErrInvalidSignature and ErrUnknownKey
+var (
+	ErrMissingMessageSignature   = xerror.Unauthorized("missing %s or %s", KeyHTTPSignature, KeyHTTPSignatureInput)
+	ErrMalformedMessageSignature = xerror.BadRequest("malformed %s or %s", KeyHTTPSignature, KeyHTTPSignatureInput)
+	ErrInvalidContentDigest      = xerror.BadRequest("invalid %s", KeyContentDigest)
+	ErrUncoveredComponent        = xerror.Unauthorized("required component is not signed")
+	ErrExpiredSignature          = xerror.Unauthorized("expired signature")
+)
+
+const defaultSignatureLabel = "sig1"
+
+type MessageSignOptions struct {
+	// Label is the name of signature in Signature-Input and Signature
+	Label string
+	KeyID string
+	// Components are derived components like @method, or lowercase header names, e.g. content-type.
+	// Content-Digest is computed if content-digest is a component.
+	// By default, requests are signed with @method, @authority, @path, @query,
+	// and responses are signed with @status, plus content-digest and content-type if there is body
+	Components []string
+	// Algorithm is required only by RSA keys to choose between AlgRSAPSSSHA512 (default) and AlgRSAV15SHA256
+	Algorithm string
+	// Expires is the lifetime of signature, which never expires if it's zero
+	Expires time.Duration
+	// Nonce adds a random nonce, which can be used to detect replayed requests
+	Nonce bool
+	Clock xtime.Clock
+}
+
+type MessageVerifyOptions struct {
+	// Label is the name of signature to verify
+	Label string
+	// RequiredComponents must be covered by signature.
+	// content-digest is always required if there is body
+	RequiredComponents []string
+	// MaxAge rejects signatures created earlier, and it's unlimited if it's zero
+	MaxAge time.Duration
+	Clock  xtime.Clock
+	// MaxBodySize limits size of body to be digested, which is 32 MiB by default. No limit if it's not positive
+	MaxBodySize int64
+	// KeyAlgorithm pins algorithm of the key, e.g. AlgRSAV15SHA256 for RSA keys.
+	// alg parameter of signature must be absent or the same as the pinned one.
+	// If it's nil or returns empty string, algorithm is determined by the key, e.g. AlgRSAPSSSHA512 for RSA keys
+	KeyAlgorithm func(keyID string) string
+}
+
+// PublicKeyFunc returns public key by keyid of signature, which is ed25519.PublicKey, *ecdsa.PublicKey or *rsa.PublicKey.
+// It returns nil if key is not found
+type PublicKeyFunc func(ctx context.Context, keyID string) (crypto.PublicKey, error)
+
+// SetContentDigest sets sha-256 Content-Digest of body
+func SetContentDigest(h http.Header, body []byte) {
+	sum := sha256.Sum256(body)
+	h.Set(KeyContentDigest, "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+}
+
+// CheckContentDigest checks sha-256 or sha-512 Content-Digest of body
+func CheckContentDigest(h http.Header, body []byte) error {
+	digests := parseDictionary(h.Get(KeyContentDigest))
+	if len(digests) == 0 {
+		return ErrInvalidContentDigest
+	}
+	for alg, v := range digests {
+		expected, err := decodeByteSequence(v)
+		if err != nil {
+			return ErrInvalidContentDigest
+		}
+		var sum []byte
+		switch alg {
+		case "sha-256":
+			s := sha256.Sum256(body)
+			sum = s[:]
+		case "sha-512":
+			s := sha512.Sum512(body)
+			sum = s[:]
+		default:
+			continue
+		}
+		if !bytes.Equal(sum, expected) {
+			return ErrInvalidContentDigest
+		}
+		return nil
+	}
+	return ErrInvalidContentDigest
+}
+
+// SignRequest signs req following RFC 9421 HTTP Message Signatures.
+// key can be ed25519.PrivateKey, *ecdsa.PrivateKey, *rsa.PrivateKey or any other crypto.Signer of these key types
+func SignRequest(req *http.Request, key crypto.Signer, optFns ...func(options *MessageSignOptions)) error {
+	body, err := readRequestBody(req, 0)
+	if err != nil {
+		return err
+	}
+	return signMessage(newRequestMessage(req), body, key, optFns)
+}
+
+// SignResponse signs resp, e.g. in ModifyResponse of httputil.ReverseProxy
+func SignResponse(resp *http.Response, key crypto.Signer, optFns ...func(options *MessageSignOptions)) error {
+	body, err := readResponseBody(resp, 0)
+	if err != nil {
+		return err
+	}
+	return signMessage(&httpMessage{status: resp.StatusCode, header: resp.Header}, body, key, optFns)
+}
+
+// NewMessageSigner returns a Signer which can be used by Caller
+func NewMessageSigner(key crypto.Signer, optFns ...func(options *MessageSignOptions)) Signer {
+	return SignerFunc(func(ctx context.Context, req *http.Request) error {
+		return SignRequest(req, key, optFns...)
+	})
+}
+
+// SignResponseMiddleware buffers responses of next handler, and signs them with key
+func SignResponseMiddleware(key crypto.Signer, optFns ...func(options *MessageSignOptions)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			bw := &bufferedResponseWriter{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(bw, req)
+			for k, v := range bw.header {
+				w.Header()[k] = v
+			}
+			body := bw.body.Bytes()
+			m := &httpMessage{status: bw.status, header: w.Header()}
+			if err := signMessage(m, body, key, optFns); err != nil {
+				respondError(req.Context(), w, fmt.Errorf("sign response: %w", err))
+				return
+			}
+			w.WriteHeader(bw.status)
+			if _, err := w.Write(body); err != nil {
+				log.Printf("Cannot write: %v", err)
+			}
+		})
+	}
+}
+
+// bufferedResponseWriter keeps response in memory, so that it can be signed before being sent
+type bufferedResponseWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(b)
+}
+
+// VerifyRequest verifies signature created by SignRequest, and returns keyid of the signature
+func VerifyRequest(req *http.Request, keyFn PublicKeyFunc, optFns ...func(options *MessageVerifyOptions)) (string, error) {
+	options := newMessageVerifyOptions(optFns)
+	body, err := readRequestBody(req, options.MaxBodySize)
+	if err != nil {
+		return "", err
+	}
+	return verifyMessage(req.Context(), newRequestMessage(req), body, keyFn, options)
+}
+
+// VerifyResponse verifies signature created by SignResponse or SignResponseMiddleware, and returns keyid of the signature
+func VerifyResponse(resp *http.Response, keyFn PublicKeyFunc, optFns ...func(options *MessageVerifyOptions)) (string, error) {
+	options := newMessageVerifyOptions(optFns)
+	body, err := readResponseBody(resp, options.MaxBodySize)
+	if err != nil {
+		return "", err
+	}
+	ctx := context.Background()
+	if resp.Request != nil {
+		ctx = resp.Request.Context()
+	}
+	return verifyMessage(ctx, &httpMessage{status: resp.StatusCode, header: resp.Header}, body, keyFn, options)
+}
+
+// httpMessage is a request if status is zero, otherwise it's a response
+type httpMessage struct {
+	method    string
+	scheme    string
+	authority string
+	path      string
+	query     string
+	target    string
+	status    int
+	header    http.Header
+}
+
+func newRequestMessage(req *http.Request) *httpMessage {
+	m := &httpMessage{
+		method:    req.Method,
+		scheme:    req.URL.Scheme,
+		authority: strings.ToLower(req.Host),
+		path:      req.URL.EscapedPath(),
+		query:     "?" + req.URL.RawQuery,
+		header:    req.Header,
+	}
+	if m.authority == "" {
+		m.authority = strings.ToLower(req.URL.Host)
+	}
+	if m.scheme == "" {
+		// server side request
+		m.scheme = "http"
+		if req.TLS != nil {
+			m.scheme = "https"
+		}
+	}
+	if m.path == "" {
+		m.path = "/"
+	}
+	m.target = m.path
+	if req.URL.RawQuery != "" {
+		m.target += m.query
+	}
+	return m
+}
+
+func (m *httpMessage) getComponent(name string) (string, error) {
+	var v string
+	switch name {
+	case "@method":
+		v = m.method
+	case "@target-uri":
+		v = m.scheme + "://" + m.authority + m.target
+	case "@authority":
+		v = m.authority
+	case "@scheme":
+		v = m.scheme
+	case "@request-target":
+		v = m.target
+	case "@path":
+		v = m.path
+	case "@query":
+		v = m.query
+	case "@status":
+		if m.status == 0 {
+			return "", fmt.Errorf("@status is not a request component")
+		}
+		return strconv.Itoa(m.status), nil
+	default:
+		if strings.HasPrefix(name, "@") || strings.ContainsAny(name, `;"`) {
+			return "", fmt.Errorf("unsupported component %s", name)
+		}
+		values := m.header.Values(name)
+		if len(values) == 0 {
+			return "", fmt.Errorf("missing header %s", name)
+		}
+		trimmed := make([]string, len(values))
+		for i, s := range values {
+			trimmed[i] = strings.TrimSpace(s)
+		}
+		return strings.Join(trimmed, ", "), nil
+	}
+	if m.status != 0 {
+		return "", fmt.Errorf("%s is not a response component", name)
+	}
+	return v, nil
+}
+
+func (m *httpMessage) defaultComponents(body []byte) []string {
+	var components []string
+	if m.status != 0 {
+		components = []string{"@status"}
+	} else {
+		components = []string{"@method", "@authority", "@path", "@query"}
+	}
+	if len(body) > 0 {
+		components = append(components, "content-digest")
+		if m.header.Get(KeyContentType) != "" {
+			components = append(components, "content-type")
+		}
+	}
+	return components
+}
+
+// signatureParams is the value of a signature in Signature-Input
+type signatureParams struct {
+	components []string
+	created    int64
+	expires    int64
+	nonce      string
+	keyID      string
+	alg        string
+}
+
+func (p *signatureParams) String() string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for i, c := range p.components {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(strconv.Quote(c))
+	}
+	b.WriteByte(')')
+	if p.created > 0 {
+		fmt.Fprintf(&b, ";created=%d", p.created)
+	}
+	if p.expires > 0 {
+		fmt.Fprintf(&b, ";expires=%d", p.expires)
+	}
+	if p.nonce != "" {
+		fmt.Fprintf(&b, ";nonce=%q", p.nonce)
+	}
+	if p.keyID != "" {
+		fmt.Fprintf(&b, ";keyid=%q", p.keyID)
+	}
+	if p.alg != "" {
+		fmt.Fprintf(&b, ";alg=%q", p.alg)
+	}
+	return b.String()
+}
+
+func parseSignatureParams(s string) (*signatureParams, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") {
+		return nil, ErrMalformedMessageSignature
+	}
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, ErrMalformedMessageSignature
+	}
+	p := new(signatureParams)
+	for _, c := range strings.Fields(s[1:end]) {
+		name, err := strconv.Unquote(c)
+		if err != nil {
+			return nil, ErrMalformedMessageSignature
+		}
+		p.components = append(p.components, name)
+	}
+
+	for _, param := range splitOutsideQuotes(s[end+1:], ';') {
+		param = strings.TrimSpace(param)
+		if param == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(param, "=")
+		var err error
+		switch k {
+		case "created":
+			p.created, err = strconv.ParseInt(v, 10, 64)
+		case "expires":
+			p.expires, err = strconv.ParseInt(v, 10, 64)
+		case "nonce":
+			p.nonce, err = strconv.Unquote(v)
+		case "keyid":
+			p.keyID, err = strconv.Unquote(v)
+		case "alg":
+			p.alg, err = strconv.Unquote(v)
+		}
+		if err != nil {
+			return nil, ErrMalformedMessageSignature
+		}
+	}
+	return p, nil
+}
+
+func (m *httpMessage) getSignatureBase(p *signatureParams, rawParams string) ([]byte, error) {
+	var b bytes.Buffer
+	for _, c := range p.components {
+		v, err := m.getComponent(c)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "%q: %s\n", c, v)
+	}
+	fmt.Fprintf(&b, "%q: %s", "@signature-params", rawParams)
+	return b.Bytes(), nil
+}
+
+func signMessage(m *httpMessage, body []byte, key crypto.Signer, optFns []func(options *MessageSignOptions)) error {
+	options := &MessageSignOptions{
+		Label: defaultSignatureLabel,
+		Clock: xtime.LocalClock{},
+	}
+	for _, fn := range optFns {
+		fn(options)
+	}
+	if options.Components == nil {
+		options.Components = m.defaultComponents(body)
+	}
+
+	alg, err := getSigningAlgorithm(key.Public(), options.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	now := options.Clock.Now()
+	p := &signatureParams{
+		components: options.Components,
+		created:    now.Unix(),
+		keyID:      options.KeyID,
+		alg:        alg,
+	}
+	if options.Expires > 0 {
+		p.expires = now.Add(options.Expires).Unix()
+	}
+	if options.Nonce {
+		p.nonce = base62.NewUUIDString()
+	}
+
+	for _, c := range p.components {
+		if c == "content-digest" {
+			SetContentDigest(m.header, body)
+			break
+		}
+	}
+
+	rawParams := p.String()
+	base, err := m.getSignatureBase(p, rawParams)
+	if err != nil {
+		return err
+	}
+	sign, err := signBase(key, alg, base)
+	if err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+	m.header.Set(KeyHTTPSignatureInput, options.Label+"="+rawParams)
+	m.header.Set(KeyHTTPSignature, options.Label+"=:"+base64.StdEncoding.EncodeToString(sign)+":")
+	return nil
+}
+
+func newMessageVerifyOptions(optFns []func(options *MessageVerifyOptions)) *MessageVerifyOptions {
+	options := &MessageVerifyOptions{
+		Label:       defaultSignatureLabel,
+		Clock:       xtime.LocalClock{},
+		MaxBodySize: 32 << 20,
+	}
+	for _, fn := range optFns {
+		fn(options)
+	}
+	return options
+}
+
+func verifyMessage(ctx context.Context, m *httpMessage, body []byte, keyFn PublicKeyFunc, options *MessageVerifyOptions) (string, error) {
+	rawParams, ok := parseDictionary(m.header.Get(KeyHTTPSignatureInput))[options.Label]
+	if !ok {
+		return "", ErrMissingMessageSignature
+	}
+	rawSign, ok := parseDictionary(m.header.Get(KeyHTTPSignature))[options.Label]
+	if !ok {
+		return "", ErrMissingMessageSignature
+	}
+	sign, err := decodeByteSequence(rawSign)
+	if err != nil {
+		return "", ErrMalformedMessageSignature
+	}
+	p, err := parseSignatureParams(rawParams)
+	if err != nil {
+		return "", err
+	}
+
+	required := options.RequiredComponents
+	if len(body) > 0 {
+		required = append(required[:len(required):len(required)], "content-digest")
+	}
+	for _, c := range required {
+		if !containsString(p.components, c) {
+			return "", ErrUncoveredComponent
+		}
+	}
+
+	now := options.Clock.Now().Unix()
+	if p.expires > 0 && now > p.expires {
+		return "", ErrExpiredSignature
+	}
+	if options.MaxAge > 0 && now-p.created > int64(options.MaxAge/time.Second) {
+		return "", ErrExpiredSignature
+	}
+
+	pub, err := keyFn(ctx, p.keyID)
+	if err != nil {
+		return "", err
+	}
+	if pub == nil {
+		return "", ErrUnknownKey
+	}
+
+	base, err := m.getSignatureBase(p, rawParams)
+	if err != nil {
+		return "", ErrUncoveredComponent
+	}
+	var pinnedAlg string
+	if options.KeyAlgorithm != nil {
+		pinnedAlg = options.KeyAlgorithm(p.keyID)
+	}
+	if err = verifyBase(pub, pinnedAlg, p.alg, base, sign); err != nil {
+		return "", err
+	}
+
+	if containsString(p.components, "content-digest") {
+		if err = CheckContentDigest(m.header, body); err != nil {
+			return "", err
+		}
+	}
+	return p.keyID, nil
+}
+
+func getSigningAlgorithm(pub crypto.PublicKey, alg string) (string, error) {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return AlgEd25519, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return AlgECDSAP256SHA256, nil
+		case elliptic.P384():
+			return AlgECDSAP384SHA384, nil
+		default:
+			return "", fmt.Errorf("unsupported curve %s", k.Curve.Params().Name)
+		}
+	case *rsa.PublicKey:
+		switch alg {
+		case "", AlgRSAPSSSHA512:
+			return AlgRSAPSSSHA512, nil
+		case AlgRSAV15SHA256:
+			return alg, nil
+		default:
+			return "", fmt.Errorf("unsupported rsa algorithm %s", alg)
+		}
+	default:
+		return "", fmt.Errorf("unsupported key %T", pub)
+	}
+}
+
+func signBase(key crypto.Signer, alg string, base []byte) ([]byte, error) {
+	switch alg {
+	case AlgEd25519:
+		return key.Sign(rand.Reader, base, crypto.Hash(0))
+	case AlgECDSAP256SHA256, AlgECDSAP384SHA384:
+		hash, size := crypto.SHA256, 32
+		if alg == AlgECDSAP384SHA384 {
+			hash, size = crypto.SHA384, 48
+		}
+		h := hash.New()
+		h.Write(base)
+		der, err := key.Sign(rand.Reader, h.Sum(nil), hash)
+		if err != nil {
+			return nil, err
+		}
+		// RFC 9421 requires concatenated r and s instead of ASN.1
+		var sig struct{ R, S *big.Int }
+		if _, err = asn1.Unmarshal(der, &sig); err != nil {
+			return nil, fmt.Errorf("unmarshal ecdsa signature: %w", err)
+		}
+		b := make([]byte, 2*size)
+		sig.R.FillBytes(b[:size])
+		sig.S.FillBytes(b[size:])
+		return b, nil
+	case AlgRSAPSSSHA512:
+		h := sha512.Sum512(base)
+		return key.Sign(rand.Reader, h[:], &rsa.PSSOptions{SaltLength: 64, Hash: crypto.SHA512})
+	case AlgRSAV15SHA256:
+		h := sha256.Sum256(base)
+		return key.Sign(rand.Reader, h[:], crypto.SHA256)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %s", alg)
+	}
+}
+
+// verifyBase verifies sign with pinnedAlg or the default algorithm of pub, which must match signedAlg if it's not empty.
+// signedAlg is never used directly, otherwise the same RSA key could be verified with different algorithms
+func verifyBase(pub crypto.PublicKey, pinnedAlg, signedAlg string, base, sign []byte) error {
+	alg, err := getSigningAlgorithm(pub, pinnedAlg)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if signedAlg != "" && signedAlg != alg {
+		return ErrInvalidSignature
+	}
+	var ok bool
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		ok = alg == AlgEd25519 && ed25519.Verify(k, base, sign)
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch {
+		case alg == AlgECDSAP256SHA256 && k.Curve == elliptic.P256():
+			h := sha256.Sum256(base)
+			digest = h[:]
+		case alg == AlgECDSAP384SHA384 && k.Curve == elliptic.P384():
+			h := sha512.Sum384(base)
+			digest = h[:]
+		}
+		if digest != nil && len(sign)%2 == 0 {
+			r := new(big.Int).SetBytes(sign[:len(sign)/2])
+			s := new(big.Int).SetBytes(sign[len(sign)/2:])
+			ok = ecdsa.Verify(k, digest, r, s)
+		}
+	case *rsa.PublicKey:
+		switch alg {
+		case AlgRSAPSSSHA512:
+			h := sha512.Sum512(base)
+			ok = rsa.VerifyPSS(k, crypto.SHA512, h[:], sign, &rsa.PSSOptions{SaltLength: 64, Hash: crypto.SHA512}) == nil
+		case AlgRSAV15SHA256:
+			h := sha256.Sum256(base)
+			ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sign) == nil
+		}
+	default:
+		return xerror.InternalServerError("unsupported public key %T", pub)
+	}
+	if !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// readRequestBody reads body and resets it, so that it can be read again.
+// Body is not limited if maxSize is not positive
+func readRequestBody(req *http.Request, maxSize int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("get body: %w", err)
+		}
+		defer body.Close()
+		return readBody(body, maxSize)
+	}
+	b, err := readBody(req.Body, maxSize)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	return b, nil
+}
+
+func readResponseBody(resp *http.Response, maxSize int64) ([]byte, error) {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return nil, nil
+	}
+	b, err := readBody(resp.Body, maxSize)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+func readBody(r io.Reader, maxSize int64) ([]byte, error) {
+	if maxSize <= 0 {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("read body: %w", err)
+		}
+		return b, nil
+	}
+	b, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if int64(len(b)) > maxSize {
+		return nil, xerror.RequestEntityTooLarge("body exceeds %d bytes", maxSize)
+	}
+	return b, nil
+}
+
+// parseDictionary parses members of structured field dictionary, whose values are kept as they are
+func parseDictionary(s string) map[string]string {
+	m := make(map[string]string)
+	for _, member := range splitOutsideQuotes(s, ',') {
+		k, v, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if ok && k != "" {
+			m[k] = strings.TrimSpace(v)
+		}
+	}
+	return m
+}
+
+// splitOutsideQuotes splits s by sep which is not in quoted strings or inner lists
+func splitOutsideQuotes(s string, sep byte) []string {
+	var items []string
+	var quoted, escaped bool
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// decodeByteSequence decodes structured field byte sequence, e.g. :aGVsbG8=:
+func decodeByteSequence(s string) ([]byte, error) {
+	if len(s) < 2 || s[0] != ':' || s[len(s)-1] != ':' {
+		return nil, fmt.Errorf("invalid byte sequence %s", s)
+	}
+	return base64.StdEncoding.DecodeString(s[1 : len(s)-1])
+}
+
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
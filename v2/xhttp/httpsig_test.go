@@ -0,0 +1,187 @@
+package xhttp_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"code.olapie.com/sugar/v2/xerror"
+	"code.olapie.com/sugar/v2/xhttp"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+func TestContentDigest(t *testing.T) {
+	h := http.Header{}
+	xhttp.SetContentDigest(h, []byte(`{"hello": "world"}`))
+	// example of RFC 9530
+	xtest.Equal(t, "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:", h.Get(xhttp.KeyContentDigest))
+	xtest.NoError(t, xhttp.CheckContentDigest(h, []byte(`{"hello": "world"}`)))
+	xtest.Error(t, xhttp.CheckContentDigest(h, []byte(`{"hello": "world!"}`)))
+}
+
+func TestSignRequest(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	xtest.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	xtest.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	xtest.NoError(t, err)
+
+	keys := map[string]crypto.Signer{
+		xhttp.AlgEd25519:         edKey,
+		xhttp.AlgECDSAP256SHA256: ecKey,
+		xhttp.AlgRSAPSSSHA512:    rsaKey,
+	}
+	keyFn := func(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+		if k, ok := keys[keyID]; ok {
+			return k.Public(), nil
+		}
+		return nil, nil
+	}
+
+	for alg, key := range keys {
+		t.Run(alg, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "https://example.com/users?active=1", strings.NewReader(`{"name":"tom"}`))
+			req.Header.Set(xhttp.KeyContentType, xhttp.JSON)
+			xtest.NoError(t, xhttp.SignRequest(req, key, func(options *xhttp.MessageSignOptions) {
+				options.KeyID = alg
+			}))
+			xtest.True(t, strings.Contains(req.Header.Get(xhttp.KeyHTTPSignatureInput), `alg="`+alg+`"`))
+
+			keyID, err := xhttp.VerifyRequest(req, keyFn)
+			xtest.NoError(t, err)
+			xtest.Equal(t, alg, keyID)
+
+			// body can still be read by handler
+			body, err := io.ReadAll(req.Body)
+			xtest.NoError(t, err)
+			xtest.Equal(t, `{"name":"tom"}`, string(body))
+		})
+	}
+
+	newRequest := func(t *testing.T) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "https://example.com/users", strings.NewReader(`{"name":"tom"}`))
+		req.Header.Set(xhttp.KeyContentType, xhttp.JSON)
+		xtest.NoError(t, xhttp.SignRequest(req, edKey, func(options *xhttp.MessageSignOptions) {
+			options.KeyID = xhttp.AlgEd25519
+			options.Expires = time.Minute
+		}))
+		return req
+	}
+
+	t.Run("TamperedBody", func(t *testing.T) {
+		req := newRequest(t)
+		req.Body = io.NopCloser(strings.NewReader(`{"name":"jerry"}`))
+		req.GetBody = nil
+		_, err := xhttp.VerifyRequest(req, keyFn)
+		xtest.True(t, errors.Is(err, xhttp.ErrInvalidContentDigest), err)
+	})
+
+	t.Run("TamperedPath", func(t *testing.T) {
+		req := newRequest(t)
+		req.URL.Path = "/admins"
+		_, err := xhttp.VerifyRequest(req, keyFn)
+		xtest.True(t, errors.Is(err, xhttp.ErrInvalidSignature), err)
+	})
+
+	t.Run("UncoveredBody", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "https://example.com/users", strings.NewReader(`{"name":"tom"}`))
+		xtest.NoError(t, xhttp.SignRequest(req, edKey, func(options *xhttp.MessageSignOptions) {
+			options.KeyID = xhttp.AlgEd25519
+			options.Components = []string{"@method", "@path"}
+		}))
+		_, err := xhttp.VerifyRequest(req, keyFn)
+		xtest.True(t, errors.Is(err, xhttp.ErrUncoveredComponent), err)
+	})
+
+	t.Run("PinnedAlgorithm", func(t *testing.T) {
+		newRSARequest := func(t *testing.T, alg string) *http.Request {
+			req := httptest.NewRequest(http.MethodGet, "https://example.com/users", nil)
+			xtest.NoError(t, xhttp.SignRequest(req, rsaKey, func(options *xhttp.MessageSignOptions) {
+				options.KeyID = xhttp.AlgRSAPSSSHA512
+				options.Algorithm = alg
+			}))
+			return req
+		}
+		pinV15 := func(options *xhttp.MessageVerifyOptions) {
+			options.KeyAlgorithm = func(keyID string) string {
+				return xhttp.AlgRSAV15SHA256
+			}
+		}
+
+		_, err := xhttp.VerifyRequest(newRSARequest(t, xhttp.AlgRSAV15SHA256), keyFn)
+		xtest.True(t, errors.Is(err, xhttp.ErrInvalidSignature), err)
+		_, err = xhttp.VerifyRequest(newRSARequest(t, xhttp.AlgRSAV15SHA256), keyFn, pinV15)
+		xtest.NoError(t, err)
+		_, err = xhttp.VerifyRequest(newRSARequest(t, xhttp.AlgRSAPSSSHA512), keyFn, pinV15)
+		xtest.True(t, errors.Is(err, xhttp.ErrInvalidSignature), err)
+	})
+
+	t.Run("BodyTooLarge", func(t *testing.T) {
+		req := newRequest(t)
+		req.GetBody = nil
+		_, err := xhttp.VerifyRequest(req, keyFn, func(options *xhttp.MessageVerifyOptions) {
+			options.MaxBodySize = 8
+		})
+		xtest.Equal(t, http.StatusRequestEntityTooLarge, xerror.GetCode(err))
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		req := newRequest(t)
+		_, err := xhttp.VerifyRequest(req, keyFn, func(options *xhttp.MessageVerifyOptions) {
+			options.Clock = &testClock{now: time.Now().Add(2 * time.Minute)}
+		})
+		xtest.True(t, errors.Is(err, xhttp.ErrExpiredSignature), err)
+	})
+}
+
+func TestSignResponseMiddleware(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	xtest.NoError(t, err)
+	server := httptest.NewServer(xhttp.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyID, err := xhttp.VerifyRequest(r, func(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+			return pub, nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set(xhttp.KeyContentType, xhttp.PlainUTF8)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello " + keyID))
+	}), xhttp.SignResponseMiddleware(priv, func(options *xhttp.MessageSignOptions) {
+		options.KeyID = "server"
+	})))
+	defer server.Close()
+
+	signer := xhttp.NewMessageSigner(priv, func(options *xhttp.MessageSignOptions) {
+		options.KeyID = "client"
+	})
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/greetings", strings.NewReader("hi"))
+	xtest.NoError(t, err)
+	xtest.NoError(t, signer.Sign(context.Background(), req))
+	resp, err := http.DefaultClient.Do(req)
+	xtest.NoError(t, err)
+	defer resp.Body.Close()
+	xtest.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	keyID, err := xhttp.VerifyResponse(resp, func(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+		return pub, nil
+	})
+	xtest.NoError(t, err)
+	xtest.Equal(t, "server", keyID)
+	body, err := io.ReadAll(resp.Body)
+	xtest.NoError(t, err)
+	xtest.Equal(t, "hello client", string(body))
+}
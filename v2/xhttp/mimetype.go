@@ -88,7 +88,7 @@ func IsJSON[T string | http.Header](typeOrHeader T) bool {
 			return false
 		}
 	case http.Header:
-		return IsXML(GetContentType(v))
+		return IsJSON(GetContentType(v))
 	default:
 		return false
 	}
@@ -0,0 +1,144 @@
+package xhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy retries requests which fail with network errors, 429, 502, 503 or 504.
+// Only idempotent requests are retried by default, i.e. GET, HEAD, OPTIONS, TRACE, PUT, DELETE,
+// and requests with Idempotency-Key header
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry, which is doubled before the next retry
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// RetryNonIdempotent retries requests of all methods, e.g. POST
+	RetryNonIdempotent bool
+	// Retryable overrides the default check of response and error
+	Retryable func(resp *http.Response, err error) bool
+}
+
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  200 * time.Millisecond,
+		MaxBackoff:  10 * time.Second,
+	}
+}
+
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+func IsIdempotent(req *http.Request) bool {
+	return idempotentMethods[req.Method] || req.Header.Get(KeyIdempotencyKey) != ""
+}
+
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// shouldRetry returns true if req can be sent again after attempt
+func (p *RetryPolicy) shouldRetry(attempt int, req *http.Request, resp *http.Response, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts || req.Context().Err() != nil {
+		return false
+	}
+	// body can't be read again
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if !p.RetryNonIdempotent && !IsIdempotent(req) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(resp, err)
+	}
+	return isRetryable(resp, err)
+}
+
+// getDelay returns delay before the next attempt, which is Retry-After of 429 or 503 if it's available.
+// It returns false if Retry-After is longer than MaxBackoff, then the response is returned without retry
+func (p *RetryPolicy) getDelay(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if d, ok := parseRetryAfter(resp.Header.Get(KeyRetryAfter)); ok {
+			if p.MaxBackoff > 0 && d > p.MaxBackoff {
+				return 0, false
+			}
+			return d, true
+		}
+	}
+
+	d := p.MinBackoff << (attempt - 1)
+	if d <= 0 || (p.MaxBackoff > 0 && d > p.MaxBackoff) {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0, true
+	}
+	// jitter spreads retries of clients which failed at the same time
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)), true
+}
+
+// parseRetryAfter parses delay in seconds or http date
+func parseRetryAfter(s string) (time.Duration, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n < 0 {
+			return 0, false
+		}
+		return time.Duration(n) * time.Second, true
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// discardResponse releases connection of response which is not used
+func discardResponse(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+}
@@ -0,0 +1,159 @@
+package xhttp_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code.olapie.com/sugar/v2/xerror"
+	"code.olapie.com/sugar/v2/xhttp"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+func newTestRetryPolicy() *xhttp.RetryPolicy {
+	p := xhttp.NewRetryPolicy()
+	p.MinBackoff = time.Millisecond
+	p.MaxBackoff = 5 * time.Millisecond
+	return p
+}
+
+func TestCaller_Retry(t *testing.T) {
+	t.Run("RetryGet", func(t *testing.T) {
+		var count atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if count.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		c := xhttp.NewGet[any, string](server.URL)
+		c.Retry = newTestRetryPolicy()
+		res, err := c.Call(context.Background(), nil)
+		xtest.NoError(t, err)
+		xtest.Equal(t, "ok", res)
+		xtest.Equal(t, int32(3), count.Load())
+	})
+
+	t.Run("MaxAttempts", func(t *testing.T) {
+		var count atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		c := xhttp.NewGet[any, string](server.URL)
+		c.Retry = newTestRetryPolicy()
+		_, err := c.Call(context.Background(), nil)
+		xtest.Error(t, err)
+		xtest.Equal(t, int32(3), count.Load())
+	})
+
+	t.Run("NoRetryPost", func(t *testing.T) {
+		var count atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		c := xhttp.NewPost[[]byte, string](server.URL)
+		c.Retry = newTestRetryPolicy()
+		_, err := c.Call(context.Background(), []byte("hello"))
+		xtest.Error(t, err)
+		xtest.Equal(t, int32(1), count.Load())
+	})
+
+	t.Run("RetryNonIdempotent", func(t *testing.T) {
+		var count atomic.Int32
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(b))
+			if count.Add(1) < 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}))
+		defer server.Close()
+
+		c := xhttp.NewPost[[]byte, struct{}](server.URL)
+		c.Retry = newTestRetryPolicy()
+		c.Retry.RetryNonIdempotent = true
+		_, err := c.Call(context.Background(), []byte("hello"))
+		xtest.NoError(t, err)
+		xtest.Equal(t, []string{"hello", "hello"}, bodies)
+	})
+
+	t.Run("RetryAfter", func(t *testing.T) {
+		var count atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if count.Add(1) < 2 {
+				w.Header().Set(xhttp.KeyRetryAfter, "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		}))
+		defer server.Close()
+
+		c := xhttp.NewGet[any, struct{}](server.URL)
+		c.Retry = newTestRetryPolicy()
+		c.Retry.MaxBackoff = 2 * time.Second
+		start := time.Now()
+		_, err := c.Call(context.Background(), nil)
+		xtest.NoError(t, err)
+		xtest.True(t, time.Since(start) >= time.Second)
+	})
+
+	t.Run("RetryAfterTooLong", func(t *testing.T) {
+		var count atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count.Add(1)
+			w.Header().Set(xhttp.KeyRetryAfter, "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		c := xhttp.NewGet[any, struct{}](server.URL)
+		c.Retry = newTestRetryPolicy()
+		start := time.Now()
+		_, err := c.Call(context.Background(), nil)
+		xtest.Error(t, err)
+		xtest.Equal(t, http.StatusTooManyRequests, xerror.GetCode(err))
+		xtest.Equal(t, int32(1), count.Load())
+		xtest.True(t, time.Since(start) < time.Second)
+	})
+
+	t.Run("SignEveryAttempt", func(t *testing.T) {
+		var count atomic.Int32
+		var signatures []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			signatures = append(signatures, r.Header.Get(xhttp.KeySignature))
+			if count.Add(1) < 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}))
+		defer server.Close()
+
+		var signed int
+		c := xhttp.NewGet[any, struct{}](server.URL)
+		c.Retry = newTestRetryPolicy()
+		c.Signer = xhttp.SignerFunc(func(ctx context.Context, req *http.Request) error {
+			signed++
+			xtest.Equal(t, "", req.Header.Get(xhttp.KeySignature))
+			req.Header.Set(xhttp.KeySignature, string(rune('0'+signed)))
+			return nil
+		})
+		_, err := c.Call(context.Background(), nil)
+		xtest.NoError(t, err)
+		xtest.Equal(t, []string{"1", "2"}, signatures)
+	})
+}
@@ -13,7 +13,6 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
-	"strconv"
 	"time"
 
 	"code.olapie.com/sugar/v2/base62"
@@ -24,10 +23,21 @@ import (
 )
 
 const (
-	KeyTimestamp = "X-Timestamp"
-	KeySignature = "X-Signature"
+	KeyTimestamp   = "X-Timestamp"
+	KeySignature   = "X-Signature"
+	KeySignVersion = "X-Sign-Version"
 )
 
+// SignVersion is set as X-Sign-Version by Sign with SignOptions.SignIdentity, which means X-User-Id, X-App-Id and X-Client-Id are signed.
+// Signatures without it only cover method, path, query, trace id and timestamp
+const SignVersion = "2"
+
+type SignOptions struct {
+	// SignIdentity signs X-User-Id, X-App-Id and X-Client-Id with X-Sign-Version, so that VerifyMiddleware trusts user id.
+	// It's false by default, as such signatures can't be verified by old servers
+	SignIdentity bool
+}
+
 type Signer interface {
 	Sign(ctx context.Context, req *http.Request) error
 }
@@ -42,7 +52,12 @@ type PrivateKey interface {
 	ecdsa.PrivateKey | rsa.PrivateKey
 }
 
-func Sign[K PrivateKey](ctx context.Context, req *http.Request, priv *K) error {
+func Sign[K PrivateKey](ctx context.Context, req *http.Request, priv *K, optFns ...func(options *SignOptions)) error {
+	options := new(SignOptions)
+	for _, fn := range optFns {
+		fn(options)
+	}
+
 	if xcontext.HasLogin(ctx) {
 		if login := xcontext.GetLogin[string](ctx); login != "" {
 			SetHeaderNX(req.Header, KeyUserID, login)
@@ -58,6 +73,11 @@ func Sign[K PrivateKey](ctx context.Context, req *http.Request, priv *K) error {
 	}
 	SetHeaderNX(req.Header, KeyTraceID, traceID)
 	SetHeaderNX(req.Header, KeyTimestamp, fmt.Sprint(time.Now().Unix()))
+	if options.SignIdentity {
+		req.Header.Set(KeySignVersion, SignVersion)
+	} else {
+		req.Header.Del(KeySignVersion)
+	}
 
 	hash := getMessageHashForSigning(req)
 	var sign []byte
@@ -79,9 +99,9 @@ func Sign[K PrivateKey](ctx context.Context, req *http.Request, priv *K) error {
 	return nil
 }
 
-func GetSigner[K PrivateKey](priv *K) Signer {
+func GetSigner[K PrivateKey](priv *K, optFns ...func(options *SignOptions)) Signer {
 	return SignerFunc(func(ctx context.Context, req *http.Request) error {
-		return Sign(ctx, req, priv)
+		return Sign(ctx, req, priv, optFns...)
 	})
 }
 
@@ -99,47 +119,13 @@ type PublicKey interface {
 	ecdsa.PublicKey | rsa.PublicKey
 }
 
+// Verify checks signature created by Sign, which must be within 5 seconds.
+// Use VerifyMiddleware to get rejection reasons and replay protection
 func Verify[K PublicKey](ctx context.Context, req *http.Request, pub *K) bool {
-	ts := req.Header.Get(KeyTimestamp)
-	if ts == "" {
-		fmt.Printf("[sugar/v2/xhttp] missing %s in header\n", KeyTimestamp)
-	}
-	t, err := strconv.ParseInt(ts, 0, 64)
-	if err != nil {
-		fmt.Printf("[sugar/v2/xhttp] strconv.ParseInt: %s, %v\n", ts, err)
-		return false
-	}
-
-	if time.Now().Unix()-t > 5 {
-		fmt.Printf("[sugar/v2/xhttp] outdated timestamp %s in header\n", ts)
-		return false
-	}
-
-	signature := req.Header.Get(KeySignature)
-	sign, err := base64.StdEncoding.DecodeString(signature)
-	if err != nil {
-		fmt.Printf("[sugar/v2/xhttp] base64.DecodeString: %s, %v\n", signature, err)
-		return false
-	}
-	hash := getMessageHashForSigning(req)
-	switch k := any(pub).(type) {
-	case *ecdsa.PublicKey:
-		verified := ecdsa.VerifyASN1(k, hash, sign)
-		if !verified {
-			fmt.Printf("[sugar/v2/xhttp] failed verifying: %s\n", signature)
-		}
-		return verified
-	case *rsa.PublicKey:
-		err = rsa.VerifyPKCS1v15(k, crypto.SHA256, hash, sign)
-		if err != nil {
-			fmt.Printf("[sugar/v2/xhttp] failed verifying: %s, %v\n", signature, err)
-			return false
-		}
-		return true
-	default:
-		fmt.Printf("[sugar/v2/xhttp] unsupported pub key: %T", pub)
+	if err := checkTimestamp(req.Header, time.Now(), 5*time.Second); err != nil {
 		return false
 	}
+	return verifySignature(req, any(pub)) == nil
 }
 
 func GetVerifier[K PublicKey](pub *K) Verifier {
@@ -159,10 +145,21 @@ func getMessageHashForSigning(req *http.Request) []byte {
 	buf.WriteString(req.URL.RawQuery)
 	buf.WriteString(GetHeader(req.Header, KeyTraceID))
 	buf.WriteString(GetHeader(req.Header, KeyTimestamp))
+	if isIdentitySigned(req.Header) {
+		// identities are separated, so that they can't be shifted from one to another
+		for _, k := range []string{KeyUserID, KeyAppID, KeyClientID} {
+			buf.WriteByte('\n')
+			buf.WriteString(req.Header.Get(k))
+		}
+	}
 	hash := md5.Sum(buf.Bytes())
 	return hash[:]
 }
 
+func isIdentitySigned(h http.Header) bool {
+	return h.Get(KeySignVersion) == SignVersion
+}
+
 func CheckTimestamp[H Headerxtypeet](h H) error {
 	ts := GetHeader(h, KeyTimestamp)
 	if ts == "" {
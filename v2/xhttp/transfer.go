@@ -0,0 +1,316 @@
+package xhttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"code.olapie.com/sugar/v2/xerror"
+	"github.com/google/uuid"
+)
+
+const ErrContentChanged xerror.String = "content has been changed"
+
+// ProgressFunc reports transferred bytes, and total is -1 if it's unknown
+type ProgressFunc func(transferred, total int64)
+
+type progressReader struct {
+	io.ReadCloser
+	transferred int64
+	total       int64
+	fn          ProgressFunc
+}
+
+func newProgressReader(r io.ReadCloser, total int64, fn ProgressFunc) *progressReader {
+	if total <= 0 {
+		total = -1
+	}
+	return &progressReader{ReadCloser: r, total: total, fn: fn}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.transferred += int64(n)
+		r.fn(r.transferred, r.total)
+	}
+	return n, err
+}
+
+type progressWriter struct {
+	w           io.Writer
+	transferred int64
+	total       int64
+	fn          ProgressFunc
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if n > 0 {
+		w.transferred += int64(n)
+		if w.fn != nil {
+			w.fn(w.transferred, w.total)
+		}
+	}
+	return n, err
+}
+
+// FilePart is a file of multipart form, which can be used as input of Caller
+type FilePart struct {
+	// FieldName is "file" by default
+	FieldName string
+	FileName  string
+	// ContentType is application/octet-stream by default
+	ContentType string
+	Body        io.Reader
+}
+
+// MultipartForm can be used as input of Caller, which is streamed instead of being buffered in memory
+type MultipartForm struct {
+	Fields url.Values
+	Files  []*FilePart
+}
+
+func (f *MultipartForm) newReader() (io.ReadCloser, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		// pr is closed by client after request is sent or failed, which stops writing
+		pw.CloseWithError(f.write(mw))
+	}()
+	return pr, mw.FormDataContentType()
+}
+
+func (f *MultipartForm) write(mw *multipart.Writer) error {
+	for k, values := range f.Fields {
+		for _, v := range values {
+			if err := mw.WriteField(k, v); err != nil {
+				return fmt.Errorf("write field %s: %w", k, err)
+			}
+		}
+	}
+
+	for _, file := range f.Files {
+		fieldName := file.FieldName
+		if fieldName == "" {
+			fieldName = "file"
+		}
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = OctetStream
+		}
+		h := make(textproto.MIMEHeader)
+		h.Set(KeyContentDisposition, fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escapeQuotes(fieldName), escapeQuotes(file.FileName)))
+		h.Set(KeyContentType, contentType)
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			return fmt.Errorf("create part %s: %w", fieldName, err)
+		}
+		if _, err = io.Copy(part, file.Body); err != nil {
+			return fmt.Errorf("copy %s: %w", file.FileName, err)
+		}
+	}
+	return mw.Close()
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+type UploadOptions struct {
+	// ChunkSize is the max size of every request
+	ChunkSize int64
+	// Offset resumes uploading from the offset, which has been received by server
+	Offset int64
+	// OnProgress reports bytes of the whole content. It's UploadProgress of Caller by default
+	OnProgress ProgressFunc
+}
+
+// maxUploadStalls is the max number of successive chunks which don't move offset forward
+const maxUploadStalls = 3
+
+// Upload sends content of r in chunks with Content-Range header, e.g. bytes 0-1023/4096.
+// Server responds 308 (Resume Incomplete) or 2xx before the last chunk, optionally with Range header of received bytes, e.g. bytes=0-1023.
+// Uploading continues after the end of Range, which may rewind to resend lost bytes.
+// Without Range header, nothing of the chunk is considered received for 308, and the whole chunk for 2xx.
+// The response of the last chunk is the result.
+// Every chunk is sent with retry policy, BeforeCall and Signer of c
+func (c *Caller[IN, OUT]) Upload(ctx context.Context, r io.ReaderAt, size int64, optFns ...func(options *UploadOptions)) (OUT, error) {
+	var out OUT
+	options := &UploadOptions{
+		ChunkSize: 8 << 20,
+	}
+	for _, fn := range optFns {
+		fn(options)
+	}
+	if options.ChunkSize <= 0 {
+		return out, fmt.Errorf("invalid chunk size %d", options.ChunkSize)
+	}
+	if options.OnProgress == nil {
+		options.OnProgress = c.UploadProgress
+	}
+	// progress of the whole content is reported by uploadChunk instead of every request
+	cc := *c
+	cc.UploadProgress = nil
+
+	traceID := uuid.NewString()
+	offset := options.Offset
+	stalls := 0
+	for {
+		n := size - offset
+		if n > options.ChunkSize {
+			n = options.ChunkSize
+		}
+		resp, err := cc.uploadChunk(ctx, traceID, r, offset, n, size, options.OnProgress)
+		if err != nil {
+			return out, err
+		}
+
+		if offset+n >= size {
+			return GetResponseResult[OUT](resp)
+		}
+
+		if err = xerror.ParseHTTPResponse(resp); err != nil {
+			return out, err
+		}
+		next := offset + n
+		if end, ok := parseRangeEnd(resp.Header.Get(KeyRange)); ok {
+			// server may persist part of the chunk, or lose some received bytes
+			next = end + 1
+		} else if resp.StatusCode == http.StatusPermanentRedirect {
+			next = offset
+		}
+		discardResponse(resp)
+		if next > size {
+			return out, fmt.Errorf("range end %d exceeds size %d", next-1, size)
+		}
+		if next <= offset {
+			stalls++
+			if stalls >= maxUploadStalls {
+				return out, fmt.Errorf("no progress at offset %d", offset)
+			}
+		} else {
+			stalls = 0
+		}
+		offset = next
+	}
+}
+
+func (c *Caller[IN, OUT]) uploadChunk(ctx context.Context, traceID string, r io.ReaderAt, offset, n, size int64, onProgress ProgressFunc) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, c.Method, c.Endpoint, io.NewSectionReader(r, offset, n))
+	if err != nil {
+		return nil, fmt.Errorf("create request %s %s: %w", c.Method, c.Endpoint, err)
+	}
+	req.ContentLength = n
+	req.GetBody = func() (io.ReadCloser, error) {
+		body := io.NopCloser(io.NewSectionReader(r, offset, n))
+		if onProgress == nil {
+			return body, nil
+		}
+		pr := newProgressReader(body, size, onProgress)
+		pr.transferred = offset
+		return pr, nil
+	}
+	req.Header.Set(KeyContentType, OctetStream)
+	req.Header.Set(KeyTraceID, traceID)
+	if n > 0 {
+		req.Header.Set(KeyContentRange, fmt.Sprintf("bytes %d-%d/%d", offset, offset+n-1, size))
+	} else {
+		req.Header.Set(KeyContentRange, fmt.Sprintf("bytes */%d", size))
+	}
+	return c.do(req)
+}
+
+// parseRangeEnd parses the last position of Range header like bytes=0-1023
+func parseRangeEnd(s string) (int64, bool) {
+	s = strings.TrimPrefix(s, "bytes=")
+	i := strings.LastIndexByte(s, '-')
+	if i < 0 {
+		return 0, false
+	}
+	end, err := strconv.ParseInt(s[i+1:], 10, 64)
+	return end, err == nil
+}
+
+type DownloadOptions struct {
+	// Offset resumes downloading from the offset with Range header
+	Offset int64
+	// ETag of the downloaded part is sent as If-Range,
+	// then ErrContentChanged is returned if content has been changed since then
+	ETag       string
+	OnProgress ProgressFunc
+}
+
+// Download writes response body into w, and returns the number of written bytes
+func (c *Caller[IN, OUT]) Download(ctx context.Context, input IN, w io.Writer, optFns ...func(options *DownloadOptions)) (int64, error) {
+	options := new(DownloadOptions)
+	for _, fn := range optFns {
+		fn(options)
+	}
+
+	req, err := c.newRequest(ctx, input)
+	if err != nil {
+		return 0, err
+	}
+	if options.Offset > 0 {
+		req.Header.Set(KeyRange, fmt.Sprintf("bytes=%d-", options.Offset))
+		if options.ETag != "" {
+			req.Header.Set(KeyIfRange, options.ETag)
+		}
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err = xerror.ParseHTTPResponse(resp); err != nil {
+		return 0, err
+	}
+
+	var body io.Reader = resp.Body
+	total := resp.ContentLength
+	if resp.StatusCode == http.StatusPartialContent {
+		total = getContentRangeSize(resp.Header.Get(KeyContentRange), options.Offset+resp.ContentLength)
+	} else if options.Offset > 0 {
+		// server doesn't support range, or content has been changed
+		if options.ETag != "" && GetETag(resp.Header) != options.ETag {
+			return 0, ErrContentChanged
+		}
+		if _, err = io.CopyN(io.Discard, body, options.Offset); err != nil {
+			return 0, fmt.Errorf("skip downloaded part: %w", err)
+		}
+	}
+	if total < 0 {
+		total = -1
+	}
+
+	pw := &progressWriter{w: w, transferred: options.Offset, total: total, fn: options.OnProgress}
+	n, err := io.Copy(pw, body)
+	if err != nil {
+		return n, fmt.Errorf("copy: %w", err)
+	}
+	return n, nil
+}
+
+// getContentRangeSize parses the complete length of Content-Range header like bytes 0-1023/4096
+func getContentRangeSize(s string, defaultSize int64) int64 {
+	i := strings.LastIndexByte(s, '/')
+	if i < 0 {
+		return defaultSize
+	}
+	size, err := strconv.ParseInt(s[i+1:], 10, 64)
+	if err != nil {
+		return defaultSize
+	}
+	return size
+}
@@ -0,0 +1,254 @@
+package xhttp_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"code.olapie.com/sugar/v2/xhttp"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+func TestCaller_Multipart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f, fh, err := r.FormFile("images")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		b, _ := io.ReadAll(f)
+		fmt.Fprintf(w, "%s:%s:%s", r.FormValue("title"), fh.Filename, b)
+	}))
+	defer server.Close()
+
+	var sent int64
+	c := xhttp.NewPost[*xhttp.MultipartForm, []byte](server.URL)
+	c.UploadProgress = func(transferred, total int64) {
+		sent = transferred
+		xtest.Equal(t, int64(-1), total)
+	}
+	res, err := c.Call(context.Background(), &xhttp.MultipartForm{
+		Fields: url.Values{"title": {"cat"}},
+		Files: []*xhttp.FilePart{{
+			FieldName: "images",
+			FileName:  "cat.png",
+			Body:      strings.NewReader("meow"),
+		}},
+	})
+	xtest.NoError(t, err)
+	xtest.Equal(t, "cat:cat.png:meow", string(res))
+	xtest.True(t, sent > 0)
+}
+
+type chunkServer struct {
+	mu       sync.Mutex
+	data     []byte
+	failures int
+	// drops is the number of chunks which are discarded and responded without Range
+	drops int
+	// lost is the number of received bytes which are lost after the second chunk
+	lost int
+}
+
+func (s *chunkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var start, end, size int
+	if _, err := fmt.Sscanf(r.Header.Get(xhttp.KeyContentRange), "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if start != len(s.data) {
+		http.Error(w, "unexpected offset "+strconv.Itoa(start), http.StatusBadRequest)
+		return
+	}
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	b, _ := io.ReadAll(r.Body)
+	if s.drops > 0 {
+		s.drops--
+		w.WriteHeader(http.StatusPermanentRedirect)
+		return
+	}
+	s.data = append(s.data, b...)
+	if s.lost > 0 && start > 0 {
+		s.data = s.data[:len(s.data)-s.lost]
+		s.lost = 0
+	}
+	if len(s.data) < size {
+		w.Header().Set(xhttp.KeyRange, fmt.Sprintf("bytes=0-%d", len(s.data)-1))
+		w.WriteHeader(http.StatusPermanentRedirect)
+		return
+	}
+	w.Header().Set(xhttp.KeyContentType, xhttp.JSON)
+	fmt.Fprint(w, len(s.data))
+}
+
+func TestCaller_Upload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10)
+
+	t.Run("Chunks", func(t *testing.T) {
+		s := &chunkServer{failures: 1}
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		var progress []int64
+		c := xhttp.NewPut[any, int](server.URL)
+		c.Retry = newTestRetryPolicy()
+		n, err := c.Upload(context.Background(), bytes.NewReader(content), int64(len(content)), func(options *xhttp.UploadOptions) {
+			options.ChunkSize = 30
+			options.OnProgress = func(transferred, total int64) {
+				xtest.Equal(t, int64(len(content)), total)
+				progress = append(progress, transferred)
+			}
+		})
+		xtest.NoError(t, err)
+		xtest.Equal(t, len(content), n)
+		xtest.Equal(t, content, s.data)
+		xtest.Equal(t, int64(len(content)), progress[len(progress)-1])
+	})
+
+	t.Run("Progress", func(t *testing.T) {
+		s := &chunkServer{}
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		var progress []int64
+		c := xhttp.NewPut[any, int](server.URL)
+		c.UploadProgress = func(transferred, total int64) {
+			xtest.Equal(t, int64(len(content)), total)
+			if len(progress) > 0 {
+				xtest.True(t, transferred > progress[len(progress)-1])
+			}
+			progress = append(progress, transferred)
+		}
+		_, err := c.Upload(context.Background(), bytes.NewReader(content), int64(len(content)), func(options *xhttp.UploadOptions) {
+			options.ChunkSize = 30
+		})
+		xtest.NoError(t, err)
+		xtest.Equal(t, int64(len(content)), progress[len(progress)-1])
+	})
+
+	t.Run("NoRange", func(t *testing.T) {
+		s := &chunkServer{drops: 2}
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		c := xhttp.NewPut[any, int](server.URL)
+		n, err := c.Upload(context.Background(), bytes.NewReader(content), int64(len(content)), func(options *xhttp.UploadOptions) {
+			options.ChunkSize = 30
+		})
+		xtest.NoError(t, err)
+		xtest.Equal(t, len(content), n)
+		xtest.Equal(t, content, s.data)
+	})
+
+	t.Run("Rewind", func(t *testing.T) {
+		// server loses 40 bytes after receiving 60, then responds Range of bytes=0-19
+		s := &chunkServer{lost: 40}
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		c := xhttp.NewPut[any, int](server.URL)
+		n, err := c.Upload(context.Background(), bytes.NewReader(content), int64(len(content)), func(options *xhttp.UploadOptions) {
+			options.ChunkSize = 30
+		})
+		xtest.NoError(t, err)
+		xtest.Equal(t, len(content), n)
+		xtest.Equal(t, content, s.data)
+	})
+
+	t.Run("NoProgress", func(t *testing.T) {
+		s := &chunkServer{drops: 10}
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		c := xhttp.NewPut[any, int](server.URL)
+		_, err := c.Upload(context.Background(), bytes.NewReader(content), int64(len(content)), func(options *xhttp.UploadOptions) {
+			options.ChunkSize = 30
+		})
+		xtest.Error(t, err)
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		s := &chunkServer{data: append([]byte(nil), content[:40]...)}
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		c := xhttp.NewPut[any, int](server.URL)
+		n, err := c.Upload(context.Background(), bytes.NewReader(content), int64(len(content)), func(options *xhttp.UploadOptions) {
+			options.ChunkSize = 50
+			options.Offset = 40
+		})
+		xtest.NoError(t, err)
+		xtest.Equal(t, len(content), n)
+		xtest.Equal(t, content, s.data)
+	})
+}
+
+func TestCaller_Download(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	etag := `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(xhttp.KeyETag, etag)
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	c := xhttp.NewGet[any, []byte](server.URL)
+
+	t.Run("Full", func(t *testing.T) {
+		var buf bytes.Buffer
+		var total int64
+		n, err := c.Download(context.Background(), nil, &buf, func(options *xhttp.DownloadOptions) {
+			options.OnProgress = func(transferred, t int64) {
+				total = t
+			}
+		})
+		xtest.NoError(t, err)
+		xtest.Equal(t, int64(len(content)), n)
+		xtest.Equal(t, int64(len(content)), total)
+		xtest.Equal(t, content, buf.Bytes())
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		buf := bytes.NewBuffer(append([]byte(nil), content[:30]...))
+		var transferred, total int64
+		n, err := c.Download(context.Background(), nil, buf, func(options *xhttp.DownloadOptions) {
+			options.Offset = 30
+			options.ETag = etag
+			options.OnProgress = func(tr, t int64) {
+				transferred, total = tr, t
+			}
+		})
+		xtest.NoError(t, err)
+		xtest.Equal(t, int64(70), n)
+		xtest.Equal(t, int64(len(content)), transferred)
+		xtest.Equal(t, int64(len(content)), total)
+		xtest.Equal(t, content, buf.Bytes())
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		_, err := c.Download(context.Background(), nil, io.Discard, func(options *xhttp.DownloadOptions) {
+			options.Offset = 30
+			options.ETag = `"v0"`
+		})
+		xtest.Equal(t, xhttp.ErrContentChanged, err)
+	})
+}
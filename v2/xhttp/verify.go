@@ -0,0 +1,239 @@
+package xhttp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.olapie.com/sugar/v2/xcontext"
+	"code.olapie.com/sugar/v2/xerror"
+	"code.olapie.com/sugar/v2/xtime"
+)
+
+// Rejection reasons of VerifyMiddleware, which can be checked by errors.Is
+var (
+	ErrMissingTimestamp   = xerror.BadRequest("missing %s", KeyTimestamp)
+	ErrInvalidTimestamp   = xerror.BadRequest("invalid %s", KeyTimestamp)
+	ErrOutdatedRequest    = xerror.Unauthorized("outdated request")
+	ErrMissingSignature   = xerror.BadRequest("missing %s", KeySignature)
+	ErrMalformedSignature = xerror.BadRequest("malformed %s", KeySignature)
+	ErrInvalidSignature   = xerror.Unauthorized("invalid signature")
+	ErrMissingKeyID       = xerror.BadRequest("missing %s or %s", KeyAppID, KeyClientID)
+	ErrUnknownKey         = xerror.Unauthorized("unknown key")
+	ErrMissingNonce       = xerror.BadRequest("missing %s", KeyTraceID)
+	ErrReplayedRequest    = xerror.Unauthorized("replayed request")
+)
+
+// KeyResolver returns public key of the app or client, which is *ecdsa.PublicKey or *rsa.PublicKey.
+// It returns nil if key is not found
+type KeyResolver interface {
+	ResolveKey(ctx context.Context, appID, clientID string) (crypto.PublicKey, error)
+}
+
+type KeyResolverFunc func(ctx context.Context, appID, clientID string) (crypto.PublicKey, error)
+
+func (f KeyResolverFunc) ResolveKey(ctx context.Context, appID, clientID string) (crypto.PublicKey, error) {
+	return f(ctx, appID, clientID)
+}
+
+// ReplayCache remembers nonces of verified requests
+type ReplayCache interface {
+	// Add returns false if nonce has been added and not expired
+	Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// MemoryReplayCache is a ReplayCache for single instance servers
+type MemoryReplayCache struct {
+	mu     sync.Mutex
+	clock  xtime.Clock
+	nonces map[string]time.Time
+	// nextSweep is the time to remove expired nonces
+	nextSweep time.Time
+}
+
+var _ ReplayCache = (*MemoryReplayCache)(nil)
+
+func NewMemoryReplayCache(clock xtime.Clock) *MemoryReplayCache {
+	if clock == nil {
+		clock = xtime.LocalClock{}
+	}
+	return &MemoryReplayCache{
+		clock:  clock,
+		nonces: make(map[string]time.Time),
+	}
+}
+
+func (c *MemoryReplayCache) Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	if now.After(c.nextSweep) {
+		for k, expiresAt := range c.nonces {
+			if !now.Before(expiresAt) {
+				delete(c.nonces, k)
+			}
+		}
+		c.nextSweep = now.Add(ttl)
+	}
+
+	if expiresAt, ok := c.nonces[nonce]; ok && now.Before(expiresAt) {
+		return false, nil
+	}
+	c.nonces[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+type VerifyOptions struct {
+	// MaxClockSkew is the max difference between X-Timestamp and the server time
+	MaxClockSkew time.Duration
+	Clock        xtime.Clock
+	// ReplayCache rejects requests with the same X-Trace-Id within the skew window.
+	// It's a MemoryReplayCache by default, which should be replaced with a shared one if there are multiple instances
+	ReplayCache ReplayCache
+}
+
+// VerifyMiddleware verifies signatures created by Sign with public keys resolved by X-App-Id or X-Client-Id.
+// Rejected requests are responded with one of the rejection errors.
+// Identities of verified requests are put into context, including user id which is asserted by the app or client.
+// If identities are not signed, see SignVersion, only X-App-Id or X-Client-Id which resolves the key is trusted, the former of which is preferred
+func VerifyMiddleware(resolver KeyResolver, optFns ...func(options *VerifyOptions)) Middleware {
+	options := &VerifyOptions{
+		MaxClockSkew: time.Minute,
+		Clock:        xtime.LocalClock{},
+	}
+	for _, fn := range optFns {
+		fn(options)
+	}
+	if options.ReplayCache == nil {
+		options.ReplayCache = NewMemoryReplayCache(options.Clock)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx, err := verifyRequest(req, resolver, options)
+			if err != nil {
+				respondError(req.Context(), w, err)
+				return
+			}
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+func verifyRequest(req *http.Request, resolver KeyResolver, options *VerifyOptions) (context.Context, error) {
+	ctx := req.Context()
+	if err := checkTimestamp(req.Header, options.Clock.Now(), options.MaxClockSkew); err != nil {
+		return nil, err
+	}
+
+	appID, clientID := req.Header.Get(KeyAppID), req.Header.Get(KeyClientID)
+	if appID == "" && clientID == "" {
+		return nil, ErrMissingKeyID
+	}
+	nonce := req.Header.Get(KeyTraceID)
+	if nonce == "" {
+		return nil, ErrMissingNonce
+	}
+	identitySigned := isIdentitySigned(req.Header)
+	if !identitySigned && appID != "" {
+		// unsigned ids can be changed by replayers, so only the one used to resolve the key is trusted
+		clientID = ""
+	}
+
+	pub, err := resolver.ResolveKey(ctx, appID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if pub == nil {
+		return nil, ErrUnknownKey
+	}
+	if err = verifySignature(req, pub); err != nil {
+		return nil, err
+	}
+	keyID, err := getPublicKeyID(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	// signed requests expire after the skew window, so that nonces don't have to be remembered longer.
+	// Nonce is remembered with the key rather than unsigned ids, which can be changed by replayers
+	ok, err := options.ReplayCache.Add(ctx, keyID+"/"+nonce, 2*options.MaxClockSkew)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrReplayedRequest
+	}
+
+	ctx = xcontext.WithAppID(ctx, appID)
+	ctx = xcontext.WithClientID(ctx, clientID)
+	ctx = xcontext.WithTraceID(ctx, nonce)
+	// unsigned user id is ignored, as it can be forged
+	if userID := req.Header.Get(KeyUserID); userID != "" && identitySigned {
+		if id, err := strconv.ParseInt(userID, 10, 64); err == nil {
+			ctx = xcontext.WithLogin(ctx, id)
+		} else {
+			ctx = xcontext.WithLogin(ctx, userID)
+		}
+	}
+	return ctx, nil
+}
+
+// getPublicKeyID returns hex encoded SHA-256 of public key in PKIX form
+func getPublicKeyID(pub crypto.PublicKey) (string, error) {
+	data, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", xerror.InternalServerError("marshal public key: %v", err)
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func checkTimestamp(h http.Header, now time.Time, maxSkew time.Duration) error {
+	ts := h.Get(KeyTimestamp)
+	if ts == "" {
+		return ErrMissingTimestamp
+	}
+	t, err := strconv.ParseInt(ts, 0, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	if d := now.Sub(time.Unix(t, 0)); d > maxSkew || d < -maxSkew {
+		return ErrOutdatedRequest
+	}
+	return nil
+}
+
+func verifySignature(req *http.Request, pub crypto.PublicKey) error {
+	signature := req.Header.Get(KeySignature)
+	if signature == "" {
+		return ErrMissingSignature
+	}
+	sign, err := DecodeSign(req.Header)
+	if err != nil {
+		return ErrMalformedSignature
+	}
+
+	hash := getMessageHashForSigning(req)
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, hash, sign) {
+			return ErrInvalidSignature
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, hash, sign) != nil {
+			return ErrInvalidSignature
+		}
+	default:
+		return xerror.InternalServerError("unsupported public key %T", pub)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package xhttp_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"code.olapie.com/sugar/v2/xcontext"
+	"code.olapie.com/sugar/v2/xerror"
+	"code.olapie.com/sugar/v2/xhttp"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+func TestVerifyMiddleware(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	xtest.NoError(t, err)
+	resolver := xhttp.KeyResolverFunc(func(ctx context.Context, appID, clientID string) (crypto.PublicKey, error) {
+		if appID == "app" {
+			return &priv.PublicKey, nil
+		}
+		return nil, nil
+	})
+	clock := &testClock{now: time.Now()}
+
+	var userID int64
+	var appID, clientID string
+	h := xhttp.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = xcontext.GetLogin[int64](r.Context())
+		appID = xcontext.GetAppID(r.Context())
+		clientID = xcontext.GetClientID(r.Context())
+	}), xhttp.VerifyMiddleware(resolver, func(options *xhttp.VerifyOptions) {
+		options.Clock = clock
+		options.MaxClockSkew = 10 * time.Second
+	}))
+
+	newRequest := func(t *testing.T, app string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/users?limit=10", nil)
+		req.Header.Set(xhttp.KeyAppID, app)
+		req.Header.Set(xhttp.KeyUserID, "123")
+		req.Header.Set(xhttp.KeyTimestamp, fmt.Sprint(clock.now.Unix()))
+		xtest.NoError(t, xhttp.Sign(context.Background(), req, priv, func(options *xhttp.SignOptions) {
+			options.SignIdentity = true
+		}))
+		return req
+	}
+
+	serve := func(req *http.Request) error {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return xerror.ParseHTTPResponse(w.Result())
+	}
+
+	t.Run("Verified", func(t *testing.T) {
+		err := serve(newRequest(t, "app"))
+		xtest.NoError(t, err)
+		xtest.Equal(t, int64(123), userID)
+		xtest.Equal(t, "app", appID)
+	})
+
+	t.Run("Replayed", func(t *testing.T) {
+		req := newRequest(t, "app")
+		xtest.NoError(t, serve(req))
+		err := serve(req)
+		xtest.True(t, errors.Is(err, xhttp.ErrReplayedRequest), err)
+	})
+
+	t.Run("Outdated", func(t *testing.T) {
+		req := newRequest(t, "app")
+		clock.now = clock.now.Add(11 * time.Second)
+		defer func() {
+			clock.now = clock.now.Add(-11 * time.Second)
+		}()
+		err := serve(req)
+		xtest.True(t, errors.Is(err, xhttp.ErrOutdatedRequest), err)
+	})
+
+	t.Run("UnknownKey", func(t *testing.T) {
+		err := serve(newRequest(t, "other"))
+		xtest.True(t, errors.Is(err, xhttp.ErrUnknownKey), err)
+	})
+
+	t.Run("InvalidSignature", func(t *testing.T) {
+		req := newRequest(t, "app")
+		req.URL.RawQuery = "limit=100"
+		err := serve(req)
+		xtest.True(t, errors.Is(err, xhttp.ErrInvalidSignature), err)
+	})
+
+	t.Run("TamperedUserID", func(t *testing.T) {
+		req := newRequest(t, "app")
+		req.Header.Set(xhttp.KeyUserID, "1")
+		err := serve(req)
+		xtest.True(t, errors.Is(err, xhttp.ErrInvalidSignature), err)
+	})
+
+	// newV1Request creates request signed by old clients, the signature of which doesn't cover identities
+	newV1Request := func(t *testing.T, nonce string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/users?limit=10", nil)
+		req.Header.Set(xhttp.KeyAppID, "app")
+		req.Header.Set(xhttp.KeyUserID, "123")
+		req.Header.Set(xhttp.KeyTraceID, nonce)
+		req.Header.Set(xhttp.KeyTimestamp, fmt.Sprint(clock.now.Unix()))
+		hash := md5.Sum([]byte(req.Method + req.URL.Path + req.URL.RawQuery + nonce + req.Header.Get(xhttp.KeyTimestamp)))
+		sign, err := ecdsa.SignASN1(rand.Reader, priv, hash[:])
+		xtest.NoError(t, err)
+		req.Header.Set(xhttp.KeySignature, base64.StdEncoding.EncodeToString(sign))
+		return req
+	}
+
+	t.Run("UnsignedUserID", func(t *testing.T) {
+		userID = 0
+		xtest.NoError(t, serve(newV1Request(t, "nonce-1")))
+		xtest.Equal(t, int64(0), userID)
+		xtest.Equal(t, "app", appID)
+	})
+
+	t.Run("UnsignedClientID", func(t *testing.T) {
+		req := newV1Request(t, "nonce-3")
+		req.Header.Set(xhttp.KeyClientID, "client")
+		xtest.NoError(t, serve(req))
+		xtest.Equal(t, "app", appID)
+		xtest.Equal(t, "", clientID)
+	})
+
+	t.Run("DefaultSign", func(t *testing.T) {
+		// identities are not signed by default, so that old servers can verify signatures
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set(xhttp.KeyAppID, "app")
+		req.Header.Set(xhttp.KeyTimestamp, fmt.Sprint(clock.now.Unix()))
+		xtest.NoError(t, xhttp.Sign(context.Background(), req, priv))
+		xtest.Equal(t, "", req.Header.Get(xhttp.KeySignVersion))
+		xtest.NoError(t, serve(req))
+		xtest.True(t, xhttp.Verify(context.Background(), req, &priv.PublicKey))
+	})
+
+	t.Run("ReplayedWithOtherClientID", func(t *testing.T) {
+		req := newV1Request(t, "nonce-2")
+		xtest.NoError(t, serve(req))
+		req.Header.Set(xhttp.KeyClientID, "other")
+		err := serve(req)
+		xtest.True(t, errors.Is(err, xhttp.ErrReplayedRequest), err)
+	})
+
+	t.Run("MissingSignature", func(t *testing.T) {
+		req := newRequest(t, "app")
+		req.Header.Del(xhttp.KeySignature)
+		err := serve(req)
+		xtest.True(t, errors.Is(err, xhttp.ErrMissingSignature), err)
+	})
+}
+
+func TestMemoryReplayCache(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	c := xhttp.NewMemoryReplayCache(clock)
+	ok, err := c.Add(context.Background(), "n1", time.Minute)
+	xtest.NoError(t, err)
+	xtest.True(t, ok)
+
+	ok, _ = c.Add(context.Background(), "n1", time.Minute)
+	xtest.False(t, ok)
+
+	clock.now = clock.now.Add(time.Minute)
+	ok, _ = c.Add(context.Background(), "n1", time.Minute)
+	xtest.True(t, ok)
+}
@@ -0,0 +1,87 @@
+package xpsql
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultHealthCheckInterval = 10 * time.Second
+
+type HealthCheckOptions struct {
+	Interval time.Duration
+	// Timeout of every ping
+	Timeout time.Duration
+	// OnChange is called when db becomes healthy or unhealthy. err is nil if it's healthy
+	OnChange func(db *sql.DB, healthy bool, err error)
+}
+
+// HealthChecker pings db periodically. It considers db healthy until a ping fails
+type HealthChecker struct {
+	db       *sql.DB
+	options  HealthCheckOptions
+	healthy  atomic.Bool
+	mu       sync.Mutex
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewHealthChecker(db *sql.DB, optFns ...func(options *HealthCheckOptions)) *HealthChecker {
+	h := &HealthChecker{
+		db: db,
+		options: HealthCheckOptions{
+			Interval: defaultHealthCheckInterval,
+			Timeout:  defaultPingTimeout,
+		},
+		done: make(chan struct{}),
+	}
+	for _, fn := range optFns {
+		fn(&h.options)
+	}
+	h.healthy.Store(true)
+	go h.run()
+	return h
+}
+
+func (h *HealthChecker) DB() *sql.DB {
+	return h.db
+}
+
+func (h *HealthChecker) Healthy() bool {
+	return h.healthy.Load()
+}
+
+// Check pings db immediately and updates health
+func (h *HealthChecker) Check(ctx context.Context) error {
+	err := ping(ctx, h.db, h.options.Timeout)
+	// serializes OnChange calls
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	healthy := err == nil
+	if h.healthy.Swap(healthy) != healthy && h.options.OnChange != nil {
+		h.options.OnChange(h.db, healthy, err)
+	}
+	return err
+}
+
+// Stop stops periodic checks, db is not closed
+func (h *HealthChecker) Stop() {
+	h.stopOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+func (h *HealthChecker) run() {
+	ticker := time.NewTicker(h.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			h.Check(context.Background())
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package xpsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.olapie.com/sugar/v2/xerror"
+	"github.com/lib/pq"
+)
+
+const (
+	ErrListenerClosed  xerror.String = "listener is closed"
+	ErrPayloadTooLarge xerror.String = "payload is too large"
+)
+
+// maxPayloadSize is the limit of notification payload in default configuration of postgres
+const maxPayloadSize = 8000
+
+type ListenerOptions struct {
+	MinReconnectInterval time.Duration
+	MaxReconnectInterval time.Duration
+	// OnError is called with connection errors and payload decoding errors, which are ignored if it's nil
+	OnError func(err error)
+}
+
+type SubscribeOptions struct {
+	// OnMissed is called after reconnection, as notifications sent during disconnection are lost,
+	// e.g. it can reload the whole cache
+	OnMissed func()
+}
+
+// notificationListener is implemented by *pq.Listener
+type notificationListener interface {
+	Listen(channel string) error
+	Unlisten(channel string) error
+	NotificationChannel() <-chan *pq.Notification
+	Close() error
+}
+
+type subscription struct {
+	channel  string
+	handle   func(payload string) error
+	onMissed func()
+}
+
+// Listener dispatches notifications of LISTEN channels to subscriptions.
+// It reconnects automatically and listens to subscribed channels again.
+// Handlers are called one by one in the same goroutine, so slow handlers delay others
+type Listener struct {
+	l        notificationListener
+	options  ListenerOptions
+	mu       sync.RWMutex
+	subs     map[string][]*subscription
+	listenMu sync.Mutex
+	closed   bool
+	done     chan struct{}
+}
+
+func NewListener(options *OpenOptions, optFns ...func(options *ListenerOptions)) *Listener {
+	if options == nil {
+		options = NewOpenOptions()
+	}
+	o := ListenerOptions{
+		MinReconnectInterval: time.Second,
+		MaxReconnectInterval: time.Minute,
+	}
+	for _, fn := range optFns {
+		fn(&o)
+	}
+	pl := pq.NewListener(options.String(), o.MinReconnectInterval, o.MaxReconnectInterval, func(event pq.ListenerEventType, err error) {
+		if err != nil && o.OnError != nil {
+			o.OnError(fmt.Errorf("connection event %d: %w", event, err))
+		}
+	})
+	return newListener(pl, o)
+}
+
+func newListener(l notificationListener, options ListenerOptions) *Listener {
+	ln := &Listener{
+		l:       l,
+		options: options,
+		subs:    make(map[string][]*subscription),
+		done:    make(chan struct{}),
+	}
+	go ln.run()
+	return ln
+}
+
+// Subscription is returned by Subscribe
+type Subscription struct {
+	l   *Listener
+	sub *subscription
+}
+
+// Unsubscribe stops calling the handler, and stops listening to the channel if it has no other subscriptions
+func (s *Subscription) Unsubscribe() error {
+	return s.l.unsubscribe(s.sub)
+}
+
+// Subscribe calls fn with payload of notifications on channel, which is decoded from JSON into T.
+// Payload is passed as it is if T is string
+func Subscribe[T any](l *Listener, channel string, fn func(v T), optFns ...func(options *SubscribeOptions)) (*Subscription, error) {
+	var o SubscribeOptions
+	for _, f := range optFns {
+		f(&o)
+	}
+	sub := &subscription{
+		channel:  channel,
+		onMissed: o.OnMissed,
+		handle: func(payload string) error {
+			var v T
+			if p, ok := any(&v).(*string); ok {
+				*p = payload
+			} else if err := json.Unmarshal([]byte(payload), &v); err != nil {
+				return fmt.Errorf("decode payload of %s: %w", channel, err)
+			}
+			fn(v)
+			return nil
+		},
+	}
+	if err := l.subscribe(sub); err != nil {
+		return nil, err
+	}
+	return &Subscription{l: l, sub: sub}, nil
+}
+
+func (l *Listener) subscribe(sub *subscription) error {
+	l.listenMu.Lock()
+	defer l.listenMu.Unlock()
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return ErrListenerClosed
+	}
+	first := len(l.subs[sub.channel]) == 0
+	l.subs[sub.channel] = append(l.subs[sub.channel], sub)
+	l.mu.Unlock()
+
+	if !first {
+		return nil
+	}
+
+	// Listen blocks until connected, so it's called without holding mu which is required by dispatching
+	if err := l.l.Listen(sub.channel); err != nil && err != pq.ErrChannelAlreadyOpen {
+		l.removeSubscription(sub)
+		return fmt.Errorf("listen %s: %w", sub.channel, err)
+	}
+	return nil
+}
+
+func (l *Listener) unsubscribe(sub *subscription) error {
+	l.listenMu.Lock()
+	defer l.listenMu.Unlock()
+
+	if !l.removeSubscription(sub) {
+		return nil
+	}
+
+	l.mu.RLock()
+	last := len(l.subs[sub.channel]) == 0
+	closed := l.closed
+	l.mu.RUnlock()
+	if !last || closed {
+		return nil
+	}
+
+	if err := l.l.Unlisten(sub.channel); err != nil && err != pq.ErrChannelNotOpen {
+		return fmt.Errorf("unlisten %s: %w", sub.channel, err)
+	}
+	return nil
+}
+
+// removeSubscription returns false if sub has been removed
+func (l *Listener) removeSubscription(sub *subscription) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	subs := l.subs[sub.channel]
+	for i, s := range subs {
+		if s == sub {
+			subs = append(subs[:i:i], subs[i+1:]...)
+			if len(subs) == 0 {
+				delete(l.subs, sub.channel)
+			} else {
+				l.subs[sub.channel] = subs
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops listening and dispatching
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.done)
+	l.mu.Unlock()
+	return l.l.Close()
+}
+
+func (l *Listener) run() {
+	c := l.l.NotificationChannel()
+	for {
+		select {
+		case <-l.done:
+			return
+		case n, ok := <-c:
+			if !ok {
+				return
+			}
+			l.dispatch(n)
+		}
+	}
+}
+
+func (l *Listener) dispatch(n *pq.Notification) {
+	l.mu.RLock()
+	var subs []*subscription
+	if n == nil {
+		// pq sends nil after reconnection
+		for _, list := range l.subs {
+			subs = append(subs, list...)
+		}
+	} else {
+		subs = append(subs, l.subs[n.Channel]...)
+	}
+	l.mu.RUnlock()
+
+	for _, s := range subs {
+		if n == nil {
+			if s.onMissed != nil {
+				s.onMissed()
+			}
+			continue
+		}
+		if err := s.handle(n.Extra); err != nil && l.options.OnError != nil {
+			l.options.OnError(err)
+		}
+	}
+}
+
+// Execer is implemented by *sql.DB, *sql.Tx and *sql.Conn
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+var _ Execer = (*sql.Tx)(nil)
+
+// Notify sends v encoded as JSON to channel, or v itself if it's a string.
+// If exe is *sql.Tx, the notification is delivered after the transaction is committed
+func Notify(ctx context.Context, exe Execer, channel string, v any) error {
+	payload, ok := v.(string)
+	if !ok {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("encode payload: %w", err)
+		}
+		payload = string(b)
+	}
+	if len(payload) >= maxPayloadSize {
+		return ErrPayloadTooLarge
+	}
+	_, err := exe.ExecContext(ctx, "SELECT pg_notify($1, $2)", channel, payload)
+	return err
+}
@@ -0,0 +1,173 @@
+package xpsql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+type testListener struct {
+	mu       sync.Mutex
+	channels map[string]bool
+	c        chan *pq.Notification
+}
+
+func newTestListener() *testListener {
+	return &testListener{
+		channels: map[string]bool{},
+		c:        make(chan *pq.Notification),
+	}
+}
+
+func (l *testListener) Listen(channel string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.channels[channel] {
+		return pq.ErrChannelAlreadyOpen
+	}
+	l.channels[channel] = true
+	return nil
+}
+
+func (l *testListener) Unlisten(channel string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.channels[channel] {
+		return pq.ErrChannelNotOpen
+	}
+	delete(l.channels, channel)
+	return nil
+}
+
+func (l *testListener) listening(channel string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.channels[channel]
+}
+
+func (l *testListener) NotificationChannel() <-chan *pq.Notification {
+	return l.c
+}
+
+func (l *testListener) Close() error {
+	return nil
+}
+
+type testEvent struct {
+	ID int64 `json:"id"`
+}
+
+func TestListener(t *testing.T) {
+	tl := newTestListener()
+	errs := make(chan error, 1)
+	l := newListener(tl, ListenerOptions{
+		OnError: func(err error) {
+			errs <- err
+		},
+	})
+	defer l.Close()
+
+	events := make(chan testEvent, 1)
+	missed := make(chan bool, 1)
+	sub, err := Subscribe(l, "events", func(v testEvent) {
+		events <- v
+	}, func(o *SubscribeOptions) {
+		o.OnMissed = func() {
+			missed <- true
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := make(chan string, 1)
+	textSub, err := Subscribe(l, "texts", func(v string) {
+		texts <- v
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tl.c <- &pq.Notification{Channel: "events", Extra: `{"id":1}`}
+	if e := <-events; e.ID != 1 {
+		t.Errorf("want 1, got %d", e.ID)
+	}
+	tl.c <- &pq.Notification{Channel: "texts", Extra: "hello"}
+	if s := <-texts; s != "hello" {
+		t.Errorf("want hello, got %s", s)
+	}
+
+	tl.c <- &pq.Notification{Channel: "events", Extra: "invalid"}
+	if err := <-errs; !strings.Contains(err.Error(), "events") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// reconnected
+	tl.c <- nil
+	<-missed
+
+	if err = textSub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	if tl.listening("texts") || !tl.listening("events") {
+		t.Error("want only events listened")
+	}
+	if err = sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	if tl.listening("events") {
+		t.Error("want events unlistened")
+	}
+
+	l.Close()
+	if _, err = Subscribe(l, "events", func(v testEvent) {}); err != ErrListenerClosed {
+		t.Errorf("want ErrListenerClosed, got %v", err)
+	}
+}
+
+type testExecer struct {
+	query string
+	args  []any
+}
+
+func (e *testExecer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	e.query, e.args = query, args
+	return nil, nil
+}
+
+func TestNotify(t *testing.T) {
+	var e testExecer
+	if err := Notify(context.TODO(), &e, "events", &testEvent{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if e.args[0] != "events" || e.args[1] != `{"id":1}` {
+		t.Errorf("unexpected args: %v", e.args)
+	}
+	if err := Notify(context.TODO(), &e, "events", strings.Repeat("a", maxPayloadSize)); err != ErrPayloadTooLarge {
+		t.Errorf("want ErrPayloadTooLarge, got %v", err)
+	}
+}
+
+func TestListener_NilOnError(t *testing.T) {
+	tl := newTestListener()
+	l := newListener(tl, ListenerOptions{})
+	defer l.Close()
+
+	events := make(chan testEvent, 1)
+	_, err := Subscribe(l, "events", func(v testEvent) {
+		events <- v
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// decoding error is ignored
+	tl.c <- &pq.Notification{Channel: "events", Extra: "invalid"}
+	tl.c <- &pq.Notification{Channel: "events", Extra: `{"id":2}`}
+	if e := <-events; e.ID != 2 {
+		t.Errorf("want 2, got %d", e.ID)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"os/user"
 	"sync"
+	"time"
 
 	"code.olapie.com/sugar/v2/must"
 )
@@ -21,12 +22,36 @@ type OpenOptions struct {
 	Database   string
 	Schema     string
 	SSL        bool
+
+	// DriverName is postgres by default
+	DriverName string
+
+	// Pool settings of sql.DB, zero values keep defaults of database/sql
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// PingAttempts is the maximum number of pings before Open fails, 1 by default
+	PingAttempts int
+	// PingBackoff returns delay after the attempt-th failed ping
+	PingBackoff func(attempt int) time.Duration
+	// PingTimeout limits every ping, including health checks
+	PingTimeout time.Duration
+
+	// Replicas are read-only copies of the database, see Router
+	Replicas []*OpenOptions
+	// HealthCheckInterval is the interval of pinging replicas
+	HealthCheckInterval time.Duration
 }
 
 func NewOpenOptions() *OpenOptions {
 	return &OpenOptions{
-		Host: "localhost",
-		Port: 5432,
+		Host:                "localhost",
+		Port:                5432,
+		PingAttempts:        1,
+		PingTimeout:         defaultPingTimeout,
+		HealthCheckInterval: defaultHealthCheckInterval,
 	}
 }
 
@@ -79,23 +104,82 @@ func (c *OpenOptions) String() string {
 	return connStr + "?" + query.Encode()
 }
 
+// Open opens db with pool settings of options, and pings it until it's connected or PingAttempts are used up
 func Open(options *OpenOptions) (*sql.DB, error) {
 	if options == nil {
 		options = NewOpenOptions()
 	}
+	db, err := openDB(options)
+	if err != nil {
+		return nil, err
+	}
+
+	backoff := options.PingBackoff
+	if backoff == nil {
+		backoff = pingBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		err = ping(context.Background(), db, options.PingTimeout)
+		if err == nil {
+			return db, nil
+		}
+		if attempt >= options.PingAttempts {
+			db.Close()
+			return nil, fmt.Errorf("ping: %s, %w", options.String(), err)
+		}
+		time.Sleep(backoff(attempt))
+	}
+}
+
+// openDB opens db without connecting to it
+func openDB(options *OpenOptions) (*sql.DB, error) {
+	driverName := options.DriverName
+	if driverName == "" {
+		driverName = "postgres"
+	}
 	connString := options.String()
-	db, err := sql.Open("postgres", connString)
+	db, err := sql.Open(driverName, connString)
 	if err != nil {
 		return nil, fmt.Errorf("open: %s, %w", connString, err)
 	}
 
-	err = db.Ping()
-	if err != nil {
-		return nil, fmt.Errorf("ping: %s, %w", connString, err)
+	if options.MaxOpenConns != 0 {
+		db.SetMaxOpenConns(options.MaxOpenConns)
+	}
+	if options.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(options.MaxIdleConns)
+	}
+	if options.ConnMaxLifetime != 0 {
+		db.SetConnMaxLifetime(options.ConnMaxLifetime)
+	}
+	if options.ConnMaxIdleTime != 0 {
+		db.SetConnMaxIdleTime(options.ConnMaxIdleTime)
 	}
 	return db, nil
 }
 
+const (
+	defaultPingTimeout = 3 * time.Second
+	maxPingBackoff     = 5 * time.Second
+)
+
+func ping(ctx context.Context, db *sql.DB, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return db.PingContext(ctx)
+}
+
+func pingBackoff(attempt int) time.Duration {
+	d := 100 * time.Millisecond << (attempt - 1)
+	if d <= 0 || d > maxPingBackoff {
+		return maxPingBackoff
+	}
+	return d
+}
+
 func MustOpen(options *OpenOptions) *sql.DB {
 	return must.Get(Open(options))
 }
@@ -116,46 +200,95 @@ func MustOpenLocal() *sql.DB {
 	return must.Get(OpenLocal())
 }
 
+// Factory returns repo of schema which is app id in ctx.
+// Repos of read-only contexts are built from replicas if options has Replicas, see WithReadOnly.
+// Get panics if router of the app can't be opened
 type Factory[T any] interface {
 	Get(ctx context.Context) T
 }
 
 type NewRepoFunc[T any] func(ctx context.Context, db *sql.DB) T
 
+type factoryKey struct {
+	appID string
+	db    *sql.DB
+}
+
 type factoryImpl[T any] struct {
 	mu      sync.RWMutex
-	cache   map[string]T
+	routers map[string]*factoryRouter
+	cache   map[factoryKey]T
 	options *OpenOptions
 	fn      NewRepoFunc[T]
 }
 
+// factoryRouter is opened once per app, so that opening routers of other apps is not blocked
+type factoryRouter struct {
+	mu     sync.Mutex
+	router *Router
+}
+
 func NewFactory[T any](options *OpenOptions, fn NewRepoFunc[T]) Factory[T] {
 	f := &factoryImpl[T]{
 		options: options,
-		cache:   make(map[string]T),
+		routers: make(map[string]*factoryRouter),
+		cache:   make(map[factoryKey]T),
 		fn:      fn,
 	}
 	return f
 }
 
+// Get opens router of the app again if it failed last time
 func (f *factoryImpl[T]) Get(ctx context.Context) T {
 	appID := xcontext.GetAppID(ctx)
+	router, err := f.getRouter(appID)
+	if err != nil {
+		panic(fmt.Errorf("open router of %s: %w", appID, err))
+	}
+
+	key := factoryKey{appID: appID, db: router.DB(ctx)}
 	f.mu.RLock()
-	r, ok := f.cache[appID]
+	r, ok := f.cache[key]
 	f.mu.RUnlock()
 	if ok {
 		return r
 	}
 
 	f.mu.Lock()
-	r, ok = f.cache[appID]
+	r, ok = f.cache[key]
 	if !ok {
-		opt := *f.options
-		opt.Schema = appID
-		db := MustOpen(&opt)
-		r = f.fn(ctx, db)
-		f.cache[appID] = r
+		r = f.fn(ctx, key.db)
+		f.cache[key] = r
 	}
 	f.mu.Unlock()
 	return r
 }
+
+func (f *factoryImpl[T]) getRouter(appID string) (*Router, error) {
+	f.mu.RLock()
+	fr := f.routers[appID]
+	f.mu.RUnlock()
+	if fr == nil {
+		f.mu.Lock()
+		fr = f.routers[appID]
+		if fr == nil {
+			fr = new(factoryRouter)
+			f.routers[appID] = fr
+		}
+		f.mu.Unlock()
+	}
+
+	// router is opened without f.mu, as it may take long to ping and check replicas
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if fr.router == nil {
+		opt := *f.options
+		opt.Schema = appID
+		router, err := OpenRouter(&opt)
+		if err != nil {
+			return nil, err
+		}
+		fr.router = router
+	}
+	return fr.router, nil
+}
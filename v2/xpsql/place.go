@@ -66,15 +66,14 @@ func (pv *placeValuer) Value() (driver.Value, error) {
 	if pv == nil || (pv.v.Code == "" && pv.v.Name == "" && pv.v.Coordinate == nil) {
 		return nil, nil
 	}
-	point := pointValuer{
+	// coordinate is native POINT in composite type place
+	point := nativePointValuer{
 		v: pv.v.Coordinate,
 	}
 	loc, err := point.Value()
 	if err != nil {
 		return nil, fmt.Errorf("get Coordinate value: %w", err)
 	}
-	fields := []string{pv.v.Code, pv.v.Name}
 	locStr, _ := loc.(string)
-	fields = append(fields, locStr)
-	return composite.FieldsToString(fields), nil
+	return composite.FieldsToString(pv.v.Code, pv.v.Name, locStr), nil
 }
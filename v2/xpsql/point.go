@@ -18,11 +18,23 @@ type pointValuer struct {
 	v *xtype.Point
 }
 
+// nativePointValuer writes point in text format of postgres POINT, e.g. (1,2), rather than WKT
+type nativePointValuer struct {
+	v *xtype.Point
+}
+
 var (
 	_ driver.Valuer = (*pointValuer)(nil)
+	_ driver.Valuer = (*nativePointValuer)(nil)
 	_ sql.Scanner   = (*pointScanner)(nil)
 )
 
+// NativePoint returns valuer of p for postgres POINT column, while Value writes p in WKT, e.g. POINT(1 2).
+// Both formats can be read by Scan
+func NativePoint(p *xtype.Point) driver.Valuer {
+	return &nativePointValuer{v: p}
+}
+
 func (p *pointScanner) Scan(src any) error {
 	if src == nil {
 		return nil
@@ -75,3 +87,10 @@ func (p *pointValuer) Value() (driver.Value, error) {
 	v := fmt.Sprintf("POINT(%f %f)", p.v.X, p.v.Y)
 	return v, nil
 }
+
+func (p *nativePointValuer) Value() (driver.Value, error) {
+	if p == nil || p.v == nil {
+		return nil, nil
+	}
+	return fmt.Sprintf("(%v,%v)", p.v.X, p.v.Y), nil
+}
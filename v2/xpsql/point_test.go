@@ -0,0 +1,61 @@
+package xpsql_test
+
+import (
+	"reflect"
+	"testing"
+
+	"code.olapie.com/sugar/v2/xpsql"
+	"code.olapie.com/sugar/v2/xtype"
+)
+
+func TestPoint_RoundTrip(t *testing.T) {
+	p := &xtype.Point{X: 121.4737021, Y: -31.2303904}
+	v, err := xpsql.Value(p).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "POINT(121.473702 -31.230390)" {
+		t.Fatalf("unexpected value: %v", v)
+	}
+
+	v, err = xpsql.NativePoint(p).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "(121.4737021,-31.2303904)" {
+		t.Fatalf("unexpected value: %v", v)
+	}
+
+	// postgres outputs POINT in the same format as input
+	var got *xtype.Point
+	if err = xpsql.Scan(&got).Scan([]byte(v.(string))); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, got) {
+		t.Fatalf("want %v, got %v", p, got)
+	}
+}
+
+func TestPlace_RoundTrip(t *testing.T) {
+	p := &xtype.Place{
+		Code:       "sh",
+		Name:       "Shanghai, China",
+		Coordinate: &xtype.Point{X: 121.47, Y: 31.23},
+	}
+	v, err := xpsql.Value(p).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != `(sh,Shanghai\, China,\(121.47\,31.23\))` {
+		t.Fatalf("unexpected value: %v", v)
+	}
+
+	// postgres quotes fields of composite output instead of escaping them
+	var got *xtype.Place
+	if err = xpsql.Scan(&got).Scan(`(sh,"Shanghai, China","(121.47,31.23)")`); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, got) {
+		t.Fatalf("want %v, got %v", p, got)
+	}
+}
@@ -0,0 +1,123 @@
+package xpsql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+
+	"code.olapie.com/sugar/v2/must"
+)
+
+type readOnlyKeyType struct{}
+
+// WithReadOnly marks ctx read-only, so that Router routes it to replicas
+func WithReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKeyType{}, true)
+}
+
+func IsReadOnly(ctx context.Context) bool {
+	b, _ := ctx.Value(readOnlyKeyType{}).(bool)
+	return b
+}
+
+// Router routes read-only contexts to healthy replicas in turn, and other contexts to primary.
+// Read-only contexts fail over to primary if no replicas are healthy
+type Router struct {
+	primary  *sql.DB
+	replicas []*HealthChecker
+	next     atomic.Uint32
+}
+
+// NewRouter checks health of replicas periodically until Close is called
+func NewRouter(primary *sql.DB, replicas []*sql.DB, optFns ...func(options *HealthCheckOptions)) *Router {
+	r := &Router{
+		primary: primary,
+	}
+	for _, db := range replicas {
+		r.replicas = append(r.replicas, NewHealthChecker(db, optFns...))
+	}
+	return r
+}
+
+// OpenRouter opens primary database with options, and replicas with options.Replicas.
+// Unlike primary, replicas are not required to be connected, and they are used once they become healthy
+func OpenRouter(options *OpenOptions) (*Router, error) {
+	if options == nil {
+		options = NewOpenOptions()
+	}
+	primary, err := Open(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var replicas []*sql.DB
+	for i, ro := range options.Replicas {
+		o := *ro
+		if o.Schema == "" {
+			o.Schema = options.Schema
+		}
+		db, err := openDB(&o)
+		if err != nil {
+			primary.Close()
+			for _, v := range replicas {
+				v.Close()
+			}
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		replicas = append(replicas, db)
+	}
+
+	r := NewRouter(primary, replicas, func(o *HealthCheckOptions) {
+		if options.HealthCheckInterval > 0 {
+			o.Interval = options.HealthCheckInterval
+		}
+		if options.PingTimeout > 0 {
+			o.Timeout = options.PingTimeout
+		}
+	})
+	r.CheckHealth(context.Background())
+	return r, nil
+}
+
+func MustOpenRouter(options *OpenOptions) *Router {
+	return must.Get(OpenRouter(options))
+}
+
+func (r *Router) Primary() *sql.DB {
+	return r.primary
+}
+
+// DB returns db for ctx
+func (r *Router) DB(ctx context.Context) *sql.DB {
+	if len(r.replicas) == 0 || !IsReadOnly(ctx) {
+		return r.primary
+	}
+	n := uint32(len(r.replicas))
+	start := r.next.Add(1)
+	for i := uint32(0); i < n; i++ {
+		if h := r.replicas[(start+i)%n]; h.Healthy() {
+			return h.DB()
+		}
+	}
+	return r.primary
+}
+
+// CheckHealth checks all replicas immediately
+func (r *Router) CheckHealth(ctx context.Context) {
+	for _, h := range r.replicas {
+		h.Check(ctx)
+	}
+}
+
+// Close stops health checks and closes all databases
+func (r *Router) Close() error {
+	err := r.primary.Close()
+	for _, h := range r.replicas {
+		h.Stop()
+		if e := h.DB().Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
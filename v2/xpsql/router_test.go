@@ -0,0 +1,259 @@
+package xpsql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"code.olapie.com/sugar/v2/xcontext"
+	"code.olapie.com/sugar/v2/xpsql"
+)
+
+const testDriverName = "xpsqltest"
+
+// testDriver connects to hosts which are not down
+type testDriver struct {
+	mu    sync.Mutex
+	down  map[string]bool
+	opens map[string]int
+}
+
+var testDB = &testDriver{
+	down:  map[string]bool{},
+	opens: map[string]int{},
+}
+
+func init() {
+	sql.Register(testDriverName, testDB)
+}
+
+func (d *testDriver) setDown(host string, down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.down[host] = down
+}
+
+func (d *testDriver) isDown(dsn string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for host, down := range d.down {
+		if down && strings.Contains(dsn, "//"+host+":") {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *testDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	d.opens[dsn]++
+	d.mu.Unlock()
+	if d.isDown(dsn) {
+		return nil, errors.New("connection refused")
+	}
+	return &testConn{dsn: dsn}, nil
+}
+
+type testConn struct {
+	dsn string
+}
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *testConn) Close() error {
+	return nil
+}
+
+func (c *testConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *testConn) Ping(ctx context.Context) error {
+	if testDB.isDown(c.dsn) {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func newTestOptions(host string) *xpsql.OpenOptions {
+	o := xpsql.NewOpenOptions()
+	o.DriverName = testDriverName
+	o.Host = host
+	o.PingBackoff = func(attempt int) time.Duration {
+		return time.Millisecond
+	}
+	return o
+}
+
+func TestOpen(t *testing.T) {
+	o := newTestOptions("open")
+	o.MaxOpenConns = 5
+	db, err := xpsql.Open(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if n := db.Stats().MaxOpenConnections; n != 5 {
+		t.Errorf("want 5 max open connections, got %d", n)
+	}
+
+	t.Run("Retry", func(t *testing.T) {
+		o := newTestOptions("retry")
+		o.PingAttempts = 3
+		var backoffs []int
+		o.PingBackoff = func(attempt int) time.Duration {
+			backoffs = append(backoffs, attempt)
+			if attempt == 2 {
+				testDB.setDown("retry", false)
+			}
+			return time.Millisecond
+		}
+		testDB.setDown("retry", true)
+		db, err := xpsql.Open(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+		if len(backoffs) != 2 {
+			t.Errorf("want 2 backoffs, got %v", backoffs)
+		}
+
+		o.PingBackoff = nil
+		testDB.setDown("retry", true)
+		if _, err = xpsql.Open(o); err == nil {
+			t.Error("want error")
+		}
+	})
+}
+
+func TestRouter(t *testing.T) {
+	o := newTestOptions("primary")
+	o.Replicas = []*xpsql.OpenOptions{newTestOptions("replica1"), newTestOptions("replica2")}
+	o.HealthCheckInterval = time.Hour
+	r, err := xpsql.OpenRouter(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx := context.TODO()
+	readCtx := xpsql.WithReadOnly(ctx)
+	if r.DB(ctx) != r.Primary() {
+		t.Error("want primary")
+	}
+	replica1, replica2 := r.DB(readCtx), r.DB(readCtx)
+	if replica1 == r.Primary() || replica2 == r.Primary() || replica1 == replica2 {
+		t.Error("want different replicas")
+	}
+	if r.DB(readCtx) != replica1 {
+		t.Error("want replicas in turn")
+	}
+
+	testDB.setDown("replica1", true)
+	testDB.setDown("replica2", true)
+	defer testDB.setDown("replica1", false)
+	defer testDB.setDown("replica2", false)
+	r.CheckHealth(ctx)
+	if r.DB(readCtx) != r.Primary() {
+		t.Error("want failover to primary")
+	}
+
+	testDB.setDown("replica2", false)
+	r.CheckHealth(ctx)
+	healthy := r.DB(readCtx)
+	if healthy == r.Primary() {
+		t.Error("want healthy replica")
+	}
+	for i := 0; i < 3; i++ {
+		if r.DB(readCtx) != healthy {
+			t.Error("want healthy replica")
+		}
+	}
+}
+
+func TestHealthChecker(t *testing.T) {
+	db, err := xpsql.Open(newTestOptions("health"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	changes := make(chan bool, 2)
+	h := xpsql.NewHealthChecker(db, func(o *xpsql.HealthCheckOptions) {
+		o.Interval = time.Millisecond
+		o.OnChange = func(db *sql.DB, healthy bool, err error) {
+			changes <- healthy
+		}
+	})
+	defer h.Stop()
+
+	testDB.setDown("health", true)
+	if healthy := <-changes; healthy || h.Healthy() {
+		t.Error("want unhealthy")
+	}
+	testDB.setDown("health", false)
+	if healthy := <-changes; !healthy {
+		t.Error("want healthy")
+	}
+}
+
+func TestFactory(t *testing.T) {
+	o := newTestOptions("factory")
+	o.Replicas = []*xpsql.OpenOptions{newTestOptions("factory-replica")}
+	f := xpsql.NewFactory(o, func(ctx context.Context, db *sql.DB) *sql.DB {
+		return db
+	})
+	ctx := xcontext.WithAppID(context.TODO(), "app")
+	primary := f.Get(ctx)
+	replica := f.Get(xpsql.WithReadOnly(ctx))
+	if primary == replica {
+		t.Error("want replica for read-only context")
+	}
+	if f.Get(ctx) != primary {
+		t.Error("want cached repo")
+	}
+}
+
+func TestFactory_OpenError(t *testing.T) {
+	o := newTestOptions("factory-down")
+	f := xpsql.NewFactory(o, func(ctx context.Context, db *sql.DB) *sql.DB {
+		return db
+	})
+	get := func(ctx context.Context) (db *sql.DB, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err, _ = r.(error)
+			}
+		}()
+		return f.Get(ctx), nil
+	}
+
+	testDB.setDown("factory-down", true)
+	ctx := xcontext.WithAppID(context.TODO(), "app")
+	if _, err := get(ctx); err == nil {
+		t.Fatal("want error")
+	}
+
+	// the failed router is opened again rather than blocking or being cached
+	testDB.setDown("factory-down", false)
+	done := make(chan *sql.DB, 1)
+	go func() {
+		db, _ := get(ctx)
+		done <- db
+	}()
+	select {
+	case db := <-done:
+		if db == nil {
+			t.Error("want db")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("factory is blocked")
+	}
+}
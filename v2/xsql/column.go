@@ -33,6 +33,7 @@ var _sqlKeywords = map[string]struct{}{
 	"date":           {},
 	"json":           {},
 	"nullable":       {},
+	"redact":         {},
 }
 
 type fieldIndex []int
@@ -66,6 +67,9 @@ type columnInfo struct {
 
 	nullableNames []string
 
+	// redactedNames are columns whose values are masked in QueryEvent
+	redactedNames []string
+
 	//for speed
 	notPKNames []string
 	notAINames []string
@@ -114,6 +118,7 @@ func parseColumnInfo(typ reflect.Type) *columnInfo {
 
 		isJSON := strings.Contains(tag, "json")
 		nullable := strings.Contains(tag, "nullable")
+		redacted := hasTagOption(tag, "redact")
 
 		if !isJSON && !isSupportType(f.Type) {
 			if len(tag) > 0 {
@@ -174,6 +179,10 @@ func parseColumnInfo(typ reflect.Type) *columnInfo {
 		if nullable {
 			info.nullableNames = append(info.nullableNames, name)
 		}
+
+		if redacted {
+			info.redactedNames = append(info.redactedNames, name)
+		}
 	}
 
 	if len(info.pkNames) == 0 {
@@ -241,3 +250,13 @@ func getAllFields(typ reflect.Type) []reflect.StructField {
 
 	return fields
 }
+
+// hasTagOption reports whether option is one of comma separated options in tag
+func hasTagOption(tag, option string) bool {
+	for _, s := range strings.Split(tag, ",") {
+		if strings.TrimSpace(s) == option {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package xsql
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"reflect"
@@ -10,47 +11,83 @@ var _tablexnameType = reflect.TypeOf((*tablexname)(nil)).Elem()
 
 type DB struct {
 	db         *sql.DB
+	exe        ContextExecutor
 	driverName string
+	dialect    Dialect
+	options    DBOptions
+}
+
+type DBOptions struct {
+	// Interceptors observe every statement executed by DB and its transactions
+	Interceptors []Interceptor
 }
 
 // NewDB opens database
 // dataSourceName's format: username:password@tcp(host:port)/dbName
-func NewDB(driverName, dataSourceName string) (*DB, error) {
+func NewDB(driverName, dataSourceName string, optFns ...func(options *DBOptions)) (*DB, error) {
 	db, err := sql.Open(driverName, dataSourceName)
 	if err != nil {
 		return nil, err
 	}
 
-	return &DB{
+	d := &DB{
 		db:         db,
 		driverName: driverName,
-	}, nil
+		dialect:    getDialectOrDefault(driverName),
+	}
+	for _, fn := range optFns {
+		fn(&d.options)
+	}
+	d.exe = newExecutor(db, d.options.Interceptors)
+	return d, nil
+}
+
+func getDialectOrDefault(driverName string) Dialect {
+	if d := GetDialect(driverName); d != nil {
+		return d
+	}
+	return defaultDialect{}
 }
 
 func (d *DB) DB() *sql.DB {
 	return d.db
 }
 
+// Dialect returns dialect of the driver. It doesn't support upsert if the driver is unknown
+func (d *DB) Dialect() Dialect {
+	return d.dialect
+}
+
 func (d *DB) Exec(query string, args ...any) (sql.Result, error) {
-	return d.db.Exec(query, args...)
+	return d.exe.ExecContext(context.Background(), query, args...)
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.exe.ExecContext(ctx, query, args...)
 }
 
 func (d *DB) MustExec(query string, args ...any) {
-	_, err := d.db.Exec(query, args...)
+	_, err := d.exe.ExecContext(context.Background(), query, args...)
 	if err != nil {
 		panic(err)
 	}
 }
 
 func (d *DB) Begin() (*Tx, error) {
-	tx, err := d.db.Begin()
+	return d.BeginTx(context.Background(), nil)
+}
+
+func (d *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := d.db.BeginTx(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Tx{
 		tx:         tx,
+		exe:        newExecutor(tx, d.options.Interceptors),
 		driverName: d.driverName,
+		dialect:    d.dialect,
 	}, nil
 }
 
@@ -64,68 +101,83 @@ func (d *DB) Table(nameOrRecord any) *Table {
 		name = getTableName(nameOrRecord)
 	}
 
-	return &Table{
-		exe:        d.db,
-		driverName: d.driverName,
-		name:       name,
-	}
+	return newTable(d.exe, d.driverName, d.dialect, name)
+}
+
+func (d *DB) tableOf(name string) *Table {
+	return d.Table(name)
 }
 
 func (d *DB) Insert(record any) error {
-	return d.Table(getTableName(record)).Insert(record)
+	return d.InsertContext(context.Background(), record)
+}
+
+func (d *DB) InsertContext(ctx context.Context, record any) error {
+	return d.Table(getTableName(record)).InsertContext(ctx, record)
 }
 
+// BatchInsert inserts values in a transaction with multi-row statements
 func (d *DB) BatchInsert(values any) error {
-	l := reflect.ValueOf(values)
-	if l.Kind() != reflect.Slice {
-		return errors.New("not slice")
-	}
+	return d.BatchInsertContext(context.Background(), values)
+}
 
-	tx, err := d.Begin()
-	for i := 0; i < l.Len(); i++ {
-		err = tx.Insert(l.Index(i).Interface())
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
+func (d *DB) BatchInsertContext(ctx context.Context, values any) error {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = tx.Table(getTableNameBySlice(values)).BatchInsertContext(ctx, values)
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
 	return tx.Commit()
 }
 
 func (d *DB) Update(record any) error {
-	return d.Table(getTableName(record)).Update(record)
+	return d.UpdateContext(context.Background(), record)
+}
+
+func (d *DB) UpdateContext(ctx context.Context, record any) error {
+	return d.Table(getTableName(record)).UpdateContext(ctx, record)
 }
 
 func (d *DB) BatchUpdate(values any) error {
-	l := reflect.ValueOf(values)
-	if l.Kind() != reflect.Slice {
-		return errors.New("not slice")
-	}
+	return d.BatchUpdateContext(context.Background(), values)
+}
 
-	tx, err := d.Begin()
-	for i := 0; i < l.Len(); i++ {
-		err = tx.Update(l.Index(i).Interface())
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
-	}
-	return tx.Commit()
+func (d *DB) BatchUpdateContext(ctx context.Context, values any) error {
+	return d.forEachInTx(ctx, values, (*Tx).UpdateContext)
 }
 
 func (d *DB) Save(record any) error {
-	return d.Table(getTableName(record)).Save(record)
+	return d.SaveContext(context.Background(), record)
+}
+
+func (d *DB) SaveContext(ctx context.Context, record any) error {
+	return d.Table(getTableName(record)).SaveContext(ctx, record)
 }
 
 func (d *DB) MultiSave(values any) error {
+	return d.MultiSaveContext(context.Background(), values)
+}
+
+func (d *DB) MultiSaveContext(ctx context.Context, values any) error {
+	return d.forEachInTx(ctx, values, (*Tx).SaveContext)
+}
+
+func (d *DB) forEachInTx(ctx context.Context, values any, fn func(tx *Tx, ctx context.Context, record any) error) error {
 	l := reflect.ValueOf(values)
 	if l.Kind() != reflect.Slice {
 		return errors.New("not slice")
 	}
 
-	tx, err := d.Begin()
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
 	for i := 0; i < l.Len(); i++ {
-		err = tx.Save(l.Index(i).Interface())
+		err = fn(tx, ctx, l.Index(i).Interface())
 		if err != nil {
 			tx.Rollback()
 			return err
@@ -135,9 +187,17 @@ func (d *DB) MultiSave(values any) error {
 }
 
 func (d *DB) Select(records any, where string, args ...any) error {
-	return d.Table(getTableNameBySlice(records)).Select(records, where, args...)
+	return d.SelectContext(context.Background(), records, where, args...)
+}
+
+func (d *DB) SelectContext(ctx context.Context, records any, where string, args ...any) error {
+	return d.Table(getTableNameBySlice(records)).SelectContext(ctx, records, where, args...)
 }
 
 func (d *DB) SelectOne(record any, where string, args ...any) error {
-	return d.Table(getTableName(record)).SelectOne(record, where, args...)
+	return d.SelectOneContext(context.Background(), record, where, args...)
+}
+
+func (d *DB) SelectOneContext(ctx context.Context, record any, where string, args ...any) error {
+	return d.Table(getTableName(record)).SelectOneContext(ctx, record, where, args...)
 }
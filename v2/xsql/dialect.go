@@ -0,0 +1,223 @@
+package xsql
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Dialect hides syntax differences between databases
+type Dialect interface {
+	Name() string
+	// Placeholder returns placeholder of the i-th argument, i starts from 1
+	Placeholder(i int) string
+	// Quote quotes identifier, e.g. column name
+	Quote(name string) string
+	// Upsert converts insert statement into upsert statement,
+	// which updates columns on conflict of keys. keys may be empty if they are unknown
+	Upsert(insert string, keys, updates []string) string
+	// SupportsReturning reports whether INSERT ... RETURNING is supported,
+	// otherwise auto increment id is read from sql.Result.LastInsertId
+	SupportsReturning() bool
+	// MaxArgs is the maximum number of arguments in one statement
+	MaxArgs() int
+}
+
+var (
+	MySQLDialect    Dialect = mysqlDialect{}
+	SQLiteDialect   Dialect = sqliteDialect{}
+	PostgresDialect Dialect = postgresDialect{}
+)
+
+var dialects = struct {
+	mu            sync.RWMutex
+	driverToValue map[string]Dialect
+}{
+	driverToValue: map[string]Dialect{
+		"mysql":   MySQLDialect,
+		"sqlite":  SQLiteDialect,
+		"sqlite3": SQLiteDialect,
+		// lib/pq
+		"postgres": PostgresDialect,
+		// jackc/pgx
+		"pgx":    PostgresDialect,
+		"pgx/v5": PostgresDialect,
+	},
+}
+
+// RegisterDialect registers dialect of driverName
+func RegisterDialect(driverName string, d Dialect) {
+	dialects.mu.Lock()
+	dialects.driverToValue[driverName] = d
+	dialects.mu.Unlock()
+}
+
+// GetDialect returns dialect of driverName, or nil if it's unknown
+func GetDialect(driverName string) Dialect {
+	dialects.mu.RLock()
+	defer dialects.mu.RUnlock()
+	return dialects.driverToValue[driverName]
+}
+
+// defaultDialect is used by unknown drivers, which doesn't support upsert
+type defaultDialect struct {
+}
+
+func (d defaultDialect) Name() string {
+	return ""
+}
+
+func (d defaultDialect) Placeholder(i int) string {
+	return "?"
+}
+
+func (d defaultDialect) Quote(name string) string {
+	return name
+}
+
+func (d defaultDialect) Upsert(insert string, keys, updates []string) string {
+	panic("upsert is not supported")
+}
+
+func (d defaultDialect) SupportsReturning() bool {
+	return false
+}
+
+func (d defaultDialect) MaxArgs() int {
+	return 999
+}
+
+type mysqlDialect struct {
+}
+
+func (d mysqlDialect) Name() string {
+	return MYSQL
+}
+
+func (d mysqlDialect) Placeholder(i int) string {
+	return "?"
+}
+
+func (d mysqlDialect) Quote(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func (d mysqlDialect) Upsert(insert string, keys, updates []string) string {
+	var b strings.Builder
+	b.WriteString(insert)
+	b.WriteString(" ON DUPLICATE KEY UPDATE ")
+	if len(updates) == 0 && len(keys) > 0 {
+		// no-op update ignores the conflict
+		c := d.Quote(keys[0])
+		b.WriteString(c + " = " + c)
+		return b.String()
+	}
+	for i, name := range updates {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		c := d.Quote(name)
+		b.WriteString(c + " = VALUES(" + c + ")")
+	}
+	return b.String()
+}
+
+func (d mysqlDialect) SupportsReturning() bool {
+	return false
+}
+
+func (d mysqlDialect) MaxArgs() int {
+	return 65535
+}
+
+type sqliteDialect struct {
+}
+
+func (d sqliteDialect) Name() string {
+	return SQLITE
+}
+
+func (d sqliteDialect) Placeholder(i int) string {
+	return "?"
+}
+
+func (d sqliteDialect) Quote(name string) string {
+	return quoteDoubly(name)
+}
+
+func (d sqliteDialect) Upsert(insert string, keys, updates []string) string {
+	if len(keys) == 0 {
+		return strings.Replace(insert, "INSERT INTO", "INSERT OR REPLACE INTO", 1)
+	}
+	return onConflict(d, insert, keys, updates)
+}
+
+func (d sqliteDialect) SupportsReturning() bool {
+	return false
+}
+
+func (d sqliteDialect) MaxArgs() int {
+	// SQLITE_MAX_VARIABLE_NUMBER of sqlite prior to 3.32.0
+	return 999
+}
+
+type postgresDialect struct {
+}
+
+func (d postgresDialect) Name() string {
+	return POSTGRES
+}
+
+func (d postgresDialect) Placeholder(i int) string {
+	return "$" + strconv.Itoa(i)
+}
+
+func (d postgresDialect) Quote(name string) string {
+	return quoteDoubly(name)
+}
+
+func (d postgresDialect) Upsert(insert string, keys, updates []string) string {
+	if len(keys) == 0 {
+		return insert + " ON CONFLICT DO NOTHING"
+	}
+	return onConflict(d, insert, keys, updates)
+}
+
+func (d postgresDialect) SupportsReturning() bool {
+	return true
+}
+
+func (d postgresDialect) MaxArgs() int {
+	return 65535
+}
+
+func quoteDoubly(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func onConflict(d Dialect, insert string, keys, updates []string) string {
+	var b strings.Builder
+	b.WriteString(insert)
+	b.WriteString(" ON CONFLICT(")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(d.Quote(k))
+	}
+	b.WriteString(")")
+	if len(updates) == 0 {
+		b.WriteString(" DO NOTHING")
+		return b.String()
+	}
+
+	b.WriteString(" DO UPDATE SET ")
+	for i, name := range updates {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		c := d.Quote(name)
+		b.WriteString(c + " = excluded." + c)
+	}
+	return b.String()
+}
@@ -0,0 +1,195 @@
+package xsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"code.olapie.com/sugar/v2/xcontext"
+)
+
+type QueryOp string
+
+const (
+	OpExec     QueryOp = "exec"
+	OpQuery    QueryOp = "query"
+	OpQueryRow QueryOp = "query_row"
+)
+
+// QueryEvent describes a statement executed by DB or Tx
+type QueryEvent struct {
+	Op    QueryOp
+	Query string
+	Args  []any
+	// TraceID is from xcontext.GetTraceID
+	TraceID  string
+	Start    time.Time
+	Duration time.Duration
+	// RowsAffected is -1 if it's unknown, e.g. for queries
+	RowsAffected int64
+	Err          error
+}
+
+// ReadableArgs returns args with redacted values masked and bytes converted to strings
+func (e *QueryEvent) ReadableArgs() []any {
+	l := make([]any, len(e.Args))
+	for i, a := range e.Args {
+		switch v := a.(type) {
+		case RedactedArg:
+			l[i] = redactedText
+		case []byte:
+			l[i] = string(v)
+		default:
+			l[i] = a
+		}
+	}
+	return l
+}
+
+// Interceptor observes statements executed by DB and Tx.
+// Before is called before execution, and the returned context is used for execution.
+// After is called after execution with Duration, RowsAffected and Err set
+type Interceptor interface {
+	Before(ctx context.Context, e *QueryEvent) context.Context
+	After(ctx context.Context, e *QueryEvent)
+}
+
+const redactedText = "[REDACTED]"
+
+// RedactedArg wraps argument whose value is masked in QueryEvent.ReadableArgs.
+// Values of columns tagged with redact, e.g. `sql:"password,redact"`, are wrapped automatically.
+// It's unwrapped by DB and Tx before being passed to driver, so that driver can convert the value natively
+type RedactedArg struct {
+	v any
+}
+
+// Redact wraps v as a RedactedArg
+func Redact(v any) RedactedArg {
+	return RedactedArg{v: v}
+}
+
+// Value is used if RedactedArg is passed to sql.DB directly
+func (r RedactedArg) Value() (driver.Value, error) {
+	return driver.DefaultParameterConverter.ConvertValue(r.v)
+}
+
+func (r RedactedArg) String() string {
+	return redactedText
+}
+
+// SlowQueryInterceptor reports statements which take threshold or longer
+type SlowQueryInterceptor struct {
+	threshold time.Duration
+	report    func(ctx context.Context, e *QueryEvent)
+}
+
+var _ Interceptor = (*SlowQueryInterceptor)(nil)
+
+func NewSlowQueryInterceptor(threshold time.Duration, report func(ctx context.Context, e *QueryEvent)) *SlowQueryInterceptor {
+	return &SlowQueryInterceptor{
+		threshold: threshold,
+		report:    report,
+	}
+}
+
+func (s *SlowQueryInterceptor) Before(ctx context.Context, e *QueryEvent) context.Context {
+	return ctx
+}
+
+func (s *SlowQueryInterceptor) After(ctx context.Context, e *QueryEvent) {
+	if e.Duration >= s.threshold {
+		s.report(ctx, e)
+	}
+}
+
+// unwrapArgs returns args with values of RedactedArg, which are passed to driver
+func unwrapArgs(args []any) []any {
+	var l []any
+	for i, a := range args {
+		r, ok := a.(RedactedArg)
+		if !ok {
+			continue
+		}
+		if l == nil {
+			l = make([]any, len(args))
+			copy(l, args)
+		}
+		l[i] = r.v
+	}
+	if l == nil {
+		return args
+	}
+	return l
+}
+
+// interceptedExecutor calls interceptors around every statement, and unwraps RedactedArg before execution
+type interceptedExecutor struct {
+	exe          ContextExecutor
+	interceptors []Interceptor
+}
+
+func newExecutor(exe ContextExecutor, interceptors []Interceptor) ContextExecutor {
+	return &interceptedExecutor{
+		exe:          exe,
+		interceptors: interceptors,
+	}
+}
+
+func (e *interceptedExecutor) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if len(e.interceptors) == 0 {
+		return e.exe.ExecContext(ctx, query, unwrapArgs(args)...)
+	}
+	ctx, ev := e.before(ctx, OpExec, query, args)
+	result, err := e.exe.ExecContext(ctx, query, unwrapArgs(args)...)
+	if err == nil {
+		if n, rErr := result.RowsAffected(); rErr == nil {
+			ev.RowsAffected = n
+		}
+	}
+	e.after(ctx, ev, err)
+	return result, err
+}
+
+func (e *interceptedExecutor) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if len(e.interceptors) == 0 {
+		return e.exe.QueryContext(ctx, query, unwrapArgs(args)...)
+	}
+	ctx, ev := e.before(ctx, OpQuery, query, args)
+	rows, err := e.exe.QueryContext(ctx, query, unwrapArgs(args)...)
+	e.after(ctx, ev, err)
+	return rows, err
+}
+
+func (e *interceptedExecutor) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if len(e.interceptors) == 0 {
+		return e.exe.QueryRowContext(ctx, query, unwrapArgs(args)...)
+	}
+	ctx, ev := e.before(ctx, OpQueryRow, query, args)
+	row := e.exe.QueryRowContext(ctx, query, unwrapArgs(args)...)
+	e.after(ctx, ev, row.Err())
+	return row
+}
+
+func (e *interceptedExecutor) before(ctx context.Context, op QueryOp, query string, args []any) (context.Context, *QueryEvent) {
+	ev := &QueryEvent{
+		Op:           op,
+		Query:        query,
+		Args:         args,
+		TraceID:      xcontext.GetTraceID(ctx),
+		RowsAffected: -1,
+	}
+	for _, i := range e.interceptors {
+		ctx = i.Before(ctx, ev)
+	}
+	ev.Start = time.Now()
+	return ctx, ev
+}
+
+func (e *interceptedExecutor) after(ctx context.Context, ev *QueryEvent, err error) {
+	ev.Duration = time.Since(ev.Start)
+	ev.Err = err
+	for i := len(e.interceptors) - 1; i >= 0; i-- {
+		e.interceptors[i].After(ctx, ev)
+	}
+}
@@ -0,0 +1,66 @@
+//go:build go1.21
+
+package xsql
+
+import (
+	"context"
+	"log/slog"
+)
+
+type SlogInterceptorOptions struct {
+	// Level of successful statements, failed statements are logged at error level
+	Level slog.Level
+}
+
+// SlogInterceptor logs statements with slog.Logger, masking redacted arguments
+type SlogInterceptor struct {
+	logger  *slog.Logger
+	options SlogInterceptorOptions
+}
+
+var _ Interceptor = (*SlogInterceptor)(nil)
+
+func NewSlogInterceptor(logger *slog.Logger, optFns ...func(options *SlogInterceptorOptions)) *SlogInterceptor {
+	s := &SlogInterceptor{
+		logger: logger,
+		options: SlogInterceptorOptions{
+			Level: slog.LevelDebug,
+		},
+	}
+	for _, fn := range optFns {
+		fn(&s.options)
+	}
+	return s
+}
+
+func (s *SlogInterceptor) Before(ctx context.Context, e *QueryEvent) context.Context {
+	return ctx
+}
+
+func (s *SlogInterceptor) After(ctx context.Context, e *QueryEvent) {
+	level := s.options.Level
+	if e.Err != nil {
+		level = slog.LevelError
+	}
+
+	if !s.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("op", string(e.Op)),
+		slog.String("query", e.Query),
+		slog.Any("args", e.ReadableArgs()),
+		slog.Duration("duration", e.Duration),
+	}
+	if e.TraceID != "" {
+		attrs = append(attrs, slog.String("trace_id", e.TraceID))
+	}
+	if e.RowsAffected >= 0 {
+		attrs = append(attrs, slog.Int64("rows_affected", e.RowsAffected))
+	}
+	if e.Err != nil {
+		attrs = append(attrs, slog.Any("error", e.Err))
+	}
+	s.logger.LogAttrs(ctx, level, "sql", attrs...)
+}
@@ -23,6 +23,15 @@ func JSON(v any) any {
 	return &jsonHolder{v: v}
 }
 
+// JSONText is like JSON, but encodes v as string rather than bytes, e.g. for TEXT columns of sqlite
+func JSONText(v any) any {
+	h := JSON(v)
+	if h == nil {
+		return nil
+	}
+	return &jsonTextHolder{jsonHolder: h.(*jsonHolder)}
+}
+
 type jsonHolder struct {
 	v any
 }
@@ -54,3 +63,18 @@ func (j *jsonHolder) Scan(src any) error {
 func (j *jsonHolder) Value() (driver.Value, error) {
 	return json.Marshal(j.v)
 }
+
+type jsonTextHolder struct {
+	*jsonHolder
+}
+
+var _ driver.Valuer = (*jsonTextHolder)(nil)
+var _ sql.Scanner = (*jsonTextHolder)(nil)
+
+func (j *jsonTextHolder) Value() (driver.Value, error) {
+	b, err := json.Marshal(j.v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
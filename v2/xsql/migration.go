@@ -0,0 +1,471 @@
+package xsql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.olapie.com/sugar/v2/xerror"
+)
+
+const (
+	ErrMigrationDrift   xerror.String = "applied migration is changed"
+	ErrUnknownMigration xerror.String = "applied migration is unknown"
+)
+
+const defaultMigrationTable = "schema_migrations"
+
+// Migration is a versioned schema change.
+// Up and Down are SQL statements, UpFunc and DownFunc are used instead if they are not nil
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	UpFunc   func(ctx context.Context, tx *sql.Tx) error
+	DownFunc func(ctx context.Context, tx *sql.Tx) error
+	// NoTx runs migration without transaction, e.g. CREATE INDEX CONCURRENTLY in postgres
+	NoTx bool
+}
+
+// Checksum is the hash of Up statements, which is empty for UpFunc
+func (m *Migration) Checksum() string {
+	if m.UpFunc != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+type MigrationStatus struct {
+	Migration *Migration
+	Applied   bool
+	// AppliedAt is unix seconds
+	AppliedAt int64
+	// Drifted is true if migration is changed after it's applied
+	Drifted bool
+}
+
+type MigratorOptions struct {
+	// Table records applied migrations, it's schema_migrations by default
+	Table string
+	// DryRun returns migrations to run without running them
+	DryRun bool
+	// AllowDrift doesn't fail if applied migrations are changed
+	AllowDrift bool
+	// Dialect is detected by driver of db if it's nil.
+	// Migrators of PostgresDialect are serialized by advisory lock, otherwise they are serialized in the process
+	Dialect Dialect
+}
+
+// Migrator runs migrations in SQLite or Postgres
+type Migrator struct {
+	db         *sql.DB
+	options    MigratorOptions
+	migrations map[int64]*Migration
+}
+
+func NewMigrator(db *sql.DB, optFns ...func(options *MigratorOptions)) *Migrator {
+	m := &Migrator{
+		db:         db,
+		migrations: map[int64]*Migration{},
+	}
+	for _, fn := range optFns {
+		fn(&m.options)
+	}
+	if m.options.Table == "" {
+		m.options.Table = defaultMigrationTable
+	}
+	if m.options.Dialect == nil {
+		m.options.Dialect = detectDialect(db)
+	}
+	return m
+}
+
+// detectDialect returns dialect by type of driver, e.g. *pq.Driver, or nil if it's unknown
+func detectDialect(db *sql.DB) Dialect {
+	name := fmt.Sprintf("%T", db.Driver())
+	switch {
+	case strings.HasPrefix(name, "*pq."), strings.HasPrefix(name, "*stdlib."):
+		return PostgresDialect
+	case strings.Contains(name, "sqlite"):
+		return SQLiteDialect
+	case strings.HasPrefix(name, "*mysql."):
+		return MySQLDialect
+	default:
+		return nil
+	}
+}
+
+func (m *Migrator) Add(migrations ...*Migration) error {
+	for _, mig := range migrations {
+		if mig.Version <= 0 {
+			return fmt.Errorf("invalid version: %d", mig.Version)
+		}
+		if _, ok := m.migrations[mig.Version]; ok {
+			return fmt.Errorf("duplicate version: %d", mig.Version)
+		}
+		m.migrations[mig.Version] = mig
+	}
+	return nil
+}
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(.+?)(\.up|\.down)?\.sql$`)
+
+// AddFS adds migrations from sql files in root directory of fsys.
+// Files are named as {version}_{name}.up.sql and {version}_{name}.down.sql, e.g. 0001_create_users.up.sql.
+// File without .up or .down is regarded as up migration
+func (m *Migrator) AddFS(fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("read dir: %w", err)
+	}
+
+	migrations := map[int64]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		matches := migrationFileRegexp.FindStringSubmatch(e.Name())
+		if matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("parse version: %s, %w", e.Name(), err)
+		}
+
+		content, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return fmt.Errorf("read file %s: %w", e.Name(), err)
+		}
+
+		mig := migrations[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: matches[2]}
+			migrations[version] = mig
+		} else if mig.Name != matches[2] {
+			return fmt.Errorf("different names of version %d: %s, %s", version, mig.Name, matches[2])
+		}
+
+		if matches[3] == ".down" {
+			mig.Down = string(content)
+		} else {
+			mig.Up = string(content)
+		}
+	}
+
+	for _, mig := range migrations {
+		if mig.Up == "" {
+			return fmt.Errorf("no up migration: %s", mig)
+		}
+		if err = m.Add(mig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Version returns the latest applied version, or 0 if no migration is applied
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	applied, err := m.loadApplied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// Status returns status of all known migrations in ascending order of version
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	applied, err := m.loadApplied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var l []*MigrationStatus
+	for _, mig := range m.sorted() {
+		s := &MigrationStatus{Migration: mig}
+		if a, ok := applied[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.appliedAt
+			s.Drifted = isDrifted(mig, a)
+		}
+		l = append(l, s)
+	}
+	return l, nil
+}
+
+// Up applies all pending migrations, and returns them
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	return m.MigrateTo(ctx, -1)
+}
+
+// MigrateTo applies pending migrations up to target version, or reverts applied migrations after target version.
+// Negative target means the latest version, and 0 reverts all migrations
+func (m *Migrator) MigrateTo(ctx context.Context, target int64) ([]*Migration, error) {
+	if !m.options.DryRun {
+		// applied migrations are read under the lock, so that they are not applied by another migrator meanwhile
+		unlock, err := m.lock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	applied, err := m.loadApplied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := m.sorted()
+	for _, mig := range sorted {
+		if a, ok := applied[mig.Version]; ok && isDrifted(mig, a) && !m.options.AllowDrift {
+			return nil, fmt.Errorf("%s: %w", mig, ErrMigrationDrift)
+		}
+	}
+
+	var downs []*Migration
+	for version := range applied {
+		if target >= 0 && version > target {
+			mig, ok := m.migrations[version]
+			if !ok {
+				return nil, fmt.Errorf("version %d: %w", version, ErrUnknownMigration)
+			}
+			downs = append(downs, mig)
+		}
+	}
+	sort.Slice(downs, func(i, j int) bool {
+		return downs[i].Version > downs[j].Version
+	})
+
+	var ups []*Migration
+	for _, mig := range sorted {
+		if _, ok := applied[mig.Version]; !ok && (target < 0 || mig.Version <= target) {
+			ups = append(ups, mig)
+		}
+	}
+
+	if m.options.DryRun {
+		return append(downs, ups...), nil
+	}
+
+	var done []*Migration
+	for _, mig := range downs {
+		if err = m.run(ctx, mig, false); err != nil {
+			return done, fmt.Errorf("revert %s: %w", mig, err)
+		}
+		done = append(done, mig)
+	}
+
+	for _, mig := range ups {
+		if err = m.run(ctx, mig, true); err != nil {
+			return done, fmt.Errorf("apply %s: %w", mig, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+type migrationLockKey struct {
+	db    *sql.DB
+	table string
+}
+
+// migrationLocks serializes migrators of the same table in the process
+var migrationLocks sync.Map
+
+// lock prevents other migrators of the same table from running, and returns the function to release it
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	if m.options.Dialect != nil && m.options.Dialect.Name() == POSTGRES {
+		return m.lockPostgres(ctx)
+	}
+	v, _ := migrationLocks.LoadOrStore(migrationLockKey{db: m.db, table: m.options.Table}, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock, nil
+}
+
+// lockPostgres takes session level advisory lock, which is released when the connection is closed
+func (m *Migrator) lockPostgres(ctx context.Context) (func(), error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get connection: %w", err)
+	}
+	hash := sha256.Sum256([]byte("xsql.migration." + m.options.Table))
+	key := int64(binary.BigEndian.Uint64(hash[:8]))
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("lock %s: %w", m.options.Table, err)
+	}
+	return func() {
+		// ctx may be done, which mustn't keep the lock in a pooled connection
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key); err != nil {
+			// returning driver.ErrBadConn closes the connection rather than putting it back to the pool
+			conn.Raw(func(any) error {
+				return driver.ErrBadConn
+			})
+		}
+		conn.Close()
+	}, nil
+}
+
+func (m *Migrator) run(ctx context.Context, mig *Migration, up bool) error {
+	if mig.NoTx {
+		if err := m.exec(ctx, m.db, nil, mig, up); err != nil {
+			return err
+		}
+		return m.record(ctx, m.db, mig, up)
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = m.exec(ctx, tx, tx, mig, up); err != nil {
+		return err
+	}
+
+	if err = m.record(ctx, tx, mig, up); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type contextExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (m *Migrator) exec(ctx context.Context, e contextExecutor, tx *sql.Tx, mig *Migration, up bool) error {
+	fn, query := mig.DownFunc, mig.Down
+	if up {
+		fn, query = mig.UpFunc, mig.Up
+	}
+
+	if fn != nil {
+		if tx == nil {
+			return fmt.Errorf("func of %s requires transaction", mig)
+		}
+		return fn(ctx, tx)
+	}
+
+	if query == "" {
+		if up {
+			return nil
+		}
+		return fmt.Errorf("no down migration: %s", mig)
+	}
+
+	if _, err := e.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Migrator) record(ctx context.Context, e contextExecutor, mig *Migration, up bool) error {
+	var err error
+	if up {
+		_, err = e.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s(version, name, checksum, applied_at) VALUES($1,$2,$3,$4)`,
+			m.options.Table), mig.Version, mig.Name, mig.Checksum(), time.Now().Unix())
+	} else {
+		_, err = e.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE version=$1`, m.options.Table), mig.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("update %s: %w", m.options.Table, err)
+	}
+	return nil
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt int64
+}
+
+// loadApplied creates migration table if it doesn't exist, and returns applied migrations.
+// In dry run, the table is created in a transaction which is rolled back
+func (m *Migrator) loadApplied(ctx context.Context) (map[int64]*appliedMigration, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
+version BIGINT PRIMARY KEY,
+name VARCHAR(255) NOT NULL,
+checksum VARCHAR(64) NOT NULL,
+applied_at BIGINT NOT NULL
+)`, m.options.Table))
+	if err != nil {
+		return nil, fmt.Errorf("create table %s: %w", m.options.Table, err)
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT version, checksum, applied_at FROM %s`, m.options.Table))
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %w", m.options.Table, err)
+	}
+	defer rows.Close()
+
+	applied := map[int64]*appliedMigration{}
+	for rows.Next() {
+		var version int64
+		var a appliedMigration
+		if err = rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		applied[version] = &a
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+	rows.Close()
+
+	if m.options.DryRun {
+		return applied, nil
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return applied, nil
+}
+
+func (m *Migrator) sorted() []*Migration {
+	l := make([]*Migration, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		l = append(l, mig)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Version < l[j].Version
+	})
+	return l
+}
+
+func isDrifted(mig *Migration, a *appliedMigration) bool {
+	checksum := mig.Checksum()
+	return checksum != "" && a.checksum != "" && checksum != a.checksum
+}
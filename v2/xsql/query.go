@@ -0,0 +1,281 @@
+package xsql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"code.olapie.com/sugar/v2/xerror"
+)
+
+const ErrUnknownColumn xerror.String = "unknown column"
+
+// Condition is a predicate in WHERE clause
+type Condition struct {
+	column string
+	op     string
+	values []any
+	// subs are joined by op if column is empty
+	subs []*Condition
+}
+
+func Eq(column string, value any) *Condition {
+	return newCondition(column, "=", value)
+}
+
+func Ne(column string, value any) *Condition {
+	return newCondition(column, "<>", value)
+}
+
+func Gt(column string, value any) *Condition {
+	return newCondition(column, ">", value)
+}
+
+func Gte(column string, value any) *Condition {
+	return newCondition(column, ">=", value)
+}
+
+func Lt(column string, value any) *Condition {
+	return newCondition(column, "<", value)
+}
+
+func Lte(column string, value any) *Condition {
+	return newCondition(column, "<=", value)
+}
+
+func Like(column string, pattern string) *Condition {
+	return newCondition(column, "LIKE", pattern)
+}
+
+// In matches any of values. It matches nothing if values is empty
+func In(column string, values ...any) *Condition {
+	return newCondition(column, "IN", values...)
+}
+
+func IsNull(column string) *Condition {
+	return newCondition(column, "IS NULL")
+}
+
+func IsNotNull(column string) *Condition {
+	return newCondition(column, "IS NOT NULL")
+}
+
+func And(conditions ...*Condition) *Condition {
+	return &Condition{op: "AND", subs: conditions}
+}
+
+func Or(conditions ...*Condition) *Condition {
+	return &Condition{op: "OR", subs: conditions}
+}
+
+func newCondition(column, op string, values ...any) *Condition {
+	return &Condition{
+		column: column,
+		op:     op,
+		values: values,
+	}
+}
+
+func (c *Condition) validate(info *columnInfo) error {
+	if c.column == "" {
+		for _, sub := range c.subs {
+			if err := sub.validate(info); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if _, ok := info.nameToIndex[c.column]; !ok {
+		return fmt.Errorf("%s: %w", c.column, ErrUnknownColumn)
+	}
+	return nil
+}
+
+func (c *Condition) build(b *strings.Builder, d Dialect, args *[]any) {
+	if c.column == "" {
+		if len(c.subs) == 0 {
+			// empty AND is true, and empty OR is false
+			if c.op == "AND" {
+				b.WriteString("1 = 1")
+			} else {
+				b.WriteString("1 = 0")
+			}
+			return
+		}
+
+		b.WriteString("(")
+		for i, sub := range c.subs {
+			if i > 0 {
+				b.WriteString(" " + c.op + " ")
+			}
+			sub.build(b, d, args)
+		}
+		b.WriteString(")")
+		return
+	}
+
+	switch c.op {
+	case "IS NULL", "IS NOT NULL":
+		b.WriteString(d.Quote(c.column) + " " + c.op)
+	case "IN":
+		if len(c.values) == 0 {
+			b.WriteString("1 = 0")
+			return
+		}
+		b.WriteString(d.Quote(c.column) + " IN (")
+		for i, v := range c.values {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			*args = append(*args, v)
+			b.WriteString(d.Placeholder(len(*args)))
+		}
+		b.WriteString(")")
+	default:
+		*args = append(*args, c.values[0])
+		b.WriteString(d.Quote(c.column) + " " + c.op + " " + d.Placeholder(len(*args)))
+	}
+}
+
+// Queryable is implemented by DB and Tx
+type Queryable interface {
+	tableOf(name string) *Table
+}
+
+// QueryBuilder builds SELECT statement of table of T, whose column names are validated against T.
+// T is a struct or pointer to struct
+type QueryBuilder[T any] struct {
+	table      *Table
+	info       *columnInfo
+	conditions []*Condition
+	orders     []string
+	limit      int
+	offset     int
+	err        error
+}
+
+func Query[T any](q Queryable) *QueryBuilder[T] {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	elemType := typ
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		panic("not struct: " + typ.String())
+	}
+
+	return &QueryBuilder[T]{
+		table: q.tableOf(getTableNameByType(typ)),
+		info:  getColumnInfo(elemType),
+	}
+}
+
+// Where adds conditions which are joined by AND
+func (q *QueryBuilder[T]) Where(conditions ...*Condition) *QueryBuilder[T] {
+	for _, c := range conditions {
+		if err := c.validate(q.info); err != nil && q.err == nil {
+			q.err = err
+		}
+	}
+	q.conditions = append(q.conditions, conditions...)
+	return q
+}
+
+func (q *QueryBuilder[T]) OrderBy(column string) *QueryBuilder[T] {
+	return q.orderBy(column, "ASC")
+}
+
+func (q *QueryBuilder[T]) OrderByDesc(column string) *QueryBuilder[T] {
+	return q.orderBy(column, "DESC")
+}
+
+func (q *QueryBuilder[T]) orderBy(column, order string) *QueryBuilder[T] {
+	if _, ok := q.info.nameToIndex[column]; !ok && q.err == nil {
+		q.err = fmt.Errorf("%s: %w", column, ErrUnknownColumn)
+	}
+	q.orders = append(q.orders, q.table.dialect.Quote(column)+" "+order)
+	return q
+}
+
+// Limit is unlimited if n is not positive
+func (q *QueryBuilder[T]) Limit(n int) *QueryBuilder[T] {
+	q.limit = n
+	return q
+}
+
+func (q *QueryBuilder[T]) Offset(n int) *QueryBuilder[T] {
+	q.offset = n
+	return q
+}
+
+// All returns all records matching conditions
+func (q *QueryBuilder[T]) All(ctx context.Context) ([]T, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	clause, args := q.build(q.limit, true)
+	var l []T
+	if err := q.table.selectContext(ctx, &l, clause, args); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// One returns the first record matching conditions, or sql.ErrNoRows if there is none
+func (q *QueryBuilder[T]) One(ctx context.Context) (T, error) {
+	var record T
+	if q.err != nil {
+		return record, q.err
+	}
+	clause, args := q.build(1, true)
+	err := q.table.selectOneContext(ctx, &record, clause, args)
+	return record, err
+}
+
+// Count returns number of records matching conditions, ignoring order, limit and offset
+func (q *QueryBuilder[T]) Count(ctx context.Context) (int, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	clause, args := q.build(0, false)
+	return q.table.countContext(ctx, clause, args)
+}
+
+func (q *QueryBuilder[T]) build(limit int, paging bool) (string, []any) {
+	var b strings.Builder
+	var args []any
+	if len(q.conditions) > 0 {
+		b.WriteString(" WHERE ")
+		for i, c := range q.conditions {
+			if i > 0 {
+				b.WriteString(" AND ")
+			}
+			c.build(&b, q.table.dialect, &args)
+		}
+	}
+
+	if !paging {
+		return b.String(), args
+	}
+
+	if len(q.orders) > 0 {
+		b.WriteString(" ORDER BY ")
+		b.WriteString(strings.Join(q.orders, ", "))
+	}
+
+	if limit > 0 || q.offset > 0 {
+		if limit <= 0 {
+			// OFFSET without LIMIT isn't supported by all databases
+			limit = math.MaxInt
+		}
+		b.WriteString(" LIMIT " + strconv.Itoa(limit))
+		if q.offset > 0 {
+			b.WriteString(" OFFSET " + strconv.Itoa(q.offset))
+		}
+	}
+	return b.String(), args
+}
@@ -2,6 +2,7 @@ package xsql
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"io/fs"
@@ -29,6 +30,12 @@ type Executor interface {
 	QueryRow(query string, args ...any) *sql.Row
 }
 
+type ContextExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 func MustPrepare(db *sql.DB, format string, args ...any) *sql.Stmt {
 	query := fmt.Sprintf(format, args...)
 	return must.Get(db.Prepare(query))
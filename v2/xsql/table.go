@@ -2,8 +2,10 @@ package xsql
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -61,38 +63,76 @@ func getTableNameByType(typ reflect.Type) string {
 }
 
 type Table struct {
-	exe        Executor
+	exe        ContextExecutor
 	driverName string
+	dialect    Dialect
 	name       string
 }
 
-func (t *Table) Insert(record any) error {
-	query, values, err := t.prepareInsertQuery(record)
-	if err != nil {
-		fmt.Println(err)
-		return err
+func newTable(exe ContextExecutor, driverName string, dialect Dialect, name string) *Table {
+	return &Table{
+		exe:        exe,
+		driverName: driverName,
+		dialect:    dialect,
+		name:       name,
 	}
+}
 
-	if Debug {
-		fmt.Println(query, toReadableArgs(values))
-	}
+func (t *Table) Insert(record any) error {
+	return t.InsertContext(context.Background(), record)
+}
 
-	result, err := t.exe.Exec(query, values...)
+func (t *Table) InsertContext(ctx context.Context, record any) error {
+	query, values, err := t.prepareInsertQuery(record)
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
+	return t.execInsert(ctx, record, query, values)
+}
+
+// execInsert executes insert query, and sets the auto increment field of record if it's zero
+func (t *Table) execInsert(ctx context.Context, record any, query string, values []any) error {
 	v := getStructValue(record)
 	info := getColumnInfo(v.Type())
-	if len(info.aiName) > 0 && v.FieldByIndex(info.nameToIndex[info.aiName]).Int() == 0 {
-		id, err := result.LastInsertId()
+	if len(info.aiName) == 0 || v.FieldByIndex(info.nameToIndex[info.aiName]).Int() != 0 {
+		if Debug {
+			fmt.Println(query, toReadableArgs(values))
+		}
+		_, err := t.exe.ExecContext(ctx, query, values...)
 		if err != nil {
 			fmt.Println(err)
-			return err
 		}
-		v.FieldByIndex(info.nameToIndex[info.aiName]).SetInt(id)
+		return err
 	}
 
+	var id int64
+	if t.dialect.SupportsReturning() {
+		query += " RETURNING " + t.dialect.Quote(info.aiName)
+		if Debug {
+			fmt.Println(query, toReadableArgs(values))
+		}
+		err := t.exe.QueryRowContext(ctx, query, values...).Scan(&id)
+		if err != nil {
+			fmt.Println(err)
+			return err
+		}
+	} else {
+		if Debug {
+			fmt.Println(query, toReadableArgs(values))
+		}
+		result, err := t.exe.ExecContext(ctx, query, values...)
+		if err != nil {
+			fmt.Println(err)
+			return err
+		}
+		id, err = result.LastInsertId()
+		if err != nil {
+			fmt.Println(err)
+			return err
+		}
+	}
+	v.FieldByIndex(info.nameToIndex[info.aiName]).SetInt(id)
 	return nil
 }
 
@@ -115,26 +155,166 @@ func (t *Table) prepareInsertQuery(record any) (string, []any, error) {
 		}
 		values = append(values, fv)
 	}
+	return t.buildInsertQuery(columns, 1), values, nil
+}
 
+// buildInsertQuery returns statement which inserts numRows rows
+func (t *Table) buildInsertQuery(columns []string, numRows int) string {
 	var buf bytes.Buffer
 	buf.WriteString("INSERT INTO ")
 	buf.WriteString(t.name)
 	buf.WriteString("(")
-	buf.WriteString(strings.Join(columns, ", "))
-	buf.WriteString(") VALUES (")
-	buf.WriteString(strings.Repeat("?, ", len(columns)))
-	buf.Truncate(buf.Len() - 2)
-	buf.WriteString(")")
-	return buf.String(), values, nil
+	buf.WriteString(t.quoteNames(columns))
+	buf.WriteString(") VALUES ")
+	n := 0
+	for i := 0; i < numRows; i++ {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString("(")
+		for j := range columns {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			n++
+			buf.WriteString(t.dialect.Placeholder(n))
+		}
+		buf.WriteString(")")
+	}
+	return buf.String()
+}
+
+// BatchInsert inserts records in multi-row statements.
+// If auto increment fields are zero, they are set by RETURNING clause,
+// or records are inserted one by one if dialect doesn't support RETURNING
+func (t *Table) BatchInsert(records any) error {
+	return t.BatchInsertContext(context.Background(), records)
+}
+
+func (t *Table) BatchInsertContext(ctx context.Context, records any) error {
+	l := reflect.ValueOf(records)
+	for l.Kind() == reflect.Ptr {
+		l = l.Elem()
+	}
+	if l.Kind() != reflect.Slice {
+		return errors.New("not slice")
+	}
+	if l.Len() == 0 {
+		return nil
+	}
+
+	items := make([]reflect.Value, l.Len())
+	for i := range items {
+		items[i] = l.Index(i)
+		for items[i].Kind() == reflect.Ptr {
+			items[i] = items[i].Elem()
+		}
+		if items[i].Kind() != reflect.Struct {
+			panic("not struct: " + items[i].Kind().String())
+		}
+	}
+
+	info := getColumnInfo(items[0].Type())
+	numZeroAI := 0
+	if len(info.aiName) > 0 {
+		for _, item := range items {
+			if item.FieldByIndex(info.nameToIndex[info.aiName]).Int() == 0 {
+				numZeroAI++
+			}
+		}
+	}
+
+	columns := info.names
+	switch {
+	case numZeroAI == 0:
+		break
+	case numZeroAI == len(items) && t.dialect.SupportsReturning():
+		columns = info.notAINames
+	default:
+		for _, item := range items {
+			if err := t.InsertContext(ctx, item.Addr().Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	batchSize := t.dialect.MaxArgs() / len(columns)
+	if batchSize == 0 {
+		batchSize = 1
+	}
+	for start := 0; start < len(items); start += batchSize {
+		end := start + batchSize
+		if end > len(items) {
+			end = len(items)
+		}
+		batch := items[start:end]
+		args := make([]any, 0, len(batch)*len(columns))
+		for _, item := range batch {
+			for _, name := range columns {
+				fv, err := t.getFieldValueByName(item, info, name)
+				if err != nil {
+					return err
+				}
+				args = append(args, fv)
+			}
+		}
+
+		query := t.buildInsertQuery(columns, len(batch))
+		if numZeroAI == 0 {
+			if Debug {
+				fmt.Println(query, toReadableArgs(args))
+			}
+			if _, err := t.exe.ExecContext(ctx, query, args...); err != nil {
+				fmt.Println(err)
+				return err
+			}
+			continue
+		}
+
+		if err := t.insertReturning(ctx, query, args, info, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertReturning executes multi-row insert query, and sets auto increment fields of items in order
+func (t *Table) insertReturning(ctx context.Context, query string, args []any, info *columnInfo, items []reflect.Value) error {
+	query += " RETURNING " + t.dialect.Quote(info.aiName)
+	if Debug {
+		fmt.Println(query, toReadableArgs(args))
+	}
+	rows, err := t.exe.QueryContext(ctx, query, args...)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	defer rows.Close()
+	for i := 0; rows.Next(); i++ {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return err
+		}
+		if i < len(items) {
+			items[i].FieldByIndex(info.nameToIndex[info.aiName]).SetInt(id)
+		}
+	}
+	return rows.Err()
 }
 
 func (t *Table) Update(record any) error {
+	return t.UpdateContext(context.Background(), record)
+}
+
+func (t *Table) UpdateContext(ctx context.Context, record any) error {
 	v := getStructValue(record)
 	info := getColumnInfo(v.Type())
 	if len(info.pkNames) == 0 {
 		panic("no primary key. please use Insert operation")
 	}
 
+	n := 0
 	var buf bytes.Buffer
 	buf.WriteString("UPDATE ")
 	buf.WriteString(t.name)
@@ -143,8 +323,10 @@ func (t *Table) Update(record any) error {
 		if i > 0 {
 			buf.WriteString(", ")
 		}
-		buf.WriteString(c)
-		buf.WriteString(" = ?")
+		n++
+		buf.WriteString(t.dialect.Quote(c))
+		buf.WriteString(" = ")
+		buf.WriteString(t.dialect.Placeholder(n))
 	}
 
 	buf.WriteString(" WHERE ")
@@ -152,8 +334,10 @@ func (t *Table) Update(record any) error {
 		if i > 0 {
 			buf.WriteString(" and ")
 		}
-		buf.WriteString(c)
-		buf.WriteString(" = ?")
+		n++
+		buf.WriteString(t.dialect.Quote(c))
+		buf.WriteString(" = ")
+		buf.WriteString(t.dialect.Placeholder(n))
 	}
 
 	args := make([]any, 0, len(info.indexes))
@@ -173,97 +357,48 @@ func (t *Table) Update(record any) error {
 	if Debug {
 		fmt.Println(query, toReadableArgs(args))
 	}
-	_, err := t.exe.Exec(query, args...)
+	_, err := t.exe.ExecContext(ctx, query, args...)
 	return err
 }
 
+// Save inserts record, or updates it on conflict of primary key.
+// Column created_at is not updated
 func (t *Table) Save(record any) error {
-	switch t.driverName {
-	case "mysql":
-		return t.mysqlSave(record)
-	case "sqlite3":
-		return t.sqliteSave(record)
-	default:
-		panic("Save operation is not supported for driver: " + t.driverName)
-	}
+	return t.SaveContext(context.Background(), record)
 }
 
-func (t *Table) mysqlSave(record any) error {
-	query, values, err := t.prepareInsertQuery(record)
-	if err != nil {
-		fmt.Println(err)
-		return err
-	}
-
-	v := getStructValue(record)
-	info := getColumnInfo(v.Type())
-
-	var buf bytes.Buffer
-	buf.WriteString(query)
-	buf.WriteString(" ON DUPLICATE KEY UPDATE ")
-	for i, name := range info.notPKNames {
-		if name == "created_at" {
-			continue
-		}
-
-		if i > 0 {
-			buf.WriteString(", ")
-		}
-		buf.WriteString(name)
-		buf.WriteString(" = ?")
-		fv, err := t.getFieldValueByName(v, info, name)
-		if err != nil {
-			return err
-		}
-		values = append(values, fv)
-	}
-
-	query = buf.String()
-
-	if Debug {
-		fmt.Println(query, toReadableArgs(values))
+func (t *Table) SaveContext(ctx context.Context, record any) error {
+	if _, ok := t.dialect.(defaultDialect); ok {
+		return fmt.Errorf("save is not supported by driver: %s", t.driverName)
 	}
 
-	result, err := t.exe.Exec(query, values...)
-	if len(info.aiName) > 0 && v.FieldByIndex(info.nameToIndex[info.aiName]).Int() == 0 {
-		id, err := result.LastInsertId()
-		if err != nil {
-			fmt.Println(err)
-			return err
-		}
-		v.FieldByIndex(info.nameToIndex[info.aiName]).SetInt(id)
-	}
-	return err
-}
-
-func (t *Table) sqliteSave(record any) error {
 	query, values, err := t.prepareInsertQuery(record)
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
 
-	query = strings.Replace(query, "INSERT INTO", "INSERT OR REPLACE INTO", 1)
-	v := getStructValue(record)
-	info := getColumnInfo(v.Type())
-
-	if Debug {
-		fmt.Println(query, toReadableArgs(values))
-	}
-
-	result, err := t.exe.Exec(query, values...)
-	if len(info.aiName) > 0 && v.FieldByIndex(info.nameToIndex[info.aiName]).Int() == 0 {
-		id, err := result.LastInsertId()
-		if err != nil {
-			fmt.Println(err)
-			return err
+	info := getColumnInfo(getStructValue(record).Type())
+	updates := make([]string, 0, len(info.notPKNames))
+	for _, name := range info.notPKNames {
+		if name != "created_at" {
+			updates = append(updates, name)
 		}
-		v.FieldByIndex(info.nameToIndex[info.aiName]).SetInt(id)
 	}
-	return err
+	query = t.dialect.Upsert(query, info.pkNames, updates)
+	return t.execInsert(ctx, record, query, values)
 }
 
 func (t *Table) Select(records any, where string, args ...any) error {
+	return t.SelectContext(context.Background(), records, where, args...)
+}
+
+func (t *Table) SelectContext(ctx context.Context, records any, where string, args ...any) error {
+	return t.selectContext(ctx, records, whereClause(where), args)
+}
+
+// selectContext selects records with clause which follows the FROM clause
+func (t *Table) selectContext(ctx context.Context, records any, clause string, args []any) error {
 	v := reflect.ValueOf(records)
 	if v.Kind() != reflect.Ptr {
 		panic("must be a pointer to slice")
@@ -293,20 +428,17 @@ func (t *Table) Select(records any, where string, args ...any) error {
 
 	var buf bytes.Buffer
 	buf.WriteString("SELECT ")
-	buf.WriteString(strings.Join(fi.names, ", "))
+	buf.WriteString(t.quoteNames(fi.names))
 	buf.WriteString(" FROM ")
 	buf.WriteString(t.name)
-	if len(where) > 0 {
-		buf.WriteString(" WHERE ")
-		buf.WriteString(where)
-	}
+	buf.WriteString(clause)
 	query := buf.String()
 
 	if Debug {
 		fmt.Println(query, toReadableArgs(args))
 	}
 
-	rows, err := t.exe.Query(query, args...)
+	rows, err := t.exe.QueryContext(ctx, query, args...)
 	if err != nil {
 		fmt.Println(err)
 		return err
@@ -403,6 +535,14 @@ func (t *Table) Select(records any, where string, args ...any) error {
 }
 
 func (t *Table) SelectOne(record any, where string, args ...any) error {
+	return t.SelectOneContext(context.Background(), record, where, args...)
+}
+
+func (t *Table) SelectOneContext(ctx context.Context, record any, where string, args ...any) error {
+	return t.selectOneContext(ctx, record, whereClause(where), args)
+}
+
+func (t *Table) selectOneContext(ctx context.Context, record any, clause string, args []any) error {
 	rv := reflect.ValueOf(record)
 	if rv.Kind() != reflect.Ptr {
 		panic("not pointer to a struct")
@@ -423,13 +563,10 @@ func (t *Table) SelectOne(record any, where string, args ...any) error {
 
 	var buf bytes.Buffer
 	buf.WriteString("SELECT ")
-	buf.WriteString(strings.Join(info.names, ", "))
+	buf.WriteString(t.quoteNames(info.names))
 	buf.WriteString(" FROM ")
 	buf.WriteString(t.name)
-	if len(where) > 0 {
-		buf.WriteString(" WHERE ")
-		buf.WriteString(where)
-	}
+	buf.WriteString(clause)
 	query := buf.String()
 
 	if Debug {
@@ -463,7 +600,7 @@ func (t *Table) SelectOne(record any, where string, args ...any) error {
 			fieldAddrs[i] = elem.FieldByIndex(idx).Addr().Interface()
 		}
 	}
-	err := t.exe.QueryRow(query, args...).Scan(fieldAddrs...)
+	err := t.exe.QueryRowContext(ctx, query, args...).Scan(fieldAddrs...)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			fmt.Println(err)
@@ -527,6 +664,10 @@ func (t *Table) Query(query string, args ...any) (*Rows, error) {
 }*/
 
 func (t *Table) Delete(where string, args ...any) error {
+	return t.DeleteContext(context.Background(), where, args...)
+}
+
+func (t *Table) DeleteContext(ctx context.Context, where string, args ...any) error {
 	if len(where) == 0 {
 		panic("where is empty")
 	}
@@ -542,7 +683,7 @@ func (t *Table) Delete(where string, args ...any) error {
 		fmt.Println(query, toReadableArgs(args))
 	}
 
-	_, err := t.exe.Exec(query, args...)
+	_, err := t.exe.ExecContext(ctx, query, args...)
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -550,13 +691,18 @@ func (t *Table) Delete(where string, args ...any) error {
 }
 
 func (t *Table) Count(where string, args ...any) (int, error) {
+	return t.CountContext(context.Background(), where, args...)
+}
+
+func (t *Table) CountContext(ctx context.Context, where string, args ...any) (int, error) {
+	return t.countContext(ctx, whereClause(where), args)
+}
+
+func (t *Table) countContext(ctx context.Context, clause string, args []any) (int, error) {
 	var buf bytes.Buffer
 	buf.WriteString("SELECT COUNT(*) FROM ")
 	buf.WriteString(t.name)
-	if len(where) > 0 {
-		buf.WriteString(" WHERE ")
-		buf.WriteString(where)
-	}
+	buf.WriteString(clause)
 	query := buf.String()
 
 	if Debug {
@@ -564,7 +710,7 @@ func (t *Table) Count(where string, args ...any) (int, error) {
 	}
 
 	var count int
-	err := t.exe.QueryRow(query, args...).Scan(&count)
+	err := t.exe.QueryRowContext(ctx, query, args...).Scan(&count)
 	if err != nil {
 		fmt.Println(err)
 		return 0, err
@@ -574,6 +720,17 @@ func (t *Table) Count(where string, args ...any) (int, error) {
 }
 
 func (t *Table) getFieldValueByName(item reflect.Value, info *columnInfo, name string) (any, error) {
+	v, err := getColumnValue(item, info, name)
+	if err != nil {
+		return nil, err
+	}
+	if IndexOfString(info.redactedNames, name) >= 0 {
+		return Redact(v), nil
+	}
+	return v, nil
+}
+
+func getColumnValue(item reflect.Value, info *columnInfo, name string) (any, error) {
 	k := item.FieldByIndex(info.nameToIndex[name]).Interface()
 	if IndexOfString(info.jsonNames, name) >= 0 {
 		data, err := json.Marshal(k)
@@ -595,6 +752,21 @@ func (t *Table) getFieldValueByName(item reflect.Value, info *columnInfo, name s
 	}
 }
 
+func whereClause(where string) string {
+	if len(where) == 0 {
+		return ""
+	}
+	return " WHERE " + where
+}
+
+func (t *Table) quoteNames(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = t.dialect.Quote(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
 func toReadableArgs(args []any) []any {
 	if Debug {
 		readableArgs := make([]any, len(args))
@@ -1,12 +1,20 @@
 package xsql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
 )
 
 type Tx struct {
 	tx         *sql.Tx
+	exe        ContextExecutor
 	driverName string
+	dialect    Dialect
 }
 
 func (t *Tx) Commit() error {
@@ -18,33 +26,209 @@ func (t *Tx) Rollback() error {
 }
 
 func (t *Tx) Table(name string) *Table {
-	return &Table{
-		exe:        t.tx,
-		driverName: t.driverName,
-		name:       name,
-	}
+	return newTable(t.exe, t.driverName, t.dialect, name)
+}
+
+func (t *Tx) tableOf(name string) *Table {
+	return t.Table(name)
 }
 
 func (t *Tx) Insert(record any) error {
-	return t.Table(getTableName(record)).Insert(record)
+	return t.InsertContext(context.Background(), record)
+}
+
+func (t *Tx) InsertContext(ctx context.Context, record any) error {
+	return t.Table(getTableName(record)).InsertContext(ctx, record)
 }
 
 func (t *Tx) Update(record any) error {
-	return t.Table(getTableName(record)).Update(record)
+	return t.UpdateContext(context.Background(), record)
+}
+
+func (t *Tx) UpdateContext(ctx context.Context, record any) error {
+	return t.Table(getTableName(record)).UpdateContext(ctx, record)
 }
 
 func (t *Tx) Save(record any) error {
-	return t.Table(getTableName(record)).Save(record)
+	return t.SaveContext(context.Background(), record)
+}
+
+func (t *Tx) SaveContext(ctx context.Context, record any) error {
+	return t.Table(getTableName(record)).SaveContext(ctx, record)
 }
 
 func (t *Tx) Select(records any, where string, args ...any) error {
-	return t.Table(getTableNameBySlice(records)).Select(records, where, args...)
+	return t.SelectContext(context.Background(), records, where, args...)
+}
+
+func (t *Tx) SelectContext(ctx context.Context, records any, where string, args ...any) error {
+	return t.Table(getTableNameBySlice(records)).SelectContext(ctx, records, where, args...)
 }
 
 func (t *Tx) SelectOne(record any, where string, args ...any) error {
-	return t.Table(getTableName(record)).SelectOne(record, where, args...)
+	return t.SelectOneContext(context.Background(), record, where, args...)
+}
+
+func (t *Tx) SelectOneContext(ctx context.Context, record any, where string, args ...any) error {
+	return t.Table(getTableName(record)).SelectOneContext(ctx, record, where, args...)
 }
 
 func (t *Tx) Exec(query string, args ...any) (sql.Result, error) {
-	return t.tx.Exec(query, args...)
+	return t.exe.ExecContext(context.Background(), query, args...)
+}
+
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.exe.ExecContext(ctx, query, args...)
+}
+
+// TxOptions configures transaction of DB.RunInTx
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// MaxAttempts is 3 by default
+	MaxAttempts int
+	// Backoff returns delay before the next attempt, attempt starts from 1
+	Backoff func(attempt int) time.Duration
+	// Retryable reports whether transaction can be retried with err. It's IsSerializationFailure by default
+	Retryable func(err error) bool
+	// Timeout limits the whole run including retries and backoffs if it's positive
+	Timeout time.Duration
+	// AttemptTimeout limits every attempt if it's positive. Timed out attempt is rolled back and retried.
+	// Statements in fn fail after transaction is rolled back, but fn isn't interrupted by other operations
+	AttemptTimeout time.Duration
+}
+
+const (
+	defaultTxMaxAttempts = 3
+	maxTxBackoff         = 2 * time.Second
+)
+
+// RunInTx runs fn in a transaction, which is committed if fn returns nil, otherwise rolled back.
+// If fn panics, the transaction is rolled back and the panic is propagated.
+// The whole transaction is retried if it fails with retryable error, so fn may be called more than once
+func (d *DB) RunInTx(ctx context.Context, opts *TxOptions, fn func(tx *Tx) error) error {
+	var o TxOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = defaultTxMaxAttempts
+	}
+	if o.Backoff == nil {
+		o.Backoff = txBackoff
+	}
+	if o.Retryable == nil {
+		o.Retryable = IsSerializationFailure
+	}
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+
+	for attempt := 1; ; attempt++ {
+		timedOut, err := d.runAttempt(ctx, &o, fn)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= o.MaxAttempts || ctx.Err() != nil || (!timedOut && !o.Retryable(err)) {
+			return err
+		}
+
+		timer := time.NewTimer(o.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// runAttempt runs fn in a transaction with AttemptTimeout, and reports whether it failed because of timeout
+func (d *DB) runAttempt(ctx context.Context, o *TxOptions, fn func(tx *Tx) error) (bool, error) {
+	opts := &sql.TxOptions{Isolation: o.Isolation, ReadOnly: o.ReadOnly}
+	if o.AttemptTimeout <= 0 {
+		return false, d.runInTx(ctx, opts, fn)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, o.AttemptTimeout)
+	defer cancel()
+	err := d.runInTx(attemptCtx, opts, fn)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return true, fmt.Errorf("attempt timed out: %w", err)
+	}
+	return false, err
+}
+
+func (d *DB) runInTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) (err error) {
+	tx, err := d.BeginTx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	committed = true
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// IsSerializationFailure reports whether err is caused by concurrent transactions,
+// e.g. serialization failure or deadlock in postgres and mysql, or busy database in sqlite.
+// Such transaction can be retried
+func IsSerializationFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// implemented by errors of lib/pq and jackc/pgx
+	var e interface{ SQLState() string }
+	if errors.As(err, &e) {
+		switch e.SQLState() {
+		case "40001", "40P01":
+			return true
+		}
+	}
+
+	msg := err.Error()
+	for _, s := range serializationFailureMessages {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+var serializationFailureMessages = []string{
+	// postgres
+	"could not serialize access",
+	"deadlock detected",
+	// mysql
+	"Deadlock found",
+	"Lock wait timeout exceeded",
+	// sqlite
+	"database is locked",
+	"database table is locked",
+}
+
+func txBackoff(attempt int) time.Duration {
+	d := 20 * time.Millisecond << (attempt - 1)
+	if d <= 0 || d > maxTxBackoff {
+		return maxTxBackoff
+	}
+	// jitter avoids conflicting again with the same transactions
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
 }
@@ -0,0 +1,151 @@
+package xsqlite
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"code.olapie.com/sugar/v2/xslice"
+)
+
+type ChangeOp int
+
+const (
+	ChangeInsert ChangeOp = iota + 1
+	ChangeUpdate
+	ChangeDelete
+)
+
+func (o ChangeOp) String() string {
+	switch o {
+	case ChangeInsert:
+		return "insert"
+	case ChangeUpdate:
+		return "update"
+	case ChangeDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// ChangeEvent is published after a write is committed
+type ChangeEvent[K SimpleKey] struct {
+	Op       ChangeOp
+	Key      K
+	Category int
+}
+
+// ChangeFilter selects events to receive, nil filter accepts all events
+type ChangeFilter[K SimpleKey] func(e *ChangeEvent[K]) bool
+
+func KeyPrefixFilter(prefix string) ChangeFilter[string] {
+	return func(e *ChangeEvent[string]) bool {
+		return strings.HasPrefix(e.Key, prefix)
+	}
+}
+
+func CategoryFilter[K SimpleKey](categories ...int) ChangeFilter[K] {
+	return func(e *ChangeEvent[K]) bool {
+		return xslice.Contains(categories, e.Category)
+	}
+}
+
+func OpFilter[K SimpleKey](ops ...ChangeOp) ChangeFilter[K] {
+	return func(e *ChangeEvent[K]) bool {
+		return xslice.Contains(ops, e.Op)
+	}
+}
+
+// changeHub delivers events to subscribers. Its zero value is ready to use
+type changeHub[K SimpleKey] struct {
+	mu          sync.RWMutex
+	subscribers map[*changeSubscriber[K]]struct{}
+}
+
+// Subscribe returns a channel which receives events until ctx is done.
+// Events are queued, so that slow subscribers never block writes
+func (h *changeHub[K]) Subscribe(ctx context.Context, filter ChangeFilter[K]) <-chan *ChangeEvent[K] {
+	s := &changeSubscriber[K]{
+		filter: filter,
+		signal: make(chan struct{}, 1),
+		out:    make(chan *ChangeEvent[K]),
+	}
+	h.mu.Lock()
+	if h.subscribers == nil {
+		h.subscribers = map[*changeSubscriber[K]]struct{}{}
+	}
+	h.subscribers[s] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		s.run(ctx)
+		h.mu.Lock()
+		delete(h.subscribers, s)
+		h.mu.Unlock()
+		close(s.out)
+	}()
+	return s.out
+}
+
+// Active reports whether there are subscribers, so that writers can skip preparing events
+func (h *changeHub[K]) Active() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subscribers) > 0
+}
+
+func (h *changeHub[K]) Publish(events ...*ChangeEvent[K]) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subscribers {
+		s.push(events)
+	}
+}
+
+type changeSubscriber[K SimpleKey] struct {
+	filter ChangeFilter[K]
+	mu     sync.Mutex
+	queue  []*ChangeEvent[K]
+	signal chan struct{}
+	out    chan *ChangeEvent[K]
+}
+
+func (s *changeSubscriber[K]) push(events []*ChangeEvent[K]) {
+	s.mu.Lock()
+	for _, e := range events {
+		if s.filter == nil || s.filter(e) {
+			copied := *e
+			s.queue = append(s.queue, &copied)
+		}
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (s *changeSubscriber[K]) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.signal:
+		}
+
+		s.mu.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+
+		for _, e := range queue {
+			select {
+			case <-ctx.Done():
+				return
+			case s.out <- e:
+			}
+		}
+	}
+}
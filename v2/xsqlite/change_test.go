@@ -0,0 +1,143 @@
+package xsqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"code.olapie.com/sugar/v2/xsqlite"
+	"code.olapie.com/sugar/v2/xtest"
+	"code.olapie.com/sugar/v2/xtype"
+	"github.com/google/uuid"
+)
+
+type changeItem struct {
+	ID   int64
+	Name string
+}
+
+func (i *changeItem) PrimaryKey() int64 {
+	return i.ID
+}
+
+func setupDB(t testing.TB) *sql.DB {
+	filename := "testdata/change" + xtype.NextID().Pretty() + ".db"
+	db, err := xsqlite.Open(filename)
+	xtest.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(filename)
+	})
+	return db
+}
+
+func receive[K xsqlite.SimpleKey](t *testing.T, ch <-chan *xsqlite.ChangeEvent[K]) *xsqlite.ChangeEvent[K] {
+	t.Helper()
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+		return nil
+	}
+}
+
+func noEvent[K xsqlite.SimpleKey](t *testing.T, ch <-chan *xsqlite.ChangeEvent[K]) {
+	t.Helper()
+	select {
+	case e := <-ch:
+		t.Fatalf("unexpected event: %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLocalTable_Subscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	table := setupLocalTable(t)
+	all := table.Subscribe(ctx, nil)
+	category2 := table.Subscribe(ctx, xsqlite.CategoryFilter[string](2))
+
+	localID := uuid.NewString()
+	xtest.NoError(t, table.SaveLocal(ctx, localID, 1, newLocalTableItem()))
+	xtest.Equal(t, &xsqlite.ChangeEvent[string]{Op: xsqlite.ChangeInsert, Key: localID, Category: 1}, receive(t, all))
+
+	xtest.NoError(t, table.SaveRemote(ctx, localID, 1, newLocalTableItem(), time.Now().Unix()+1))
+	xtest.Equal(t, &xsqlite.ChangeEvent[string]{Op: xsqlite.ChangeUpdate, Key: localID, Category: 1}, receive(t, all))
+
+	xtest.NoError(t, table.UpdateRemote(ctx, localID, newLocalTableItem()))
+	xtest.Equal(t, xsqlite.ChangeUpdate, receive(t, all).Op)
+
+	xtest.NoError(t, table.Delete(ctx, localID))
+	xtest.Equal(t, &xsqlite.ChangeEvent[string]{Op: xsqlite.ChangeDelete, Key: localID, Category: 1}, receive(t, all))
+
+	xtest.NoError(t, table.Delete(ctx, localID))
+	noEvent(t, all)
+	noEvent(t, category2)
+
+	localID = uuid.NewString()
+	xtest.NoError(t, table.SaveLocal(ctx, localID, 2, newLocalTableItem()))
+	xtest.Equal(t, localID, receive(t, category2).Key)
+	xtest.Equal(t, localID, receive(t, all).Key)
+
+	cancel()
+	_, ok := <-all
+	xtest.False(t, ok)
+}
+
+func TestSimpleTable_Subscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	table, err := xsqlite.NewSimpleTable[int64, *changeItem](setupDB(t), "items")
+	xtest.NoError(t, err)
+	ch := table.Subscribe(ctx, nil)
+
+	for i := int64(1); i <= 3; i++ {
+		xtest.NoError(t, table.Insert(&changeItem{ID: i}))
+		xtest.Equal(t, &xsqlite.ChangeEvent[int64]{Op: xsqlite.ChangeInsert, Key: i}, receive(t, ch))
+	}
+
+	xtest.NoError(t, table.Update(&changeItem{ID: 1, Name: "updated"}))
+	xtest.Equal(t, &xsqlite.ChangeEvent[int64]{Op: xsqlite.ChangeUpdate, Key: 1}, receive(t, ch))
+	item, err := table.Get(1)
+	xtest.NoError(t, err)
+	xtest.Equal(t, "updated", item.Name)
+
+	xtest.NoError(t, table.Save(&changeItem{ID: 2}))
+	xtest.Equal(t, xsqlite.ChangeUpdate, receive(t, ch).Op)
+	xtest.NoError(t, table.Save(&changeItem{ID: 4}))
+	xtest.Equal(t, xsqlite.ChangeInsert, receive(t, ch).Op)
+
+	xtest.NoError(t, table.DeleteGreaterThan(2))
+	keys := []int64{receive(t, ch).Key, receive(t, ch).Key}
+	xtest.Equal(t, []int64{3, 4}, keys)
+
+	xtest.NoError(t, table.Delete(1))
+	xtest.Equal(t, &xsqlite.ChangeEvent[int64]{Op: xsqlite.ChangeDelete, Key: 1}, receive(t, ch))
+	xtest.NoError(t, table.Delete(1))
+	noEvent(t, ch)
+}
+
+func TestKVTable_Watch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kv := xsqlite.NewKVTable(setupDB(t))
+	ch := kv.Watch(ctx, "user.")
+
+	xtest.NoError(t, kv.SaveString("user.name", "tom"))
+	xtest.Equal(t, &xsqlite.ChangeEvent[string]{Op: xsqlite.ChangeInsert, Key: "user.name"}, receive(t, ch))
+	xtest.NoError(t, kv.SaveInt64("user.age", 1))
+	xtest.Equal(t, "user.age", receive(t, ch).Key)
+	xtest.NoError(t, kv.SaveInt64("user.age", 2))
+	xtest.Equal(t, &xsqlite.ChangeEvent[string]{Op: xsqlite.ChangeUpdate, Key: "user.age"}, receive(t, ch))
+
+	xtest.NoError(t, kv.SaveString("device.name", "phone"))
+	noEvent(t, ch)
+
+	xtest.NoError(t, kv.DeleteWithPrefix("user."))
+	e1, e2 := receive(t, ch), receive(t, ch)
+	xtest.Equal(t, xsqlite.ChangeDelete, e1.Op)
+	xtest.Equal(t, xsqlite.ChangeDelete, e2.Op)
+}
@@ -0,0 +1,97 @@
+package xsqlite_test
+
+import (
+	"os"
+	"testing"
+
+	"code.olapie.com/sugar/v2/xsql"
+	"code.olapie.com/sugar/v2/xtest"
+	"code.olapie.com/sugar/v2/xtype"
+)
+
+type dialectUser struct {
+	ID        int64  `sql:"id,primary key,auto_increment"`
+	Name      string `sql:"name"`
+	Order     int    `sql:"order"`
+	CreatedAt int64  `sql:"created_at"`
+}
+
+func (u *dialectUser) TableName() string {
+	return "users"
+}
+
+func setupXSQLDB(t *testing.T, optFns ...func(options *xsql.DBOptions)) *xsql.DB {
+	filename := "testdata/dialect" + xtype.NextID().Pretty() + ".db"
+	db, err := xsql.NewDB("sqlite3", filename, optFns...)
+	xtest.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(filename)
+	})
+	db.MustExec(`CREATE TABLE users(id INTEGER PRIMARY KEY AUTOINCREMENT, name VARCHAR(64), "order" INTEGER, created_at BIGINT)`)
+	return db
+}
+
+func TestGetDialect(t *testing.T) {
+	xtest.Equal(t, xsql.SQLiteDialect, xsql.GetDialect("sqlite"))
+	xtest.Equal(t, xsql.SQLiteDialect, xsql.GetDialect("sqlite3"))
+	xtest.Equal(t, xsql.PostgresDialect, xsql.GetDialect("postgres"))
+	xtest.Equal(t, xsql.PostgresDialect, xsql.GetDialect("pgx"))
+	xtest.Equal(t, xsql.MySQLDialect, xsql.GetDialect("mysql"))
+	xtest.True(t, xsql.GetDialect("unknown") == nil)
+
+	d := xsql.PostgresDialect
+	xtest.Equal(t, "$2", d.Placeholder(2))
+	xtest.Equal(t, `"order"`, d.Quote("order"))
+	xtest.Equal(t, `INSERT INTO users("name") VALUES ($1) ON CONFLICT("id") DO UPDATE SET "name" = excluded."name"`,
+		d.Upsert(`INSERT INTO users("name") VALUES ($1)`, []string{"id"}, []string{"name"}))
+	xtest.Equal(t, "INSERT INTO users(`name`) VALUES (?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)",
+		xsql.MySQLDialect.Upsert("INSERT INTO users(`name`) VALUES (?)", []string{"id"}, []string{"name"}))
+}
+
+func TestTable_Save(t *testing.T) {
+	db := setupXSQLDB(t)
+	u := &dialectUser{Name: "tom", Order: 1, CreatedAt: 100}
+	xtest.NoError(t, db.Save(u))
+	xtest.True(t, u.ID > 0)
+
+	u.Name = "jim"
+	u.CreatedAt = 200
+	xtest.NoError(t, db.Save(u))
+	var l []*dialectUser
+	xtest.NoError(t, db.Select(&l, ""))
+	// created_at is not updated
+	xtest.Equal(t, []*dialectUser{{ID: u.ID, Name: "jim", Order: 1, CreatedAt: 100}}, l)
+
+	u.Order = 2
+	xtest.NoError(t, db.Update(u))
+	var got dialectUser
+	xtest.NoError(t, db.SelectOne(&got, "id=?", u.ID))
+	xtest.Equal(t, 2, got.Order)
+}
+
+func TestTable_BatchInsert(t *testing.T) {
+	db := setupXSQLDB(t)
+	var users []*dialectUser
+	for i := 0; i < 1000; i++ {
+		users = append(users, &dialectUser{ID: int64(i + 1), Name: "user", Order: i})
+	}
+	xtest.NoError(t, db.BatchInsert(users))
+	n, err := db.Table("users").Count("")
+	xtest.NoError(t, err)
+	xtest.Equal(t, 1000, n)
+
+	added := []*dialectUser{{Name: "a"}, {Name: "b"}}
+	xtest.NoError(t, db.BatchInsert(added))
+	xtest.Equal(t, int64(1001), added[0].ID)
+	xtest.Equal(t, int64(1002), added[1].ID)
+
+	for _, u := range added {
+		u.Order = -1
+	}
+	xtest.NoError(t, db.MultiSave(added))
+	xtest.NoError(t, db.BatchUpdate(added))
+	n, err = db.Table("users").Count(`"order"=?`, -1)
+	xtest.NoError(t, err)
+	xtest.Equal(t, 2, n)
+}
@@ -0,0 +1,38 @@
+//go:build go1.21
+
+package xsqlite_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"code.olapie.com/sugar/v2/xcontext"
+	"code.olapie.com/sugar/v2/xsql"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+func TestSlogInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	db := setupXSQLDB(t, func(options *xsql.DBOptions) {
+		options.Interceptors = []xsql.Interceptor{
+			xsql.NewSlogInterceptor(logger, func(options *xsql.SlogInterceptorOptions) {
+				options.Level = slog.LevelInfo
+			}),
+		}
+	})
+	db.MustExec(`CREATE TABLE secrets(id BIGINT PRIMARY KEY, name VARCHAR(64), password VARCHAR(64), unredacted_note VARCHAR(64))`)
+	buf.Reset()
+
+	ctx := xcontext.WithTraceID(context.TODO(), "trace-1")
+	xtest.NoError(t, db.InsertContext(ctx, &secretUser{ID: 1, Name: "tom", Password: "123456"}))
+	line := buf.String()
+	xtest.True(t, strings.Contains(line, "level=INFO"), line)
+	xtest.True(t, strings.Contains(line, "trace_id=trace-1"), line)
+	xtest.True(t, strings.Contains(line, "rows_affected=1"), line)
+	xtest.True(t, strings.Contains(line, "[REDACTED]"), line)
+	xtest.False(t, strings.Contains(line, "123456"), line)
+}
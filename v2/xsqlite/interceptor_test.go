@@ -0,0 +1,83 @@
+package xsqlite_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"code.olapie.com/sugar/v2/xcontext"
+	"code.olapie.com/sugar/v2/xsql"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+type recordingInterceptor struct {
+	mu     sync.Mutex
+	events []*xsql.QueryEvent
+}
+
+func (r *recordingInterceptor) Before(ctx context.Context, e *xsql.QueryEvent) context.Context {
+	return ctx
+}
+
+func (r *recordingInterceptor) After(ctx context.Context, e *xsql.QueryEvent) {
+	r.mu.Lock()
+	r.events = append(r.events, e)
+	r.mu.Unlock()
+}
+
+func (r *recordingInterceptor) Last() *xsql.QueryEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.events[len(r.events)-1]
+}
+
+type secretUser struct {
+	ID       int64  `sql:"id,primary key"`
+	Name     string `sql:"name"`
+	Password string `sql:"password,redact"`
+	// it's not redacted as only redact option is matched
+	UnredactedNote string `sql:"unredacted_note"`
+}
+
+func (u *secretUser) TableName() string {
+	return "secrets"
+}
+
+func TestInterceptor(t *testing.T) {
+	recorder := &recordingInterceptor{}
+	var slow []*xsql.QueryEvent
+	db := setupXSQLDB(t, func(options *xsql.DBOptions) {
+		options.Interceptors = []xsql.Interceptor{
+			recorder,
+			xsql.NewSlowQueryInterceptor(0, func(ctx context.Context, e *xsql.QueryEvent) {
+				slow = append(slow, e)
+			}),
+		}
+	})
+	db.MustExec(`CREATE TABLE secrets(id BIGINT PRIMARY KEY, name VARCHAR(64), password VARCHAR(64), unredacted_note VARCHAR(64))`)
+
+	ctx := xcontext.WithTraceID(context.TODO(), "trace-1")
+	xtest.NoError(t, db.InsertContext(ctx, &secretUser{ID: 1, Name: "tom", Password: "123456", UnredactedNote: "note"}))
+	e := recorder.Last()
+	xtest.Equal(t, xsql.OpExec, e.Op)
+	xtest.Equal(t, "trace-1", e.TraceID)
+	xtest.Equal(t, int64(1), e.RowsAffected)
+	xtest.Equal(t, []any{int64(1), "tom", "[REDACTED]", "note"}, e.ReadableArgs())
+	xtest.Equal(t, e, slow[len(slow)-1])
+
+	var u secretUser
+	xtest.NoError(t, db.SelectOneContext(ctx, &u, "id=?", 1))
+	xtest.Equal(t, "123456", u.Password)
+	e = recorder.Last()
+	xtest.Equal(t, xsql.OpQueryRow, e.Op)
+	xtest.Equal(t, int64(-1), e.RowsAffected)
+
+	tx, err := db.BeginTx(ctx, nil)
+	xtest.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `UPDATE unknown SET name=?`, xsql.Redact("jim"))
+	xtest.Error(t, err)
+	e = recorder.Last()
+	xtest.Equal(t, err, e.Err)
+	xtest.Equal(t, []any{"[REDACTED]"}, e.ReadableArgs())
+}
@@ -0,0 +1,32 @@
+package xsqlite_test
+
+import (
+	"testing"
+
+	"code.olapie.com/sugar/v2/xsql"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+func TestJSONText(t *testing.T) {
+	db := setupXSQLDB(t)
+	db.MustExec(`CREATE TABLE docs(id INTEGER PRIMARY KEY, tags TEXT)`)
+	tags := []string{"a", "b"}
+	_, err := db.Exec(`INSERT INTO docs(id, tags) VALUES(1, ?)`, xsql.JSONText(tags))
+	xtest.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO docs(id, tags) VALUES(2, ?)`, xsql.JSONText([]string(nil)))
+	xtest.NoError(t, err)
+
+	var typ string
+	var n int
+	xtest.NoError(t, db.DB().QueryRow(`SELECT typeof(tags), json_array_length(tags) FROM docs WHERE id=1`).Scan(&typ, &n))
+	xtest.Equal(t, "text", typ)
+	xtest.Equal(t, 2, n)
+
+	var got []string
+	xtest.NoError(t, db.DB().QueryRow(`SELECT tags FROM docs WHERE id=1`).Scan(xsql.JSONText(&got)))
+	xtest.Equal(t, tags, got)
+
+	got = nil
+	xtest.NoError(t, db.DB().QueryRow(`SELECT tags FROM docs WHERE id=2`).Scan(xsql.JSONText(&got)))
+	xtest.True(t, got == nil)
+}
@@ -1,18 +1,42 @@
 package xsqlite
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"code.olapie.com/sugar/v2/conv"
+	"code.olapie.com/sugar/v2/must"
 	"code.olapie.com/sugar/v2/xbyte"
 	"code.olapie.com/sugar/v2/xtime"
 )
 
+// EvictionPolicy decides which entries are evicted if KVTable exceeds its size limit
+type EvictionPolicy int
+
+const (
+	// EvictOldest evicts entries which are written earliest
+	EvictOldest EvictionPolicy = iota
+	// EvictLRU evicts entries which are least recently read or written
+	EvictLRU
+)
+
 type KVTableOptions struct {
 	Clock xtime.Clock
+	// MaxRows limits number of entries if it's positive
+	MaxRows int
+	// MaxBytes limits total size of values if it's positive
+	MaxBytes int64
+	Eviction EvictionPolicy
+	// SweepInterval is the interval of deleting expired entries in background, no sweeper runs if it's not positive
+	SweepInterval time.Duration
+	// OnError is called if the sweeper fails to delete expired entries
+	OnError func(err error)
 }
 
 type KVTable struct {
@@ -20,6 +44,9 @@ type KVTable struct {
 	db      *sql.DB
 	mu      sync.RWMutex
 	name    string
+	changes changeHub[string]
+	done    chan struct{}
+	closed  bool
 }
 
 func NewKVTable(db *sql.DB, optFns ...func(options *KVTableOptions)) *KVTable {
@@ -44,22 +71,33 @@ updated_at BIGINT NOT NULL
 	if err != nil {
 		panic(err)
 	}
+
+	// expires_at: unix milliseconds, 0 means never
+	// accessed_at: unix nanoseconds of the last write, or the last read if eviction policy is LRU
+	must.Get(addColumnIfNotExists(db, "kv", "expires_at", "BIGINT DEFAULT 0"))
+	must.Get(addColumnIfNotExists(db, "kv", "accessed_at", "BIGINT DEFAULT 0"))
+	must.Get(db.Exec(`CREATE INDEX IF NOT EXISTS kv_expires_at ON kv(expires_at)`))
+	must.Get(db.Exec(`CREATE INDEX IF NOT EXISTS kv_accessed_at ON kv(accessed_at)`))
+
+	r.done = make(chan struct{})
+	if r.options.SweepInterval > 0 {
+		go r.sweep()
+	}
 	return r
 }
 
 func (t *KVTable) SaveInt64(key string, val int64) error {
-	t.mu.Lock()
-	_, err := t.db.Exec("REPLACE INTO kv(k,v,updated_at) VALUES(?1,?2,?3)",
-		key, fmt.Sprint(val), t.options.Clock.Now())
-	t.mu.Unlock()
-	return err
+	return t.save(key, fmt.Sprint(val), 0)
+}
+
+// SaveInt64WithTTL saves val which expires after ttl
+func (t *KVTable) SaveInt64WithTTL(key string, val int64, ttl time.Duration) error {
+	return t.save(key, fmt.Sprint(val), ttl)
 }
 
 func (t *KVTable) Int64(key string) (int64, error) {
 	var v string
-	t.mu.RLock()
-	err := t.db.QueryRow("SELECT v FROM kv WHERE k=?", key).Scan(&v)
-	t.mu.RUnlock()
+	err := t.get(key, &v)
 	if err != nil {
 		return 0, err
 	}
@@ -75,6 +113,11 @@ func (t *KVTable) SaveString(key string, str string) error {
 	return t.SaveBytes(key, []byte(str))
 }
 
+// SaveStringWithTTL saves str which expires after ttl
+func (t *KVTable) SaveStringWithTTL(key string, str string, ttl time.Duration) error {
+	return t.SaveBytesWithTTL(key, []byte(str), ttl)
+}
+
 func (t *KVTable) String(key string) (string, error) {
 	data, err := t.Bytes(key)
 	if err != nil {
@@ -84,17 +127,17 @@ func (t *KVTable) String(key string) (string, error) {
 }
 
 func (t *KVTable) SaveBytes(key string, data []byte) error {
-	t.mu.Lock()
-	_, err := t.db.Exec("REPLACE INTO kv(k,v,updated_at) VALUES(?1,?2,?3)", key, data, t.options.Clock.Now())
-	t.mu.Unlock()
-	return err
+	return t.save(key, data, 0)
+}
+
+// SaveBytesWithTTL saves data which expires after ttl
+func (t *KVTable) SaveBytesWithTTL(key string, data []byte, ttl time.Duration) error {
+	return t.save(key, data, ttl)
 }
 
 func (t *KVTable) Bytes(key string) ([]byte, error) {
 	var v []byte
-	t.mu.RLock()
-	err := t.db.QueryRow("SELECT v FROM kv WHERE k=?", key).Scan(&v)
-	t.mu.RUnlock()
+	err := t.get(key, &v)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
 	}
@@ -102,25 +145,24 @@ func (t *KVTable) Bytes(key string) ([]byte, error) {
 }
 
 func (t *KVTable) SaveObject(key string, obj any) error {
+	return t.SaveObjectWithTTL(key, obj, 0)
+}
+
+// SaveObjectWithTTL saves obj which expires after ttl
+func (t *KVTable) SaveObjectWithTTL(key string, obj any, ttl time.Duration) error {
+	if obj == nil {
+		return t.Delete(key)
+	}
 	data, err := t.encode(obj)
 	if err != nil {
 		return err
 	}
-	t.mu.Lock()
-	if obj == nil {
-		_, err = t.db.Exec("DELETE FROM kv WHERE k=?1", key)
-	} else {
-		_, err = t.db.Exec("REPLACE INTO kv(k,v,updated_at) VALUES(?1,?2,?3)", key, data, t.options.Clock.Now())
-	}
-	t.mu.Unlock()
-	return err
+	return t.save(key, data, ttl)
 }
 
 func (t *KVTable) GetObject(key string, ptrToObj any) error {
 	var data []byte
-	t.mu.RLock()
-	err := t.db.QueryRow("SELECT v FROM kv WHERE k=?", key).Scan(&data)
-	t.mu.RUnlock()
+	err := t.get(key, &data)
 	if err != nil {
 		return err
 	}
@@ -130,11 +172,11 @@ func (t *KVTable) GetObject(key string, ptrToObj any) error {
 func (t *KVTable) ListKeys(prefix string) ([]string, error) {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
-	query := "SELECT k FROM kv"
+	query := "SELECT k FROM kv WHERE (expires_at=0 OR expires_at>?)"
 	if prefix != "" {
-		query = "SELECT k FROM kv WHERE k LIKE '" + prefix + "%'"
+		query += " AND k LIKE '" + prefix + "%'"
 	}
-	rows, err := t.db.Query(query)
+	rows, err := t.db.Query(query, t.nowMillis())
 	if err != nil {
 		return nil, fmt.Errorf("failed executing %s: %w", query, err)
 	}
@@ -153,38 +195,330 @@ func (t *KVTable) ListKeys(prefix string) ([]string, error) {
 
 func (t *KVTable) Delete(key string) error {
 	t.mu.Lock()
-	_, err := t.db.Exec("DELETE FROM kv WHERE k=?", key)
+	res, err := t.db.Exec("DELETE FROM kv WHERE k=?", key)
 	t.mu.Unlock()
-	return err
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		t.publish(ChangeDelete, key)
+	}
+	return nil
 }
 
 func (t *KVTable) DeleteWithPrefix(prefix string) error {
+	var keys []string
+	if t.changes.Active() {
+		var err error
+		keys, err = t.ListKeys(prefix)
+		if err != nil {
+			return err
+		}
+	}
 	t.mu.Lock()
 	_, err := t.db.Exec("DELETE FROM kv WHERE k like '" + prefix + "%'")
 	t.mu.Unlock()
-	return err
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		t.publish(ChangeDelete, key)
+	}
+	return nil
+}
+
+// Subscribe returns a channel which receives change events until ctx is done
+func (t *KVTable) Subscribe(ctx context.Context, filter ChangeFilter[string]) <-chan *ChangeEvent[string] {
+	return t.changes.Subscribe(ctx, filter)
+}
+
+// Watch subscribes changes of keys with prefix
+func (t *KVTable) Watch(ctx context.Context, prefix string) <-chan *ChangeEvent[string] {
+	return t.changes.Subscribe(ctx, KeyPrefixFilter(prefix))
 }
 
 func (t *KVTable) Exists(key string) (bool, error) {
 	t.mu.RLock()
 	var exists bool
-	err := t.db.QueryRow("SELECT EXISTS(SELECT * FROM kv WHERE k=?)", key).Scan(&exists)
+	err := t.db.QueryRow("SELECT EXISTS(SELECT * FROM kv WHERE k=? AND (expires_at=0 OR expires_at>?))",
+		key, t.nowMillis()).Scan(&exists)
 	t.mu.RUnlock()
 	return exists, err
 }
 
+// TTL returns remaining time to live of key, or 0 if it never expires
+func (t *KVTable) TTL(key string) (time.Duration, error) {
+	var expiresAt int64
+	now := t.nowMillis()
+	t.mu.RLock()
+	err := t.db.QueryRow("SELECT expires_at FROM kv WHERE k=? AND (expires_at=0 OR expires_at>?)", key, now).Scan(&expiresAt)
+	t.mu.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+	if expiresAt == 0 {
+		return 0, nil
+	}
+	return time.Duration(expiresAt-now) * time.Millisecond, nil
+}
+
+// CompareAndSwap replaces value of key with newVal if its current value is oldVal.
+// If oldVal is nil, it only saves newVal if key doesn't exist. TTL of the existing entry is kept
+func (t *KVTable) CompareAndSwap(key string, oldVal, newVal []byte) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tx, err := t.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current []byte
+	err = tx.QueryRow("SELECT v FROM kv WHERE k=? AND (expires_at=0 OR expires_at>?)", key, t.nowMillis()).Scan(&current)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if oldVal != nil {
+			return false, nil
+		}
+		err = t.write(tx, key, newVal, 0)
+	case err != nil:
+		return false, fmt.Errorf("query: %w", err)
+	case oldVal == nil || !bytes.Equal(current, oldVal):
+		return false, nil
+	default:
+		_, err = tx.Exec("UPDATE kv SET v=?,updated_at=?,accessed_at=? WHERE k=?", newVal, t.options.Clock.Now(), t.nowNanos(), key)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit: %w", err)
+	}
+
+	if oldVal == nil {
+		t.publish(ChangeInsert, key)
+	} else {
+		t.publish(ChangeUpdate, key)
+	}
+	return true, t.evict()
+}
+
+// Increment adds delta to the int64 value of key atomically, and returns the new value.
+// Key which doesn't exist is regarded as 0. TTL of the existing entry is kept
+func (t *KVTable) Increment(key string, delta int64) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tx, err := t.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var v string
+	var n int64
+	op := ChangeUpdate
+	err = tx.QueryRow("SELECT v FROM kv WHERE k=? AND (expires_at=0 OR expires_at>?)", key, t.nowMillis()).Scan(&v)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		op = ChangeInsert
+		n = delta
+		err = t.write(tx, key, fmt.Sprint(n), 0)
+	case err != nil:
+		return 0, fmt.Errorf("query: %w", err)
+	default:
+		n, err = conv.ToInt64(v)
+		if err != nil {
+			return 0, err
+		}
+		n += delta
+		_, err = tx.Exec("UPDATE kv SET v=?,updated_at=?,accessed_at=? WHERE k=?", fmt.Sprint(n), t.options.Clock.Now(), t.nowNanos(), key)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	t.publish(op, key)
+	return n, t.evict()
+}
+
+// DeleteExpired deletes expired entries
+func (t *KVTable) DeleteExpired() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.deleteWhere("expires_at>0 AND expires_at<=?", t.nowMillis())
+}
+
+// Close stops the sweeper. db is not closed as it may be shared with other tables
 func (t *KVTable) Close() error {
-	if t.db == nil {
-		return nil
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.done)
+	}
+	return nil
+}
+
+func (t *KVTable) get(key string, ptr any) error {
+	t.mu.RLock()
+	err := t.db.QueryRow("SELECT v FROM kv WHERE k=? AND (expires_at=0 OR expires_at>?)", key, t.nowMillis()).Scan(ptr)
+	t.mu.RUnlock()
+	if err != nil || t.options.Eviction != EvictLRU {
+		return err
 	}
+
+	t.mu.Lock()
+	_, err = t.db.Exec("UPDATE kv SET accessed_at=? WHERE k=?", t.nowNanos(), key)
+	t.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("update accessed_at: %w", err)
+	}
+	return nil
+}
+
+func (t *KVTable) save(key string, v any, ttl time.Duration) error {
+	op := ChangeInsert
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	if t.db != nil {
-		return t.db.Close()
+	if t.changes.Active() {
+		var exists bool
+		err := t.db.QueryRow("SELECT EXISTS(SELECT * FROM kv WHERE k=? AND (expires_at=0 OR expires_at>?))",
+			key, t.nowMillis()).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			op = ChangeUpdate
+		}
+	}
+
+	if err := t.write(t.db, key, v, ttl); err != nil {
+		return err
+	}
+	t.publish(op, key)
+	return t.evict()
+}
+
+type kvExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func (t *KVTable) write(e kvExecer, key string, v any, ttl time.Duration) error {
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = t.options.Clock.Now().Add(ttl).UnixMilli()
+	}
+	_, err := e.Exec("REPLACE INTO kv(k,v,updated_at,expires_at,accessed_at) VALUES(?1,?2,?3,?4,?5)",
+		key, v, t.options.Clock.Now(), expiresAt, t.nowNanos())
+	return err
+}
+
+// evict deletes expired entries, then the oldest or least recently used entries until size limit is satisfied
+// The caller must hold t.mu
+func (t *KVTable) evict() error {
+	if t.options.MaxRows <= 0 && t.options.MaxBytes <= 0 {
+		return nil
+	}
+
+	if err := t.deleteWhere("expires_at>0 AND expires_at<=?", t.nowMillis()); err != nil {
+		return err
+	}
+
+	if t.options.MaxRows > 0 {
+		err := t.deleteWhere("k IN (SELECT k FROM kv ORDER BY accessed_at LIMIT MAX(0, (SELECT COUNT(*) FROM kv)-?))",
+			t.options.MaxRows)
+		if err != nil {
+			return err
+		}
+	}
+
+	if t.options.MaxBytes > 0 {
+		var total int64
+		err := t.db.QueryRow("SELECT IFNULL(SUM(LENGTH(v)),0) FROM kv").Scan(&total)
+		if err != nil {
+			return fmt.Errorf("query size: %w", err)
+		}
+		if total <= t.options.MaxBytes {
+			return nil
+		}
+
+		// accessed_at of the newest entry to evict
+		var accessedAt int64
+		err = t.db.QueryRow(`SELECT accessed_at FROM (
+SELECT accessed_at, SUM(LENGTH(v)) OVER (ORDER BY accessed_at, k) AS evicted FROM kv
+) WHERE evicted>=? ORDER BY evicted LIMIT 1`, total-t.options.MaxBytes).Scan(&accessedAt)
+		if err != nil {
+			return fmt.Errorf("query eviction: %w", err)
+		}
+		return t.deleteWhere("accessed_at<=?", accessedAt)
+	}
+	return nil
+}
+
+// deleteWhere deletes entries matching condition and publishes their deletion. The caller must hold t.mu
+func (t *KVTable) deleteWhere(condition string, args ...any) error {
+	var keys []string
+	if t.changes.Active() {
+		rows, err := t.db.Query("SELECT k FROM kv WHERE "+condition, args...)
+		if err != nil {
+			return fmt.Errorf("query: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key string
+			if err = rows.Scan(&key); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	_, err := t.db.Exec("DELETE FROM kv WHERE "+condition, args...)
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	for _, key := range keys {
+		t.publish(ChangeDelete, key)
 	}
 	return nil
 }
 
+func (t *KVTable) sweep() {
+	ticker := time.NewTicker(t.options.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			if err := t.DeleteExpired(); err != nil && t.options.OnError != nil {
+				t.options.OnError(fmt.Errorf("delete expired entries: %w", err))
+			}
+		}
+	}
+}
+
+func (t *KVTable) nowMillis() int64 {
+	return t.options.Clock.Now().UnixMilli()
+}
+
+func (t *KVTable) nowNanos() int64 {
+	return t.options.Clock.Now().UnixNano()
+}
+
+func (t *KVTable) publish(op ChangeOp, key string) {
+	if t.changes.Active() {
+		t.changes.Publish(&ChangeEvent[string]{Op: op, Key: key})
+	}
+}
+
 func (t *KVTable) encode(obj any) ([]byte, error) {
 	data, err := xbyte.Marshal(obj)
 	if err != nil {
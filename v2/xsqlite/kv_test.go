@@ -0,0 +1,190 @@
+package xsqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"code.olapie.com/sugar/v2/xsqlite"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestKVTable_TTL(t *testing.T) {
+	clock := &manualClock{now: time.Now()}
+	kv := xsqlite.NewKVTable(setupDB(t), func(options *xsqlite.KVTableOptions) {
+		options.Clock = clock
+	})
+
+	xtest.NoError(t, kv.SaveStringWithTTL("token", "abc", time.Minute))
+	xtest.NoError(t, kv.SaveString("name", "tom"))
+	v, err := kv.String("token")
+	xtest.NoError(t, err)
+	xtest.Equal(t, "abc", v)
+	ttl, err := kv.TTL("token")
+	xtest.NoError(t, err)
+	xtest.Equal(t, time.Minute, ttl)
+
+	clock.Add(time.Minute)
+	_, err = kv.String("token")
+	xtest.True(t, errors.Is(err, sql.ErrNoRows), err)
+	exists, err := kv.Exists("token")
+	xtest.NoError(t, err)
+	xtest.False(t, exists)
+	keys, err := kv.ListKeys("")
+	xtest.NoError(t, err)
+	xtest.Equal(t, []string{"name"}, keys)
+
+	xtest.NoError(t, kv.DeleteExpired())
+	_, err = kv.Bytes("token")
+	xtest.True(t, errors.Is(err, sql.ErrNoRows), err)
+}
+
+func TestKVTable_Sweep(t *testing.T) {
+	clock := &manualClock{now: time.Now()}
+	kv := xsqlite.NewKVTable(setupDB(t), func(options *xsqlite.KVTableOptions) {
+		options.Clock = clock
+		options.SweepInterval = 10 * time.Millisecond
+	})
+	// stop the sweeper
+	t.Cleanup(func() { kv.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := kv.Watch(ctx, "")
+	xtest.NoError(t, kv.SaveInt64WithTTL("n", 1, time.Second))
+	xtest.Equal(t, xsqlite.ChangeInsert, receive(t, ch).Op)
+	clock.Add(time.Second)
+	xtest.Equal(t, &xsqlite.ChangeEvent[string]{Op: xsqlite.ChangeDelete, Key: "n"}, receive(t, ch))
+}
+
+func TestKVTable_SweepError(t *testing.T) {
+	db := setupDB(t)
+	errs := make(chan error, 1)
+	kv := xsqlite.NewKVTable(db, func(options *xsqlite.KVTableOptions) {
+		options.SweepInterval = 10 * time.Millisecond
+		options.OnError = func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		}
+	})
+	_, err := db.Exec(`DROP TABLE kv`)
+	xtest.NoError(t, err)
+	select {
+	case err = <-errs:
+		xtest.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("no error")
+	}
+
+	// db is shared, so it's still open after the table is closed
+	xtest.NoError(t, kv.Close())
+	xtest.NoError(t, db.Ping())
+}
+
+func TestKVTable_Evict(t *testing.T) {
+	t.Run("MaxRows", func(t *testing.T) {
+		kv := xsqlite.NewKVTable(setupDB(t), func(options *xsqlite.KVTableOptions) {
+			options.MaxRows = 3
+		})
+		for i := 0; i < 5; i++ {
+			xtest.NoError(t, kv.SaveInt64(fmt.Sprint(i), int64(i)))
+		}
+		keys, err := kv.ListKeys("")
+		xtest.NoError(t, err)
+		xtest.Equal(t, []string{"2", "3", "4"}, keys)
+	})
+
+	t.Run("LRU", func(t *testing.T) {
+		kv := xsqlite.NewKVTable(setupDB(t), func(options *xsqlite.KVTableOptions) {
+			options.MaxRows = 2
+			options.Eviction = xsqlite.EvictLRU
+		})
+		xtest.NoError(t, kv.SaveInt64("a", 1))
+		xtest.NoError(t, kv.SaveInt64("b", 2))
+		_, err := kv.Int64("a")
+		xtest.NoError(t, err)
+		xtest.NoError(t, kv.SaveInt64("c", 3))
+		keys, err := kv.ListKeys("")
+		xtest.NoError(t, err)
+		xtest.Equal(t, []string{"a", "c"}, keys)
+	})
+
+	t.Run("MaxBytes", func(t *testing.T) {
+		kv := xsqlite.NewKVTable(setupDB(t), func(options *xsqlite.KVTableOptions) {
+			options.MaxBytes = 25
+		})
+		for i := 0; i < 5; i++ {
+			xtest.NoError(t, kv.SaveBytes(fmt.Sprint(i), make([]byte, 10)))
+		}
+		keys, err := kv.ListKeys("")
+		xtest.NoError(t, err)
+		xtest.Equal(t, []string{"3", "4"}, keys)
+	})
+}
+
+func TestKVTable_CompareAndSwap(t *testing.T) {
+	kv := xsqlite.NewKVTable(setupDB(t))
+	ok, err := kv.CompareAndSwap("k", []byte("a"), []byte("b"))
+	xtest.NoError(t, err)
+	xtest.False(t, ok)
+
+	ok, err = kv.CompareAndSwap("k", nil, []byte("a"))
+	xtest.NoError(t, err)
+	xtest.True(t, ok)
+
+	ok, err = kv.CompareAndSwap("k", nil, []byte("b"))
+	xtest.NoError(t, err)
+	xtest.False(t, ok)
+
+	ok, err = kv.CompareAndSwap("k", []byte("a"), []byte("b"))
+	xtest.NoError(t, err)
+	xtest.True(t, ok)
+	v, err := kv.String("k")
+	xtest.NoError(t, err)
+	xtest.Equal(t, "b", v)
+}
+
+func TestKVTable_Increment(t *testing.T) {
+	kv := xsqlite.NewKVTable(setupDB(t))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := kv.Increment("counter", 2)
+			xtest.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	n, err := kv.Int64("counter")
+	xtest.NoError(t, err)
+	xtest.Equal(t, int64(20), n)
+
+	n, err = kv.Increment("counter", -5)
+	xtest.NoError(t, err)
+	xtest.Equal(t, int64(15), n)
+}
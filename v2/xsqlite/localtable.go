@@ -25,10 +25,13 @@ const (
 )
 
 type LocalTableOptions[R any] struct {
-	Clock             xtime.Clock
-	MarshalFunc       func(r R) ([]byte, error)
-	UnmarshalFunc     func(data []byte, r *R) error
-	Password          string
+	Clock         xtime.Clock
+	MarshalFunc   func(r R) ([]byte, error)
+	UnmarshalFunc func(data []byte, r *R) error
+	// Password wraps data keys which encrypt records
+	Password string
+	// KDF derives key from Password to wrap data keys, olasec.MobileKDF is used if it's nil
+	KDF               olasec.KDF
 	LocalCacheSize    int
 	RemoteCacheSize   int
 	DeletionCacheSize int
@@ -40,6 +43,8 @@ type LocalTable[R any] struct {
 	remoteCache   *lru.Cache[string, R]
 	deletionCache *lru.Cache[string, bool]
 	options       LocalTableOptions[R]
+	keys          dataKeys
+	changes       changeHub[string]
 }
 
 func NewLocalTable[R any](db *sql.DB, optFns ...func(*LocalTableOptions[R])) *LocalTable[R] {
@@ -56,6 +61,10 @@ func NewLocalTable[R any](db *sql.DB, optFns ...func(*LocalTableOptions[R])) *Lo
 		t.options.Clock = xtime.LocalClock{}
 	}
 
+	if t.options.KDF == nil {
+		t.options.KDF = olasec.MobileKDF
+	}
+
 	if t.options.LocalCacheSize < minimumLocalTableCacheSize {
 		t.options.LocalCacheSize = minimumLocalTableCacheSize
 	}
@@ -70,9 +79,11 @@ func NewLocalTable[R any](db *sql.DB, optFns ...func(*LocalTableOptions[R])) *Lo
 	t.remoteCache = must.Get(lru.New[string, R](t.options.RemoteCacheSize))
 	t.deletionCache = must.Get(lru.New[string, bool](t.options.DeletionCacheSize))
 
-	// table remotes: localID, recordData, updateTime, synced
-	// table locals: localID, recordData, createTime, updateTime
-	// table deletions: localID, deleteTime
+	// table remotes: localID, recordData, updateTime, synced, keyID
+	// table locals: localID, recordData, createTime, updateTime, keyID
+	// table deletions: localID, deleteTime, keyID
+	// table data_keys: keyID, wrappedKey
+	// table versions: the last version of locals and remotes
 
 	must.Get(db.Exec(`CREATE TABLE IF NOT EXISTS remotes(
     id VARCHAR PRIMARY KEY,
@@ -94,7 +105,30 @@ func NewLocalTable[R any](db *sql.DB, optFns ...func(*LocalTableOptions[R])) *Lo
     data BLOB,
     delete_time INTEGER
 )`))
+	for _, name := range localTableNames {
+		must.Get(addColumnIfNotExists(db, name, "key_id", "INTEGER DEFAULT 0"))
+	}
 
+	// version is increased by every write of locals and remotes,
+	// so that Syncer can tell whether a record has been changed since it was pushed, even in the same second
+	must.Get(db.Exec(`CREATE TABLE IF NOT EXISTS versions(
+    id INTEGER PRIMARY KEY,
+    value INTEGER NOT NULL
+)`))
+	must.Get(db.Exec(`INSERT OR IGNORE INTO versions(id, value) VALUES(0, 0)`))
+	for _, name := range []string{"locals", "remotes"} {
+		must.Get(addColumnIfNotExists(db, name, "version", "INTEGER DEFAULT 0"))
+		for trigger, event := range map[string]string{"insert": "INSERT", "update": "UPDATE OF data"} {
+			must.Get(db.Exec(fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s_%s_version AFTER %s ON %s BEGIN
+    UPDATE versions SET value=value+1 WHERE id=0;
+    UPDATE %s SET version=(SELECT value FROM versions WHERE id=0) WHERE id=NEW.id;
+END`, name, trigger, event, name, name)))
+		}
+	}
+
+	if t.options.Password != "" {
+		t.initKeys()
+	}
 	return t
 }
 
@@ -126,13 +160,18 @@ func (t *LocalTable[R]) SaveRemote(ctx context.Context, localID string, category
 		return nil
 	}
 
-	data, err := t.encode(localID, record)
+	data, keyID, err := t.encode(localID, record)
 	if err != nil {
 		return fmt.Errorf("encode: %s, %w", localID, err)
 	}
 
-	_, err = t.db.ExecContext(ctx, `REPLACE INTO remotes(id, category, data, update_time, synced) VALUES(?,?,?,?,1)`,
-		localID, category, data, updateTime)
+	op, err := t.getSaveOp(ctx, localID)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.db.ExecContext(ctx, `REPLACE INTO remotes(id, category, data, update_time, synced, key_id) VALUES(?,?,?,?,1,?)`,
+		localID, category, data, updateTime, keyID)
 	if err != nil {
 		return fmt.Errorf("replace into remotes: %s,%w", localID, err)
 	}
@@ -143,23 +182,30 @@ func (t *LocalTable[R]) SaveRemote(ctx context.Context, localID string, category
 		return fmt.Errorf("delete from locals: %s, %w", localID, err)
 	}
 	t.localCache.Remove(localID)
+	t.publish(op, localID, category)
 
 	return nil
 }
 
 func (t *LocalTable[R]) SaveLocal(ctx context.Context, localID string, category int, record R) error {
 	// replace locals
-	data, err := t.encode(localID, record)
+	data, keyID, err := t.encode(localID, record)
 	if err != nil {
 		return fmt.Errorf("encode: %s, %w", localID, err)
 	}
 
-	_, err = t.db.ExecContext(ctx, `REPLACE INTO locals(id,category, data, update_time) VALUES(?,?,?,?)`,
-		localID, category, data, t.options.Clock.Now().Unix())
+	op, err := t.getSaveOp(ctx, localID)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.db.ExecContext(ctx, `REPLACE INTO locals(id,category, data, update_time, key_id) VALUES(?,?,?,?,?)`,
+		localID, category, data, t.options.Clock.Now().Unix(), keyID)
 	if err != nil {
 		return fmt.Errorf("replace into remotes: %s,%w", localID, err)
 	}
 	t.localCache.Add(localID, record)
+	t.publish(op, localID, category)
 	return nil
 }
 
@@ -167,15 +213,25 @@ func (t *LocalTable[R]) Delete(ctx context.Context, localID string) error {
 	// delete from locals
 	// delete from remotes
 	// save in delete_record
-	_, err := t.db.ExecContext(ctx, `DELETE FROM locals WHERE id=?`, localID)
+	var category int
+	var exists bool
+	var err error
+	if t.changes.Active() {
+		category, exists, err = t.lookup(ctx, localID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = t.db.ExecContext(ctx, `DELETE FROM locals WHERE id=?`, localID)
 	if err != nil {
 		return fmt.Errorf("delete from locals: %s, %w", localID, err)
 	}
 	t.localCache.Remove(localID)
 
 	var remoteData []byte
-	var category int
-	err = t.db.QueryRowContext(ctx, `SELECT category, data FROM remotes WHERE id=?`, localID).Scan(&category, &remoteData)
+	var keyID int64
+	err = t.db.QueryRowContext(ctx, `SELECT category, data, key_id FROM remotes WHERE id=?`, localID).Scan(&category, &remoteData, &keyID)
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
 		// don't need to keep deleted record as it doesn't exist remotely
@@ -183,8 +239,8 @@ func (t *LocalTable[R]) Delete(ctx context.Context, localID string) error {
 	case err != nil:
 		return fmt.Errorf("query remotes: %s, %w", localID, err)
 	default:
-		_, err := t.db.ExecContext(ctx, `REPLACE INTO deletions(id, category, data, delete_time) VALUES (?,?,?,?)`,
-			localID, category, remoteData, t.options.Clock.Now().Unix())
+		_, err := t.db.ExecContext(ctx, `REPLACE INTO deletions(id, category, data, delete_time, key_id) VALUES (?,?,?,?,?)`,
+			localID, category, remoteData, t.options.Clock.Now().Unix(), keyID)
 		if err != nil {
 			return fmt.Errorf("replace into deletions: %s, %w", localID, err)
 		} else {
@@ -197,25 +253,30 @@ func (t *LocalTable[R]) Delete(ctx context.Context, localID string) error {
 		}
 		t.remoteCache.Remove(localID)
 	}
+
+	if exists {
+		t.publish(ChangeDelete, localID, category)
+	}
 	return nil
 }
 
 func (t *LocalTable[R]) Update(ctx context.Context, localID string, record R) error {
-	data, err := t.encode(localID, record)
+	data, keyID, err := t.encode(localID, record)
 	if err != nil {
 		return fmt.Errorf("encode record: %w", err)
 	}
+	encoded := &encodedRecord{data: data, keyID: keyID}
 
 	if isRemote, err := t.IsRemote(ctx, localID); err != nil {
 		return fmt.Errorf("failed xcheck remote: %w", err)
 	} else if isRemote {
-		return t.updateRemote(ctx, localID, record, &data)
+		return t.updateRemote(ctx, localID, record, encoded)
 	}
 
 	if isLocal, err := t.IsRemote(ctx, localID); err != nil {
 		return fmt.Errorf("failed xcheck remote: %w", err)
 	} else if isLocal {
-		return t.updateLocal(ctx, localID, record, &data)
+		return t.updateLocal(ctx, localID, record, encoded)
 	}
 
 	return xerror.NotExist
@@ -381,8 +442,32 @@ func (t *LocalTable[R]) RemoveDeletions(ctx context.Context, localIDs ...string)
 }
 
 func (t *LocalTable[R]) RemoveAllRemotes(ctx context.Context) error {
+	var events []*ChangeEvent[string]
+	if t.changes.Active() {
+		rows, err := t.db.QueryContext(ctx, `SELECT id, category FROM remotes`)
+		if err != nil {
+			return fmt.Errorf("query remotes: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			e := &ChangeEvent[string]{Op: ChangeDelete}
+			if err = rows.Scan(&e.Key, &e.Category); err != nil {
+				return fmt.Errorf("scan: %w", err)
+			}
+			events = append(events, e)
+		}
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+	}
+
 	_, err := t.db.ExecContext(ctx, `DELETE FROM remotes`)
-	return err
+	if err != nil {
+		return err
+	}
+	t.remoteCache.Purge()
+	t.changes.Publish(events...)
+	return nil
 }
 
 func (t *LocalTable[R]) Get(ctx context.Context, localID string) (record R, err error) {
@@ -396,14 +481,15 @@ func (t *LocalTable[R]) Get(ctx context.Context, localID string) (record R, err
 		return record, nil
 	}
 	var data []byte
-	err = t.db.QueryRowContext(ctx, `SELECT data FROM remotes WHERE id=?`, localID).Scan(&data)
+	var keyID int64
+	err = t.db.QueryRowContext(ctx, `SELECT data, key_id FROM remotes WHERE id=?`, localID).Scan(&data, &keyID)
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
 		break
 	case err != nil:
 		return record, fmt.Errorf("query remotes: %w", err)
 	default:
-		record, err = t.decode(localID, data)
+		record, err = t.decode(localID, data, keyID)
 		if err != nil {
 			return record, err
 		}
@@ -411,14 +497,14 @@ func (t *LocalTable[R]) Get(ctx context.Context, localID string) (record R, err
 		return record, nil
 	}
 
-	err = t.db.QueryRowContext(ctx, `SELECT data FROM locals WHERE id=?`, localID).Scan(&data)
+	err = t.db.QueryRowContext(ctx, `SELECT data, key_id FROM locals WHERE id=?`, localID).Scan(&data, &keyID)
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
 		break
 	case err != nil:
 		return record, fmt.Errorf("query locals: %w", err)
 	default:
-		record, err = t.decode(localID, data)
+		record, err = t.decode(localID, data, keyID)
 		if err != nil {
 			return record, err
 		}
@@ -444,8 +530,7 @@ func (t *LocalTable[R]) CleanLocals(ctx context.Context) error {
 }
 
 func (t *LocalTable[R]) EncryptPlainData(ctx context.Context) error {
-	tableNames := []string{"remotes", "locals", "deletions"}
-	for _, name := range tableNames {
+	for _, name := range localTableNames {
 		m, err := t.encryptTable(ctx, name)
 		if err != nil {
 			return fmt.Errorf("encryptTable: %s, %w", name, err)
@@ -480,47 +565,47 @@ func (t *LocalTable[R]) EncryptPlainData(ctx context.Context) error {
 //	return nil
 //}
 
-func (t *LocalTable[R]) updateLocal(ctx context.Context, localID string, record R, optionalData *[]byte) error {
-	if optionalData == nil {
-		data, err := t.encode(localID, record)
+func (t *LocalTable[R]) updateLocal(ctx context.Context, localID string, record R, encoded *encodedRecord) error {
+	if encoded == nil {
+		data, keyID, err := t.encode(localID, record)
 		if err != nil {
 			return fmt.Errorf("encode record: %s, %w", localID, err)
 		}
-		optionalData = &data
+		encoded = &encodedRecord{data: data, keyID: keyID}
 	}
-	_, err := t.db.ExecContext(ctx, `UPDATE locals SET data=?, update_time=? WHERE id=?`,
-		*optionalData, t.options.Clock.Now().Unix(), localID)
+	_, err := t.db.ExecContext(ctx, `UPDATE locals SET data=?, update_time=?, key_id=? WHERE id=?`,
+		encoded.data, t.options.Clock.Now().Unix(), encoded.keyID, localID)
 	if err != nil {
 		return fmt.Errorf("update locals: %w", err)
 	}
 	t.localCache.Add(localID, record)
-	return nil
+	return t.publishUpdate(ctx, localID)
 }
 
-func (t *LocalTable[R]) updateRemote(ctx context.Context, localID string, record R, optionalData *[]byte) error {
-	if optionalData == nil {
-		data, err := t.encode(localID, record)
+func (t *LocalTable[R]) updateRemote(ctx context.Context, localID string, record R, encoded *encodedRecord) error {
+	if encoded == nil {
+		data, keyID, err := t.encode(localID, record)
 		if err != nil {
 			return fmt.Errorf("encode: %s, %w", localID, err)
 		}
-		optionalData = &data
+		encoded = &encodedRecord{data: data, keyID: keyID}
 	}
-	_, err := t.db.ExecContext(ctx, `UPDATE remotes SET data=?, update_time=?, synced=0 WHERE id=?`,
-		*optionalData, t.options.Clock.Now().Unix(), localID)
+	_, err := t.db.ExecContext(ctx, `UPDATE remotes SET data=?, update_time=?, synced=0, key_id=? WHERE id=?`,
+		encoded.data, t.options.Clock.Now().Unix(), encoded.keyID, localID)
 	if err != nil {
 		return fmt.Errorf("update remotes: %w", err)
 	}
 	t.remoteCache.Add(localID, record)
-	return nil
+	return t.publishUpdate(ctx, localID)
 }
 
-func (t *LocalTable[R]) encryptTable(ctx context.Context, tableName string) (map[string][]byte, error) {
+func (t *LocalTable[R]) encryptTable(ctx context.Context, tableName string) (map[string]*encodedRecord, error) {
 	rows, err := t.db.QueryContext(ctx, `SELECT id, data FROM `+tableName)
 	if err != nil {
 		return nil, fmt.Errorf("query locals: %w", err)
 	}
 	defer rows.Close()
-	idToData := make(map[string][]byte)
+	idToData := make(map[string]*encodedRecord)
 	for rows.Next() {
 		var localID string
 		var data []byte
@@ -533,19 +618,19 @@ func (t *LocalTable[R]) encryptTable(ctx context.Context, tableName string) (map
 			continue
 		}
 
-		data, err = olasec.Encrypt(data, t.options.Password+localID)
+		data, keyID, err := t.encrypt(localID, data)
 		if err != nil {
 			return nil, fmt.Errorf("encrypt %s: %w", tableName, err)
 		}
-		idToData[localID] = data
+		idToData[localID] = &encodedRecord{data: data, keyID: keyID}
 	}
 	return idToData, nil
 }
 
-func (t *LocalTable[R]) writeEncryptedData(ctx context.Context, tableName string, idToData map[string][]byte) error {
-	query := fmt.Sprintf(`UPDATE %s SET data=? WHERE id=?`, tableName)
-	for id, data := range idToData {
-		_, err := t.db.ExecContext(ctx, query, data, id)
+func (t *LocalTable[R]) writeEncryptedData(ctx context.Context, tableName string, idToData map[string]*encodedRecord) error {
+	query := fmt.Sprintf(`UPDATE %s SET data=?, key_id=? WHERE id=?`, tableName)
+	for id, encoded := range idToData {
+		_, err := t.db.ExecContext(ctx, query, encoded.data, encoded.keyID, id)
 		if err != nil {
 			return err
 		}
@@ -558,7 +643,7 @@ func (t *LocalTable[R]) list(ctx context.Context, tableName string, where string
 	if where != "" {
 		where = " where " + where
 	}
-	query := `SELECT id, data FROM ` + tableName + where
+	query := `SELECT id, data, key_id FROM ` + tableName + where
 	rows, err := t.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, nil, fmt.Errorf("execute query: %s, %w", query, err)
@@ -584,8 +669,9 @@ func (t *LocalTable[R]) scan(rows *sql.Rows, tableName string) ([]string, []R, e
 	for rows.Next() {
 		var localID string
 		var data []byte
+		var keyID int64
 
-		err := rows.Scan(&localID, &data)
+		err := rows.Scan(&localID, &data, &keyID)
 		if err != nil {
 			return nil, nil, fmt.Errorf("scan %s: %w", tableName, err)
 		}
@@ -598,7 +684,7 @@ func (t *LocalTable[R]) scan(rows *sql.Rows, tableName string) ([]string, []R, e
 			}
 		}
 
-		r, err := t.decode(localID, data)
+		r, err := t.decode(localID, data, keyID)
 		if err != nil {
 			return nil, nil, fmt.Errorf("decode: %w", err)
 		}
@@ -613,7 +699,7 @@ func (t *LocalTable[R]) scan(rows *sql.Rows, tableName string) ([]string, []R, e
 	return ids, records, nil
 }
 
-func (t *LocalTable[R]) encode(localID string, r R) (data []byte, err error) {
+func (t *LocalTable[R]) encode(localID string, r R) (data []byte, keyID int64, err error) {
 	if t.options.MarshalFunc != nil {
 		data, err = t.options.MarshalFunc(r)
 	} else {
@@ -631,12 +717,12 @@ func (t *LocalTable[R]) encode(localID string, r R) (data []byte, err error) {
 		return
 	}
 
-	return olasec.Encrypt(data, t.options.Password+localID)
+	return t.encrypt(localID, data)
 }
 
-func (t *LocalTable[R]) decode(localID string, data []byte) (record R, err error) {
+func (t *LocalTable[R]) decode(localID string, data []byte, keyID int64) (record R, err error) {
 	if t.options.Password != "" {
-		data, err = olasec.Decrypt(data, t.options.Password+localID)
+		data, err = t.decrypt(localID, data, keyID)
 		if err != nil {
 			return
 		}
@@ -670,3 +756,57 @@ func (t *LocalTable[R]) getCatchIDsCondition(ids ...string) (string, []any) {
 	})
 	return buf.String(), args
 }
+
+// Subscribe returns a channel which receives change events of records until ctx is done
+func (t *LocalTable[R]) Subscribe(ctx context.Context, filter ChangeFilter[string]) <-chan *ChangeEvent[string] {
+	return t.changes.Subscribe(ctx, filter)
+}
+
+// lookup returns category of the record which can be got by localID
+func (t *LocalTable[R]) lookup(ctx context.Context, localID string) (category int, exists bool, err error) {
+	err = t.db.QueryRowContext(ctx, `SELECT category FROM remotes WHERE id=?1 UNION ALL SELECT category FROM locals WHERE id=?1 LIMIT 1`,
+		localID).Scan(&category)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, false, nil
+	case err != nil:
+		return 0, false, fmt.Errorf("lookup %s: %w", localID, err)
+	default:
+		return category, true, nil
+	}
+}
+
+// getSaveOp returns ChangeUpdate if localID exists, otherwise ChangeInsert. It only queries if there are subscribers
+func (t *LocalTable[R]) getSaveOp(ctx context.Context, localID string) (ChangeOp, error) {
+	if !t.changes.Active() {
+		return ChangeInsert, nil
+	}
+	_, exists, err := t.lookup(ctx, localID)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return ChangeUpdate, nil
+	}
+	return ChangeInsert, nil
+}
+
+func (t *LocalTable[R]) publishUpdate(ctx context.Context, localID string) error {
+	if !t.changes.Active() {
+		return nil
+	}
+	category, exists, err := t.lookup(ctx, localID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		t.publish(ChangeUpdate, localID, category)
+	}
+	return nil
+}
+
+func (t *LocalTable[R]) publish(op ChangeOp, localID string, category int) {
+	if t.changes.Active() {
+		t.changes.Publish(&ChangeEvent[string]{Op: op, Key: localID, Category: category})
+	}
+}
@@ -0,0 +1,440 @@
+package xsqlite
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"code.olapie.com/sugar/v2/must"
+	"code.olapie.com/sugar/v2/olasec"
+)
+
+// legacyKeyID is the id of records which were encrypted with password directly,
+// its data key is the password wrapped by itself
+const legacyKeyID = 0
+
+const reKeyBatchSize = 100
+
+var localTableNames = []string{"remotes", "locals", "deletions"}
+
+// recordKDF derives record keys from random data keys which don't need to be stretched
+var recordKDF olasec.KDF = olasec.PBKDF2SHA256{Iterations: 1}
+
+type encodedRecord struct {
+	data  []byte
+	keyID int64
+}
+
+// dataKeys holds unwrapped data keys, records are encrypted with the active one
+type dataKeys struct {
+	mu       sync.RWMutex
+	password string
+	secrets  map[int64][]byte
+	activeID int64
+	err      error
+}
+
+type ReKeyProgress struct {
+	Done  int64
+	Total int64
+}
+
+func (t *LocalTable[R]) initKeys() {
+	must.Get(t.db.Exec(`CREATE TABLE IF NOT EXISTS data_keys(
+    id INTEGER PRIMARY KEY,
+    data BLOB NOT NULL,
+    create_time INTEGER
+)`))
+
+	t.keys.password = t.options.Password
+	// error is returned by operations which need data keys
+	t.keys.err = t.loadKeys(context.Background())
+}
+
+func (t *LocalTable[R]) loadKeys(ctx context.Context) error {
+	secrets, err := t.unwrapKeys(ctx, t.db, t.keys.password)
+	if err != nil {
+		return err
+	}
+
+	if len(secrets) == 0 {
+		secrets, err = t.createKeys(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.keys.secrets = secrets
+	t.keys.activeID = legacyKeyID
+	for id := range secrets {
+		if id > t.keys.activeID {
+			t.keys.activeID = id
+		}
+	}
+	return nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func (t *LocalTable[R]) unwrapKeys(ctx context.Context, db queryer, password string) (map[int64][]byte, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, data FROM data_keys`)
+	if err != nil {
+		return nil, fmt.Errorf("query data_keys: %w", err)
+	}
+	defer rows.Close()
+	secrets := make(map[int64][]byte)
+	for rows.Next() {
+		var id int64
+		var data []byte
+		if err = rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("scan data_keys: %w", err)
+		}
+		secrets[id], err = olasec.Decrypt(data, password)
+		if err != nil {
+			return nil, fmt.Errorf("unwrap data key %d: %w", id, err)
+		}
+	}
+	return secrets, rows.Err()
+}
+
+// createKeys creates the first data key, and keeps password as legacy data key if records have been encrypted with it
+func (t *LocalTable[R]) createKeys(ctx context.Context) (map[int64][]byte, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	secrets := make(map[int64][]byte)
+	var legacy bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT * FROM remotes WHERE key_id=0)
+OR EXISTS(SELECT * FROM locals WHERE key_id=0) OR EXISTS(SELECT * FROM deletions WHERE key_id=0)`).Scan(&legacy)
+	if err != nil {
+		return nil, fmt.Errorf("query legacy records: %w", err)
+	}
+
+	if legacy {
+		secret := []byte(t.keys.password)
+		if err = t.insertKey(ctx, tx, legacyKeyID, secret, t.keys.password); err != nil {
+			return nil, err
+		}
+		secrets[legacyKeyID] = secret
+	}
+
+	id, secret, err := t.newKey(ctx, tx, t.keys.password)
+	if err != nil {
+		return nil, err
+	}
+	secrets[id] = secret
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return secrets, nil
+}
+
+func (t *LocalTable[R]) newKey(ctx context.Context, tx *sql.Tx, password string) (int64, []byte, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, `SELECT IFNULL(MAX(id),0)+1 FROM data_keys`).Scan(&id)
+	if err != nil {
+		return 0, nil, fmt.Errorf("query data_keys: %w", err)
+	}
+
+	secret := make([]byte, olasec.KeySize)
+	if _, err = io.ReadFull(rand.Reader, secret); err != nil {
+		return 0, nil, err
+	}
+
+	if err = t.insertKey(ctx, tx, id, secret, password); err != nil {
+		return 0, nil, err
+	}
+	return id, secret, nil
+}
+
+func (t *LocalTable[R]) insertKey(ctx context.Context, tx *sql.Tx, id int64, secret []byte, password string) error {
+	wrapped, err := t.wrapKey(secret, password)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO data_keys(id, data, create_time) VALUES(?,?,?)`,
+		id, wrapped, t.options.Clock.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("insert into data_keys: %d, %w", id, err)
+	}
+	return nil
+}
+
+func (t *LocalTable[R]) wrapKey(secret []byte, password string) ([]byte, error) {
+	return olasec.Encrypt(secret, password, func(options *olasec.Options) {
+		options.KDF = t.options.KDF
+	})
+}
+
+// RotatePassword re-wraps data keys with newPassword, records needn't to be re-encrypted
+func (t *LocalTable[R]) RotatePassword(ctx context.Context, oldPassword, newPassword string) error {
+	if t.options.Password == "" {
+		return errors.New("password is not set")
+	}
+
+	if newPassword == "" {
+		return errors.New("new password is empty")
+	}
+
+	t.keys.mu.Lock()
+	defer t.keys.mu.Unlock()
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	secrets, err := t.unwrapKeys(ctx, tx, oldPassword)
+	if err != nil {
+		return err
+	}
+
+	for id, secret := range secrets {
+		wrapped, err := t.wrapKey(secret, newPassword)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE data_keys SET data=? WHERE id=?`, wrapped, id)
+		if err != nil {
+			return fmt.Errorf("update data_keys: %d, %w", id, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	t.keys.password = newPassword
+	if t.keys.err != nil {
+		// data keys failed to be unwrapped with options.Password, try again with the new one
+		t.keys.err = t.loadKeys(ctx)
+	}
+	return t.keys.err
+}
+
+// RotateDataKey creates a new data key to encrypt records
+// Records encrypted by previous data keys are still readable, call ReKey to re-encrypt them
+func (t *LocalTable[R]) RotateDataKey(ctx context.Context) error {
+	if t.options.Password == "" {
+		return errors.New("password is not set")
+	}
+
+	t.keys.mu.Lock()
+	defer t.keys.mu.Unlock()
+	if t.keys.err != nil {
+		return t.keys.err
+	}
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	id, secret, err := t.newKey(ctx, tx, t.keys.password)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	t.keys.secrets[id] = secret
+	t.keys.activeID = id
+	return nil
+}
+
+// ReKey re-encrypts records which are not encrypted with the active data key in batches,
+// then removes unused data keys.
+// It can run in background along with other operations. It resumes from where it was interrupted when called again
+func (t *LocalTable[R]) ReKey(ctx context.Context, onProgress func(p ReKeyProgress)) error {
+	if t.options.Password == "" {
+		return errors.New("password is not set")
+	}
+
+	for _, name := range localTableNames {
+		for {
+			// active key is read for every batch, as RotateDataKey may run concurrently
+			keyID, secret, err := t.activeKey()
+			if err != nil {
+				return err
+			}
+
+			n, err := t.reKeyBatch(ctx, name, keyID, secret)
+			if err != nil {
+				return fmt.Errorf("re-key %s: %w", name, err)
+			}
+
+			if n == 0 {
+				break
+			}
+
+			if onProgress != nil {
+				p, err := t.GetReKeyProgress(ctx)
+				if err != nil {
+					return err
+				}
+				onProgress(p)
+			}
+		}
+	}
+	return t.removeUnusedKeys(ctx)
+}
+
+func (t *LocalTable[R]) reKeyBatch(ctx context.Context, tableName string, keyID int64, secret []byte) (int, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT id, data, key_id FROM %s WHERE key_id!=? LIMIT %d`,
+		tableName, reKeyBatchSize), keyID)
+	if err != nil {
+		return 0, fmt.Errorf("query: %w", err)
+	}
+
+	var records []*encodedRecord
+	var ids []string
+	for rows.Next() {
+		var r encodedRecord
+		var id string
+		if err = rows.Scan(&id, &r.data, &r.keyID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan: %w", err)
+		}
+		ids = append(ids, id)
+		records = append(records, &r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	query := fmt.Sprintf(`UPDATE %s SET data=?, key_id=? WHERE id=? AND key_id=?`, tableName)
+	for i, r := range records {
+		plain := r.data
+		if olasec.IsEncrypted(r.data) {
+			plain, err = t.decrypt(ids[i], r.data, r.keyID)
+			if err != nil {
+				return 0, fmt.Errorf("decrypt %s: %w", ids[i], err)
+			}
+		}
+
+		data, err := encryptRecord(ids[i], plain, keyID, secret)
+		if err != nil {
+			return 0, fmt.Errorf("encrypt %s: %w", ids[i], err)
+		}
+
+		// key_id is changed if record has been overwritten since it was read
+		_, err = tx.ExecContext(ctx, query, data, keyID, ids[i], r.keyID)
+		if err != nil {
+			return 0, fmt.Errorf("update %s: %w", ids[i], err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return len(records), nil
+}
+
+// GetReKeyProgress returns how many records have been encrypted with the active data key
+func (t *LocalTable[R]) GetReKeyProgress(ctx context.Context) (ReKeyProgress, error) {
+	var p ReKeyProgress
+	t.keys.mu.RLock()
+	activeID := t.keys.activeID
+	t.keys.mu.RUnlock()
+	for _, name := range localTableNames {
+		var done, total int64
+		err := t.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT IFNULL(SUM(key_id=?),0), COUNT(*) FROM %s`, name),
+			activeID).Scan(&done, &total)
+		if err != nil {
+			return p, fmt.Errorf("query %s: %w", name, err)
+		}
+		p.Done += done
+		p.Total += total
+	}
+	return p, nil
+}
+
+func (t *LocalTable[R]) removeUnusedKeys(ctx context.Context) error {
+	t.keys.mu.Lock()
+	defer t.keys.mu.Unlock()
+	_, err := t.db.ExecContext(ctx, `DELETE FROM data_keys WHERE id!=? AND id NOT IN (
+SELECT key_id FROM remotes UNION SELECT key_id FROM locals UNION SELECT key_id FROM deletions)`, t.keys.activeID)
+	if err != nil {
+		return fmt.Errorf("delete from data_keys: %w", err)
+	}
+
+	rows, err := t.db.QueryContext(ctx, `SELECT id FROM data_keys`)
+	if err != nil {
+		return fmt.Errorf("query data_keys: %w", err)
+	}
+	defer rows.Close()
+	secrets := make(map[int64][]byte)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return fmt.Errorf("scan data_keys: %w", err)
+		}
+		secrets[id] = t.keys.secrets[id]
+	}
+	t.keys.secrets = secrets
+	return rows.Err()
+}
+
+func (t *LocalTable[R]) activeKey() (int64, []byte, error) {
+	t.keys.mu.RLock()
+	defer t.keys.mu.RUnlock()
+	return t.keys.activeID, t.keys.secrets[t.keys.activeID], t.keys.err
+}
+
+func (t *LocalTable[R]) encrypt(localID string, data []byte) ([]byte, int64, error) {
+	keyID, secret, err := t.activeKey()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data, err = encryptRecord(localID, data, keyID, secret)
+	return data, keyID, err
+}
+
+func encryptRecord(localID string, data []byte, keyID int64, secret []byte) ([]byte, error) {
+	return olasec.Encrypt(data, recordPassword(keyID, secret, localID), func(options *olasec.Options) {
+		options.KDF = recordKDF
+	})
+}
+
+func (t *LocalTable[R]) decrypt(localID string, data []byte, keyID int64) ([]byte, error) {
+	t.keys.mu.RLock()
+	secret, found := t.keys.secrets[keyID]
+	err := t.keys.err
+	t.keys.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("data key %d not found", keyID)
+	}
+	return olasec.Decrypt(data, recordPassword(keyID, secret, localID))
+}
+
+func recordPassword(keyID int64, secret []byte, localID string) string {
+	if keyID == legacyKeyID {
+		return string(secret) + localID
+	}
+	return hex.EncodeToString(secret) + localID
+}
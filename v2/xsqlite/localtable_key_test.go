@@ -0,0 +1,152 @@
+package xsqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"code.olapie.com/sugar/v2/olasec"
+	"code.olapie.com/sugar/v2/xsqlite"
+	"code.olapie.com/sugar/v2/xtest"
+	"code.olapie.com/sugar/v2/xtype"
+	"github.com/google/uuid"
+)
+
+func openLocalTableDB(t *testing.T) (*sql.DB, func(password string) *xsqlite.LocalTable[*localTableItem]) {
+	filename := "testdata/localtable_key" + xtype.NextID().Pretty() + ".db"
+	db, err := xsqlite.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(
+		func() {
+			db.Close()
+			os.Remove(filename)
+		})
+	return db, func(password string) *xsqlite.LocalTable[*localTableItem] {
+		return xsqlite.NewLocalTable[*localTableItem](db, func(opts *xsqlite.LocalTableOptions[*localTableItem]) {
+			opts.Password = password
+			opts.KDF = olasec.Argon2ID{Time: 1, Memory: 64, Threads: 1}
+		})
+	}
+}
+
+func TestLocalTable_RotatePassword(t *testing.T) {
+	ctx := context.TODO()
+	_, open := openLocalTableDB(t)
+	table := open("old")
+	item := newLocalTableItem()
+	localID := uuid.NewString()
+	xtest.NoError(t, table.SaveLocal(ctx, localID, 0, item))
+
+	xtest.Error(t, table.RotatePassword(ctx, "wrong", "new"))
+	xtest.NoError(t, table.RotatePassword(ctx, "old", "new"))
+
+	got, err := table.Get(ctx, localID)
+	xtest.NoError(t, err)
+	xtest.Equal(t, item, got)
+
+	_, err = open("old").Get(ctx, localID)
+	xtest.Error(t, err)
+
+	got, err = open("new").Get(ctx, localID)
+	xtest.NoError(t, err)
+	xtest.Equal(t, item, got)
+}
+
+func TestLocalTable_ReKey(t *testing.T) {
+	ctx := context.TODO()
+	db, open := openLocalTableDB(t)
+
+	// records encrypted with password directly before data keys were introduced
+	open("")
+	legacyItem := newLocalTableItem()
+	legacyID := uuid.NewString()
+	data, err := json.Marshal(legacyItem)
+	xtest.NoError(t, err)
+	data, err = olasec.Encrypt(data, "old"+legacyID)
+	xtest.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO remotes(id, data, update_time, synced) VALUES(?,?,?,1)`, legacyID, data, 1)
+	xtest.NoError(t, err)
+
+	table := open("old")
+	got, err := table.Get(ctx, legacyID)
+	xtest.NoError(t, err)
+	xtest.Equal(t, legacyItem, got)
+
+	items := map[string]*localTableItem{legacyID: legacyItem}
+	for i := 0; i < 250; i++ {
+		item := newLocalTableItem()
+		localID := uuid.NewString()
+		xtest.NoError(t, table.SaveLocal(ctx, localID, 0, item))
+		items[localID] = item
+	}
+
+	xtest.NoError(t, table.RotatePassword(ctx, "old", "new"))
+	xtest.NoError(t, table.RotateDataKey(ctx))
+	p, err := table.GetReKeyProgress(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, xsqlite.ReKeyProgress{Done: 0, Total: 251}, p)
+
+	// interrupted after the first batch
+	canceledCtx, cancel := context.WithCancel(ctx)
+	err = table.ReKey(canceledCtx, func(p xsqlite.ReKeyProgress) {
+		cancel()
+	})
+	xtest.Error(t, err)
+	p, err = table.GetReKeyProgress(ctx)
+	xtest.NoError(t, err)
+	xtest.True(t, p.Done > 0 && p.Done < p.Total, p)
+
+	var progresses []xsqlite.ReKeyProgress
+	err = table.ReKey(ctx, func(p xsqlite.ReKeyProgress) {
+		progresses = append(progresses, p)
+	})
+	xtest.NoError(t, err)
+	xtest.Equal(t, xsqlite.ReKeyProgress{Done: 251, Total: 251}, progresses[len(progresses)-1])
+
+	var numKeys int
+	xtest.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM data_keys`).Scan(&numKeys))
+	xtest.Equal(t, 1, numKeys)
+
+	table = open("new")
+	for id, item := range items {
+		got, err := table.Get(ctx, id)
+		xtest.NoError(t, err)
+		xtest.Equal(t, item, got)
+	}
+}
+
+func TestLocalTable_ReKeyWithRotation(t *testing.T) {
+	ctx := context.TODO()
+	_, open := openLocalTableDB(t)
+	table := open("old")
+	items := map[string]*localTableItem{}
+	for i := 0; i < 250; i++ {
+		item := newLocalTableItem()
+		localID := uuid.NewString()
+		xtest.NoError(t, table.SaveLocal(ctx, localID, 0, item))
+		items[localID] = item
+	}
+
+	xtest.NoError(t, table.RotateDataKey(ctx))
+	rotated := false
+	err := table.ReKey(ctx, func(p xsqlite.ReKeyProgress) {
+		if !rotated {
+			rotated = true
+			xtest.NoError(t, table.RotateDataKey(ctx))
+		}
+	})
+	xtest.NoError(t, err)
+	p, err := table.GetReKeyProgress(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, xsqlite.ReKeyProgress{Done: 250, Total: 250}, p)
+
+	for id, item := range items {
+		got, err := table.Get(ctx, id)
+		xtest.NoError(t, err)
+		xtest.Equal(t, item, got)
+	}
+}
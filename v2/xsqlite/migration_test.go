@@ -0,0 +1,164 @@
+package xsqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"code.olapie.com/sugar/v2/xsql"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+var migrationFS = fstest.MapFS{
+	"0001_create_users.up.sql":   {Data: []byte(`CREATE TABLE users(id BIGINT PRIMARY KEY, name VARCHAR(64));`)},
+	"0001_create_users.down.sql": {Data: []byte(`DROP TABLE users;`)},
+	"0002_add_email.up.sql":      {Data: []byte(`ALTER TABLE users ADD COLUMN email VARCHAR(64);`)},
+	"0002_add_email.down.sql":    {Data: []byte(`ALTER TABLE users DROP COLUMN email;`)},
+	"README.md":                  {Data: []byte(`ignored`)},
+}
+
+func getMigrationVersions(l []*xsql.Migration) []int64 {
+	versions := make([]int64, len(l))
+	for i, m := range l {
+		versions[i] = m.Version
+	}
+	return versions
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.TODO()
+	db := setupDB(t)
+	newMigrator := func(optFns ...func(options *xsql.MigratorOptions)) *xsql.Migrator {
+		m := xsql.NewMigrator(db, optFns...)
+		xtest.NoError(t, m.AddFS(migrationFS))
+		xtest.NoError(t, m.Add(&xsql.Migration{
+			Version: 3,
+			Name:    "seed",
+			UpFunc: func(ctx context.Context, tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `INSERT INTO users(id, name, email) VALUES(1, 'tom', 'tom@example.com')`)
+				return err
+			},
+			DownFunc: func(ctx context.Context, tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `DELETE FROM users`)
+				return err
+			},
+		}))
+		return m
+	}
+
+	dryRun := newMigrator(func(options *xsql.MigratorOptions) {
+		options.DryRun = true
+	})
+	l, err := dryRun.Up(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, []int64{1, 2, 3}, getMigrationVersions(l))
+	version, err := dryRun.Version(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, int64(0), version)
+
+	m := newMigrator()
+	l, err = m.MigrateTo(ctx, 2)
+	xtest.NoError(t, err)
+	xtest.Equal(t, []int64{1, 2}, getMigrationVersions(l))
+
+	l, err = m.Up(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, []int64{3}, getMigrationVersions(l))
+	var email string
+	xtest.NoError(t, db.QueryRow(`SELECT email FROM users WHERE id=1`).Scan(&email))
+	xtest.Equal(t, "tom@example.com", email)
+
+	statuses, err := m.Status(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, 3, len(statuses))
+	for _, s := range statuses {
+		xtest.True(t, s.Applied)
+		xtest.False(t, s.Drifted)
+	}
+
+	l, err = m.MigrateTo(ctx, 1)
+	xtest.NoError(t, err)
+	xtest.Equal(t, []int64{3, 2}, getMigrationVersions(l))
+	version, err = m.Version(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, int64(1), version)
+
+	t.Run("Drift", func(t *testing.T) {
+		drifted := xsql.NewMigrator(db)
+		xtest.NoError(t, drifted.Add(&xsql.Migration{
+			Version: 1,
+			Name:    "create_users",
+			Up:      `CREATE TABLE users(id BIGINT PRIMARY KEY);`,
+		}))
+		_, err := drifted.Up(ctx)
+		xtest.True(t, errors.Is(err, xsql.ErrMigrationDrift), err)
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		failed := newMigrator()
+		xtest.NoError(t, failed.Add(&xsql.Migration{
+			Version: 4,
+			Name:    "broken",
+			Up:      `CREATE TABLE items(id BIGINT); INSERT INTO unknown VALUES(1);`,
+		}))
+		_, err := failed.Up(ctx)
+		xtest.Error(t, err)
+		version, err := failed.Version(ctx)
+		xtest.NoError(t, err)
+		xtest.Equal(t, int64(3), version)
+		var exists bool
+		xtest.NoError(t, db.QueryRow(`SELECT EXISTS(SELECT * FROM sqlite_master WHERE name='items')`).Scan(&exists))
+		xtest.False(t, exists)
+	})
+}
+
+func TestMigrator_Concurrent(t *testing.T) {
+	ctx := context.TODO()
+	db := setupDB(t)
+	var mu sync.Mutex
+	seeds := 0
+	newMigrator := func() *xsql.Migrator {
+		m := xsql.NewMigrator(db)
+		xtest.NoError(t, m.AddFS(migrationFS))
+		xtest.NoError(t, m.Add(&xsql.Migration{
+			Version: 3,
+			Name:    "seed",
+			NoTx:    true,
+			Up:      `INSERT INTO users(id, name, email) VALUES(1, 'tom', 'tom@example.com')`,
+		}, &xsql.Migration{
+			Version: 4,
+			Name:    "count",
+			UpFunc: func(ctx context.Context, tx *sql.Tx) error {
+				mu.Lock()
+				seeds++
+				mu.Unlock()
+				return nil
+			},
+		}))
+		return m
+	}
+
+	var wg sync.WaitGroup
+	results := make([][]*xsql.Migration, 4)
+	for i := range results {
+		m := newMigrator()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l, err := m.Up(ctx)
+			xtest.NoError(t, err)
+			results[i] = l
+		}(i)
+	}
+	wg.Wait()
+
+	applied := 0
+	for _, l := range results {
+		applied += len(l)
+	}
+	xtest.Equal(t, 4, applied)
+	xtest.Equal(t, 1, seeds)
+}
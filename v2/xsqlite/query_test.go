@@ -0,0 +1,79 @@
+package xsqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"code.olapie.com/sugar/v2/xsql"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+func TestQuery(t *testing.T) {
+	ctx := context.TODO()
+	db := setupXSQLDB(t)
+	var users []*dialectUser
+	for i := 0; i < 10; i++ {
+		users = append(users, &dialectUser{ID: int64(i + 1), Name: fmt.Sprint("user", i%3), Order: i})
+	}
+	xtest.NoError(t, db.BatchInsertContext(ctx, users))
+
+	l, err := xsql.Query[*dialectUser](db).
+		Where(xsql.Eq("name", "user1"), xsql.Gt("order", 1)).
+		OrderByDesc("order").
+		Limit(2).
+		All(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, []*dialectUser{users[7], users[4]}, l)
+
+	values, err := xsql.Query[dialectUser](db).
+		Where(xsql.Or(xsql.In("id", 1, 2), xsql.Like("name", "%2"))).
+		OrderBy("id").
+		Offset(1).
+		All(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, []int64{2, 3, 6, 9}, getDialectUserIDs(values))
+
+	n, err := xsql.Query[dialectUser](db).Where(xsql.Lte("order", 4), xsql.IsNotNull("name")).Count(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, 5, n)
+
+	u, err := xsql.Query[dialectUser](db).Where(xsql.Ne("name", "user0")).OrderBy("order").One(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, int64(2), u.ID)
+
+	_, err = xsql.Query[dialectUser](db).Where(xsql.In("id")).One(ctx)
+	xtest.True(t, errors.Is(err, sql.ErrNoRows), err)
+
+	_, err = xsql.Query[dialectUser](db).Where(xsql.Eq("nme", "user0")).All(ctx)
+	xtest.True(t, errors.Is(err, xsql.ErrUnknownColumn), err)
+	_, err = xsql.Query[dialectUser](db).OrderBy("age").All(ctx)
+	xtest.True(t, errors.Is(err, xsql.ErrUnknownColumn), err)
+
+	t.Run("Tx", func(t *testing.T) {
+		tx, err := db.BeginTx(ctx, nil)
+		xtest.NoError(t, err)
+		defer tx.Rollback()
+		xtest.NoError(t, tx.Table("users").DeleteContext(ctx, "id>?", 1))
+		n, err := xsql.Query[dialectUser](tx).Count(ctx)
+		xtest.NoError(t, err)
+		xtest.Equal(t, 1, n)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := xsql.Query[dialectUser](db).All(ctx)
+		xtest.True(t, errors.Is(err, context.Canceled), err)
+	})
+}
+
+func getDialectUserIDs(l []dialectUser) []int64 {
+	ids := make([]int64, len(l))
+	for i, u := range l {
+		ids[i] = u.ID
+	}
+	return ids
+}
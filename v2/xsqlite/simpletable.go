@@ -1,6 +1,7 @@
 package xsqlite
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -18,10 +19,15 @@ type SimpleTableRecord[T SimpleKey] interface {
 }
 
 type SimpleTableOptions[K SimpleKey, R SimpleTableRecord[K]] struct {
-	Clock         xtime.Clock
+	Clock xtime.Clock
+	// MarshalFunc encodes records, which are encoded in JSON by default
 	MarshalFunc   func(r R) ([]byte, error)
 	UnmarshalFunc func(data []byte, r *R) error
-	Password      string
+	// Password encrypts records if it's set.
+	// Records saved before it was set are still readable, and they're encrypted when they're written again
+	Password string
+	// Indexes are secondary indexes which can be queried by Query
+	Indexes []*SimpleIndex[R]
 }
 
 type SimpleKey interface {
@@ -33,11 +39,13 @@ type SimpleTable[K SimpleKey, R SimpleTableRecord[K]] struct {
 	name    string
 	db      *sql.DB
 	mu      sync.RWMutex
+	changes changeHub[K]
 	stmts   struct {
 		insert            *sql.Stmt
 		update            *sql.Stmt
 		save              *sql.Stmt
 		get               *sql.Stmt
+		exists            *sql.Stmt
 		listAll           *sql.Stmt
 		listGreaterThan   *sql.Stmt
 		listLessThan      *sql.Stmt
@@ -79,38 +87,84 @@ updated_at BIGINT
 		t.options.Clock = xtime.LocalClock{}
 	}
 
-	t.stmts.insert = xsql.MustPrepare(db, `INSERT INTO %s(id,data,updated_at) VALUES(?,?,?)`, name)
-	t.stmts.update = xsql.MustPrepare(db, `UPDATE %s SET data=?,updated_at=? WHERE id=?`, name)
-	t.stmts.save = xsql.MustPrepare(db, `REPLACE INTO %s(id,data,updated_at) VALUES(?,?,?)`, name)
+	added, err := t.createIndexes()
+	if err != nil {
+		return nil, err
+	}
+
+	t.prepareWriteStmts()
 	t.stmts.get = xsql.MustPrepare(db, `SELECT data FROM %s WHERE id=?`, name)
+	t.stmts.exists = xsql.MustPrepare(db, `SELECT EXISTS(SELECT * FROM %s WHERE id=?)`, name)
 	t.stmts.listAll = xsql.MustPrepare(db, `SELECT id,data FROM %s ORDER BY updated_at`, name)
 	t.stmts.listGreaterThan = xsql.MustPrepare(db, `SELECT id,data FROM %s WHERE id>? ORDER BY id ASC LIMIT ?`, name)
 	t.stmts.listLessThan = xsql.MustPrepare(db, `SELECT id,data FROM %s WHERE id<? ORDER BY id DESC LIMIT ?`, name)
 	t.stmts.delete = xsql.MustPrepare(db, `DELETE FROM %s WHERE id=?`, name)
 	t.stmts.deleteGreaterThan = xsql.MustPrepare(db, `DELETE FROM %s WHERE id>?`, name)
 	t.stmts.deleteLessThan = xsql.MustPrepare(db, `DELETE FROM %s WHERE id<?`, name)
+
+	if err = t.reindex(added); err != nil {
+		return nil, fmt.Errorf("reindex: %w", err)
+	}
 	return t, nil
 }
 
-func (t *SimpleTable[K, R]) Insert(v SimpleTableRecord[K]) error {
+func (t *SimpleTable[K, R]) Insert(v R) error {
+	data, err := t.encode(v.PrimaryKey(), v)
+	if err != nil {
+		return err
+	}
 	t.mu.Lock()
-	_, err := t.stmts.insert.Exec(v.PrimaryKey(), xsql.JSON(v), t.options.Clock.Now())
+	_, err = t.stmts.insert.Exec(append([]any{v.PrimaryKey(), data, t.options.Clock.Now()}, t.getIndexValues(v)...)...)
 	t.mu.Unlock()
-	return err
+	if err != nil {
+		return err
+	}
+	t.publish(ChangeInsert, v.PrimaryKey())
+	return nil
 }
 
-func (t *SimpleTable[K, R]) Update(v SimpleTableRecord[K]) error {
+func (t *SimpleTable[K, R]) Update(v R) error {
+	data, err := t.encode(v.PrimaryKey(), v)
+	if err != nil {
+		return err
+	}
+	args := append([]any{data, t.options.Clock.Now()}, t.getIndexValues(v)...)
 	t.mu.Lock()
-	_, err := t.stmts.update.Exec(v.PrimaryKey(), xsql.JSON(v), t.options.Clock.Now())
+	res, err := t.stmts.update.Exec(append(args, v.PrimaryKey())...)
 	t.mu.Unlock()
-	return err
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		t.publish(ChangeUpdate, v.PrimaryKey())
+	}
+	return nil
 }
 
-func (t *SimpleTable[K, R]) Save(v SimpleTableRecord[K]) error {
+func (t *SimpleTable[K, R]) Save(v R) error {
+	data, err := t.encode(v.PrimaryKey(), v)
+	if err != nil {
+		return err
+	}
+	op := ChangeInsert
 	t.mu.Lock()
-	_, err := t.stmts.save.Exec(v.PrimaryKey(), xsql.JSON(v), t.options.Clock.Now())
+	if t.changes.Active() {
+		var exists bool
+		if err := t.stmts.exists.QueryRow(v.PrimaryKey()).Scan(&exists); err != nil {
+			t.mu.Unlock()
+			return err
+		}
+		if exists {
+			op = ChangeUpdate
+		}
+	}
+	_, err = t.stmts.save.Exec(append([]any{v.PrimaryKey(), data, t.options.Clock.Now()}, t.getIndexValues(v)...)...)
 	t.mu.Unlock()
-	return err
+	if err != nil {
+		return err
+	}
+	t.publish(op, v.PrimaryKey())
+	return nil
 }
 
 func (t *SimpleTable[K, R]) Get(key K) (R, error) {
@@ -186,33 +240,75 @@ func (t *SimpleTable[K, R]) readList(rows *sql.Rows) ([]R, error) {
 
 func (t *SimpleTable[K, R]) Delete(key K) error {
 	t.mu.Lock()
-	_, err := t.stmts.delete.Exec(key)
+	res, err := t.stmts.delete.Exec(key)
 	t.mu.Unlock()
-	return err
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		t.publish(ChangeDelete, key)
+	}
+	return nil
 }
 
 func (t *SimpleTable[K, R]) DeleteGreaterThan(key K) error {
-	t.mu.Lock()
-	_, err := t.stmts.deleteGreaterThan.Exec(key)
-	t.mu.Unlock()
-	return err
+	return t.deleteRange(t.stmts.deleteGreaterThan, "id>?", key)
 }
 
 func (t *SimpleTable[K, R]) DeleteLessThan(key K) error {
+	return t.deleteRange(t.stmts.deleteLessThan, "id<?", key)
+}
+
+// Subscribe returns a channel which receives change events of records until ctx is done
+func (t *SimpleTable[K, R]) Subscribe(ctx context.Context, filter ChangeFilter[K]) <-chan *ChangeEvent[K] {
+	return t.changes.Subscribe(ctx, filter)
+}
+
+func (t *SimpleTable[K, R]) deleteRange(stmt *sql.Stmt, where string, key K) error {
 	t.mu.Lock()
-	_, err := t.stmts.deleteLessThan.Exec(key)
-	t.mu.Unlock()
-	return err
+	defer t.mu.Unlock()
+	var keys []K
+	if t.changes.Active() {
+		rows, err := t.db.Query(fmt.Sprintf(`SELECT id FROM %s WHERE %s`, t.name, where), key)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var k K
+			if err = rows.Scan(&k); err != nil {
+				return err
+			}
+			keys = append(keys, k)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := stmt.Exec(key); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		t.publish(ChangeDelete, k)
+	}
+	return nil
 }
 
+func (t *SimpleTable[K, R]) publish(op ChangeOp, key K) {
+	if t.changes.Active() {
+		t.changes.Publish(&ChangeEvent[K]{Op: op, Key: key})
+	}
+}
+
+// simpleRecordKDF is cheap as every record is encrypted with its own key derived from password
+var simpleRecordKDF olasec.KDF = olasec.Argon2ID{Time: 1, Memory: 128, Threads: 1}
+
 func (t *SimpleTable[K, R]) encode(key K, r R) (data []byte, err error) {
 	if t.options.MarshalFunc != nil {
 		data, err = t.options.MarshalFunc(r)
 	} else {
-		data, err = xbyte.Marshal(r)
-		if err != nil {
-			data, err = json.Marshal(r)
-		}
+		data, err = json.Marshal(r)
 	}
 
 	if err != nil {
@@ -223,11 +319,13 @@ func (t *SimpleTable[K, R]) encode(key K, r R) (data []byte, err error) {
 		return
 	}
 
-	return olasec.Encrypt(data, t.options.Password+fmt.Sprint(key))
+	return olasec.Encrypt(data, t.options.Password+fmt.Sprint(key), func(options *olasec.Options) {
+		options.KDF = simpleRecordKDF
+	})
 }
 
 func (t *SimpleTable[K, R]) decode(key K, data []byte) (record R, err error) {
-	if t.options.Password != "" {
+	if t.options.Password != "" && olasec.IsEncrypted(data) {
 		data, err = olasec.Decrypt(data, t.options.Password+fmt.Sprint(key))
 		if err != nil {
 			return
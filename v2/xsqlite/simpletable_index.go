@@ -0,0 +1,276 @@
+package xsqlite
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"code.olapie.com/sugar/v2/xsql"
+)
+
+// SimpleIndex extracts a secondary index value from record.
+// The value is stored in an indexed column of SimpleTable, and updated on every write
+type SimpleIndex[R any] struct {
+	name       string
+	column     string
+	definition string
+	extract    func(r R) any
+}
+
+func StringIndex[R any](name string, fn func(r R) string) *SimpleIndex[R] {
+	return &SimpleIndex[R]{
+		name:       name,
+		column:     "idx_" + name,
+		definition: "VARCHAR",
+		extract: func(r R) any {
+			return fn(r)
+		},
+	}
+}
+
+func Int64Index[R any](name string, fn func(r R) int64) *SimpleIndex[R] {
+	return &SimpleIndex[R]{
+		name:       name,
+		column:     "idx_" + name,
+		definition: "BIGINT",
+		extract: func(r R) any {
+			return fn(r)
+		},
+	}
+}
+
+func (i *SimpleIndex[R]) Name() string {
+	return i.name
+}
+
+var simpleIndexNameRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// SimpleQuery selects records by a secondary index, or by primary key if Index is empty.
+// Records are ordered by the index value, then by primary key
+type SimpleQuery struct {
+	Index string
+	// Equal is the index value to match if it's not nil
+	Equal any
+	// From is the inclusive lower bound if it's not nil
+	From any
+	// To is the exclusive upper bound if it's not nil
+	To any
+	// Prefix matches string index values
+	Prefix string
+	Desc   bool
+	Offset int
+	// Limit is unlimited if it's not positive
+	Limit int
+}
+
+// Query returns records matching q
+func (t *SimpleTable[K, R]) Query(q *SimpleQuery) ([]R, error) {
+	column, where, args, err := t.getQueryCondition(q)
+	if err != nil {
+		return nil, err
+	}
+
+	order := "ASC"
+	if q.Desc {
+		order = "DESC"
+	}
+	query := fmt.Sprintf(`SELECT id,data FROM %s%s ORDER BY %s %s, id %s`, t.name, where, column, order, order)
+	if q.Limit > 0 || q.Offset > 0 {
+		limit := q.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, q.Offset)
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	rows, err := t.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query: %s, %w", query, err)
+	}
+	defer rows.Close()
+	return t.readList(rows)
+}
+
+// Count returns number of records matching q, ignoring its Offset and Limit
+func (t *SimpleTable[K, R]) Count(q *SimpleQuery) (int, error) {
+	_, where, args, err := t.getQueryCondition(q)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	t.mu.RLock()
+	err = t.db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s%s`, t.name, where), args...).Scan(&n)
+	t.mu.RUnlock()
+	return n, err
+}
+
+// ListBy returns records whose index value equals value
+func (t *SimpleTable[K, R]) ListBy(index string, value any) ([]R, error) {
+	return t.Query(&SimpleQuery{
+		Index: index,
+		Equal: value,
+	})
+}
+
+// Reindex recomputes values of all indexes
+func (t *SimpleTable[K, R]) Reindex() error {
+	return t.reindex(t.options.Indexes)
+}
+
+func (t *SimpleTable[K, R]) getQueryCondition(q *SimpleQuery) (column, where string, args []any, err error) {
+	column = "id"
+	if q.Index != "" {
+		idx := t.getIndex(q.Index)
+		if idx == nil {
+			return "", "", nil, fmt.Errorf("index not found: %s", q.Index)
+		}
+		column = idx.column
+	}
+
+	var conditions []string
+	if q.Equal != nil {
+		conditions = append(conditions, column+"=?")
+		args = append(args, q.Equal)
+	}
+
+	if q.From != nil {
+		conditions = append(conditions, column+">=?")
+		args = append(args, q.From)
+	}
+
+	if q.To != nil {
+		conditions = append(conditions, column+"<?")
+		args = append(args, q.To)
+	}
+
+	if q.Prefix != "" {
+		conditions = append(conditions, column+">=?")
+		args = append(args, q.Prefix)
+		if upper, ok := getPrefixUpperBound(q.Prefix); ok {
+			conditions = append(conditions, column+"<?")
+			args = append(args, upper)
+		}
+	}
+
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return column, where, args, nil
+}
+
+func (t *SimpleTable[K, R]) getIndex(name string) *SimpleIndex[R] {
+	for _, idx := range t.options.Indexes {
+		if idx.name == name {
+			return idx
+		}
+	}
+	return nil
+}
+
+// createIndexes adds index columns, and returns indexes which are newly added
+func (t *SimpleTable[K, R]) createIndexes() ([]*SimpleIndex[R], error) {
+	names := map[string]bool{}
+	var added []*SimpleIndex[R]
+	for _, idx := range t.options.Indexes {
+		if !simpleIndexNameRegexp.MatchString(idx.name) {
+			return nil, fmt.Errorf("invalid index name: %s", idx.name)
+		}
+
+		if names[idx.name] {
+			return nil, fmt.Errorf("duplicate index: %s", idx.name)
+		}
+		names[idx.name] = true
+
+		ok, err := addColumnIfNotExists(t.db, t.name, idx.column, idx.definition)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			added = append(added, idx)
+		}
+
+		_, err = t.db.Exec(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_%s ON %s(%s, id)`, t.name, idx.column, t.name, idx.column))
+		if err != nil {
+			return nil, fmt.Errorf("create index: %s, %w", idx.name, err)
+		}
+	}
+	return added, nil
+}
+
+func (t *SimpleTable[K, R]) reindex(indexes []*SimpleIndex[R]) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	records, err := t.ListAll()
+	if err != nil {
+		return err
+	}
+
+	assignments := make([]string, len(indexes))
+	for i, idx := range indexes {
+		assignments[i] = idx.column + "=?"
+	}
+	query := fmt.Sprintf(`UPDATE %s SET %s WHERE id=?`, t.name, strings.Join(assignments, ","))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tx, err := t.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("prepare: %s, %w", query, err)
+	}
+	defer stmt.Close()
+
+	for _, r := range records {
+		args := make([]any, 0, len(indexes)+1)
+		for _, idx := range indexes {
+			args = append(args, idx.extract(r))
+		}
+		if _, err = stmt.Exec(append(args, r.PrimaryKey())...); err != nil {
+			return fmt.Errorf("update: %v, %w", r.PrimaryKey(), err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (t *SimpleTable[K, R]) getIndexValues(r R) []any {
+	values := make([]any, len(t.options.Indexes))
+	for i, idx := range t.options.Indexes {
+		values[i] = idx.extract(r)
+	}
+	return values
+}
+
+func (t *SimpleTable[K, R]) prepareWriteStmts() {
+	var columns, placeholders, assignments strings.Builder
+	for _, idx := range t.options.Indexes {
+		columns.WriteString("," + idx.column)
+		placeholders.WriteString(",?")
+		assignments.WriteString("," + idx.column + "=?")
+	}
+	t.stmts.insert = xsql.MustPrepare(t.db, `INSERT INTO %s(id,data,updated_at%s) VALUES(?,?,?%s)`, t.name, columns.String(), placeholders.String())
+	t.stmts.update = xsql.MustPrepare(t.db, `UPDATE %s SET data=?,updated_at=?%s WHERE id=?`, t.name, assignments.String())
+	t.stmts.save = xsql.MustPrepare(t.db, `REPLACE INTO %s(id,data,updated_at%s) VALUES(?,?,?%s)`, t.name, columns.String(), placeholders.String())
+}
+
+// getPrefixUpperBound returns the smallest string which is greater than all strings with prefix
+func getPrefixUpperBound(prefix string) (string, bool) {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1]), true
+		}
+	}
+	return "", false
+}
@@ -2,9 +2,11 @@ package xsqlite
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"testing"
 
+	"code.olapie.com/sugar/v2/olasec"
 	"code.olapie.com/sugar/v2/xtest"
 	"code.olapie.com/sugar/v2/xtype"
 	_ "github.com/mattn/go-sqlite3"
@@ -135,3 +137,115 @@ func TestStringTable(t *testing.T) {
 	xtest.Error(t, err)
 	xtest.Equal(t, true, errors.Is(err, sql.ErrNoRows))
 }
+
+type indexedItem struct {
+	ID    int64
+	Name  string
+	Score int64
+}
+
+func (i *indexedItem) PrimaryKey() int64 {
+	return i.ID
+}
+
+func TestSimpleTable_Query(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file::memory:")
+	xtest.NoError(t, err)
+	name := "tbl" + xtype.RandomID().Pretty()
+	tbl, err := NewSimpleTable[int64, *indexedItem](db, name)
+	xtest.NoError(t, err)
+	names := []string{"apple", "banana", "apricot", "cherry", "avocado"}
+	for i, s := range names {
+		err = tbl.Insert(&indexedItem{ID: int64(i + 1), Name: s, Score: int64(i % 3)})
+		xtest.NoError(t, err)
+	}
+
+	// indexes of existing records are filled when they are added
+	tbl, err = NewSimpleTable[int64, *indexedItem](db, name, func(options *SimpleTableOptions[int64, *indexedItem]) {
+		options.Indexes = []*SimpleIndex[*indexedItem]{
+			StringIndex("name", func(r *indexedItem) string { return r.Name }),
+			Int64Index("score", func(r *indexedItem) int64 { return r.Score }),
+		}
+	})
+	xtest.NoError(t, err)
+
+	getIDs := func(l []*indexedItem) []int64 {
+		ids := make([]int64, len(l))
+		for i, v := range l {
+			ids[i] = v.ID
+		}
+		return ids
+	}
+
+	l, err := tbl.ListBy("score", 0)
+	xtest.NoError(t, err)
+	xtest.Equal(t, []int64{1, 4}, getIDs(l))
+
+	l, err = tbl.Query(&SimpleQuery{Index: "name", Prefix: "a"})
+	xtest.NoError(t, err)
+	xtest.Equal(t, []int64{1, 3, 5}, getIDs(l))
+
+	l, err = tbl.Query(&SimpleQuery{Index: "name", Prefix: "a", Desc: true, Offset: 1, Limit: 1})
+	xtest.NoError(t, err)
+	xtest.Equal(t, []int64{3}, getIDs(l))
+
+	l, err = tbl.Query(&SimpleQuery{Index: "score", From: 1, To: 3})
+	xtest.NoError(t, err)
+	xtest.Equal(t, []int64{2, 5, 3}, getIDs(l))
+
+	n, err := tbl.Count(&SimpleQuery{Index: "score", From: 1})
+	xtest.NoError(t, err)
+	xtest.Equal(t, 3, n)
+
+	err = tbl.Update(&indexedItem{ID: 2, Name: "blueberry", Score: 0})
+	xtest.NoError(t, err)
+	l, err = tbl.ListBy("score", 0)
+	xtest.NoError(t, err)
+	xtest.Equal(t, []int64{1, 2, 4}, getIDs(l))
+	l, err = tbl.ListBy("name", "banana")
+	xtest.NoError(t, err)
+	xtest.Equal(t, 0, len(l))
+
+	err = tbl.Delete(1)
+	xtest.NoError(t, err)
+	l, err = tbl.ListBy("score", 0)
+	xtest.NoError(t, err)
+	xtest.Equal(t, []int64{2, 4}, getIDs(l))
+
+	_, err = tbl.ListBy("unknown", 0)
+	xtest.Error(t, err)
+}
+
+func TestSimpleTable_Encoding(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file::memory:")
+	xtest.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	name := "tbl" + xtype.RandomID().Pretty()
+	tbl, err := NewSimpleTable[int64, *IntItem](db, name)
+	xtest.NoError(t, err)
+	item := newIntItem()
+	xtest.NoError(t, tbl.Insert(item))
+
+	var data []byte
+	xtest.NoError(t, db.QueryRow(`SELECT data FROM `+name+` WHERE id=?`, item.ID).Scan(&data))
+	jsonData, err := json.Marshal(item)
+	xtest.NoError(t, err)
+	xtest.Equal(t, jsonData, data)
+
+	// records saved without password are still readable, and encrypted after written again
+	encrypted, err := NewSimpleTable[int64, *IntItem](db, name, func(options *SimpleTableOptions[int64, *IntItem]) {
+		options.Password = "123"
+	})
+	xtest.NoError(t, err)
+	v, err := encrypted.Get(item.ID)
+	xtest.NoError(t, err)
+	xtest.Equal(t, item, v)
+
+	item.Name = "updated"
+	xtest.NoError(t, encrypted.Update(item))
+	xtest.NoError(t, db.QueryRow(`SELECT data FROM `+name+` WHERE id=?`, item.ID).Scan(&data))
+	xtest.True(t, olasec.IsEncrypted(data))
+	v, err = encrypted.Get(item.ID)
+	xtest.NoError(t, err)
+	xtest.Equal(t, item, v)
+}
@@ -37,3 +37,20 @@ func Open(fileName string) (*sql.DB, error) {
 func MustOpen(filename string) *sql.DB {
 	return must.Get(Open(filename))
 }
+
+// addColumnIfNotExists adds column to table, and reports whether it's added
+func addColumnIfNotExists(db *sql.DB, table, column, definition string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT * FROM pragma_table_info(?) WHERE name=?)`, table, column).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("query table info: %s, %w", table, err)
+	}
+	if exists {
+		return false, nil
+	}
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	if err != nil {
+		return false, fmt.Errorf("add column: %s.%s, %w", table, column, err)
+	}
+	return true, nil
+}
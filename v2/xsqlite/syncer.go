@@ -0,0 +1,551 @@
+package xsqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SyncChange is a created, updated or deleted record
+type SyncChange[R any] struct {
+	LocalID    string
+	Category   int
+	Record     R
+	UpdateTime int64
+	Deleted    bool
+
+	// version of the local record when it was read
+	version int64
+}
+
+type PullResult[R any] struct {
+	Changes []*SyncChange[R]
+	// Cursor is passed to the next Pull to get changes after Changes
+	Cursor  string
+	HasMore bool
+}
+
+type PushRequest[R any] struct {
+	Creates []*SyncChange[R]
+	Updates []*SyncChange[R]
+	Deletes []*SyncChange[R]
+}
+
+// PushResult contains update times assigned by RemoteStore, keyed by local id
+type PushResult struct {
+	UpdateTimes map[string]int64
+}
+
+// RemoteStore is the server side of Syncer
+type RemoteStore[R any] interface {
+	// Pull returns changes made since cursor. Empty cursor means from the beginning
+	Pull(ctx context.Context, cursor string) (*PullResult[R], error)
+	Push(ctx context.Context, req *PushRequest[R]) (*PushResult, error)
+}
+
+// ConflictPolicy decides which change to keep if a record is changed both locally and remotely
+type ConflictPolicy int
+
+const (
+	// LastWriterWins keeps the change with larger update time
+	LastWriterWins ConflictPolicy = iota
+	ClientWins
+	ServerWins
+)
+
+// MergeFunc resolves conflict. It returns either local, remote or a new merged change
+type MergeFunc[R any] func(local, remote *SyncChange[R]) (*SyncChange[R], error)
+
+type SyncPhase int
+
+const (
+	SyncPulling SyncPhase = iota + 1
+	SyncPushing
+	SyncRetrying
+	SyncDone
+	SyncFailed
+)
+
+type SyncEvent struct {
+	Phase     SyncPhase
+	Pulled    int
+	Pushed    int
+	Conflicts int
+	// Attempt is the failed attempt number of SyncRetrying
+	Attempt int
+	Err     error
+}
+
+type SyncerOptions[R any] struct {
+	// CursorKey is the key of pull cursor in KVTable
+	CursorKey string
+	Policy    ConflictPolicy
+	// Merge overrides Policy if it's not nil
+	Merge       MergeFunc[R]
+	MaxAttempts int
+	Backoff     func(attempt int) time.Duration
+	OnProgress  func(e SyncEvent)
+}
+
+const (
+	defaultSyncCursorKey   = "localtable.sync.cursor"
+	defaultSyncMaxAttempts = 3
+	maxSyncBackoff         = 30 * time.Second
+)
+
+// Syncer pulls remote changes into LocalTable, and pushes local changes to RemoteStore
+type Syncer[R any] struct {
+	table   *LocalTable[R]
+	store   RemoteStore[R]
+	kv      *KVTable
+	options SyncerOptions[R]
+	merge   MergeFunc[R]
+	mu      sync.Mutex
+}
+
+func NewSyncer[R any](table *LocalTable[R], store RemoteStore[R], kv *KVTable, optFns ...func(options *SyncerOptions[R])) *Syncer[R] {
+	s := &Syncer[R]{
+		table: table,
+		store: store,
+		kv:    kv,
+	}
+	s.options.CursorKey = defaultSyncCursorKey
+	s.options.MaxAttempts = defaultSyncMaxAttempts
+	for _, fn := range optFns {
+		fn(&s.options)
+	}
+
+	if s.options.MaxAttempts <= 0 {
+		s.options.MaxAttempts = 1
+	}
+
+	if s.options.Backoff == nil {
+		s.options.Backoff = exponentialBackoff
+	}
+
+	s.merge = s.options.Merge
+	if s.merge == nil {
+		s.merge = getPolicyMergeFunc[R](s.options.Policy)
+	}
+	return s
+}
+
+// Sync pulls then pushes changes
+func (s *Syncer[R]) Sync(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pulled, conflicts, err := s.pull(ctx)
+	if err != nil {
+		s.notify(SyncEvent{Phase: SyncFailed, Pulled: pulled, Conflicts: conflicts, Err: err})
+		return fmt.Errorf("pull: %w", err)
+	}
+
+	pushed, err := s.push(ctx)
+	if err != nil {
+		s.notify(SyncEvent{Phase: SyncFailed, Pulled: pulled, Pushed: pushed, Conflicts: conflicts, Err: err})
+		return fmt.Errorf("push: %w", err)
+	}
+	s.notify(SyncEvent{Phase: SyncDone, Pulled: pulled, Pushed: pushed, Conflicts: conflicts})
+	return nil
+}
+
+func (s *Syncer[R]) Pull(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _, err := s.pull(ctx)
+	return err
+}
+
+func (s *Syncer[R]) Push(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.push(ctx)
+	return err
+}
+
+// ResetCursor makes the next pull start from the beginning
+func (s *Syncer[R]) ResetCursor() error {
+	return s.kv.Delete(s.options.CursorKey)
+}
+
+func (s *Syncer[R]) pull(ctx context.Context) (pulled, conflicts int, err error) {
+	cursor, err := s.kv.String(s.options.CursorKey)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, fmt.Errorf("get cursor: %w", err)
+	}
+
+	for {
+		var res *PullResult[R]
+		err = s.retry(ctx, func() error {
+			var err error
+			res, err = s.store.Pull(ctx, cursor)
+			return err
+		})
+		if err != nil {
+			return pulled, conflicts, err
+		}
+
+		for _, c := range res.Changes {
+			conflicted, err := s.apply(ctx, c)
+			if err != nil {
+				return pulled, conflicts, fmt.Errorf("apply %s: %w", c.LocalID, err)
+			}
+			if conflicted {
+				conflicts++
+			}
+		}
+		pulled += len(res.Changes)
+
+		cursor = res.Cursor
+		if err = s.kv.SaveString(s.options.CursorKey, cursor); err != nil {
+			return pulled, conflicts, fmt.Errorf("save cursor: %w", err)
+		}
+		s.notify(SyncEvent{Phase: SyncPulling, Pulled: pulled, Conflicts: conflicts})
+
+		if !res.HasMore {
+			return pulled, conflicts, nil
+		}
+	}
+}
+
+func (s *Syncer[R]) apply(ctx context.Context, remote *SyncChange[R]) (conflicted bool, err error) {
+	local, err := s.table.getPendingChange(ctx, remote.LocalID)
+	if err != nil {
+		return false, err
+	}
+
+	if local == nil {
+		return false, s.table.applyRemoteChange(ctx, remote)
+	}
+
+	resolved, err := s.merge(local, remote)
+	if err != nil {
+		return true, fmt.Errorf("merge: %w", err)
+	}
+
+	switch resolved {
+	case local:
+		return true, nil
+	case remote:
+		return true, s.table.applyRemoteChange(ctx, remote)
+	}
+
+	// Merged change is based on remote change, and will be pushed as a local change
+	if err = s.table.applyRemoteChange(ctx, remote); err != nil {
+		return true, err
+	}
+
+	switch {
+	case resolved.Deleted:
+		return true, s.table.Delete(ctx, remote.LocalID)
+	case remote.Deleted:
+		return true, s.table.SaveLocal(ctx, remote.LocalID, resolved.Category, resolved.Record)
+	default:
+		return true, s.table.UpdateRemote(ctx, remote.LocalID, resolved.Record)
+	}
+}
+
+func (s *Syncer[R]) push(ctx context.Context) (int, error) {
+	req, err := s.table.getPushRequest(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	total := len(req.Creates) + len(req.Updates) + len(req.Deletes)
+	if total == 0 {
+		return 0, nil
+	}
+
+	var res *PushResult
+	err = s.retry(ctx, func() error {
+		var err error
+		res, err = s.store.Push(ctx, req)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	updateTimes := map[string]int64{}
+	if res != nil && res.UpdateTimes != nil {
+		updateTimes = res.UpdateTimes
+	}
+
+	for _, c := range req.Creates {
+		if err = s.table.markLocalPushed(ctx, c, getUpdateTime(updateTimes, c)); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, c := range req.Updates {
+		if err = s.table.markRemotePushed(ctx, c, getUpdateTime(updateTimes, c)); err != nil {
+			return 0, err
+		}
+	}
+
+	ids := make([]string, len(req.Deletes))
+	for i, c := range req.Deletes {
+		ids[i] = c.LocalID
+	}
+	if err = s.table.RemoveDeletions(ctx, ids...); err != nil {
+		return 0, err
+	}
+
+	s.notify(SyncEvent{Phase: SyncPushing, Pushed: total})
+	return total, nil
+}
+
+func (s *Syncer[R]) retry(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= s.options.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		s.notify(SyncEvent{Phase: SyncRetrying, Attempt: attempt, Err: err})
+		timer := time.NewTimer(s.options.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Syncer[R]) notify(e SyncEvent) {
+	if s.options.OnProgress != nil {
+		s.options.OnProgress(e)
+	}
+}
+
+func exponentialBackoff(attempt int) time.Duration {
+	d := 500 * time.Millisecond << (attempt - 1)
+	if d <= 0 || d > maxSyncBackoff {
+		return maxSyncBackoff
+	}
+	return d
+}
+
+func getPolicyMergeFunc[R any](policy ConflictPolicy) MergeFunc[R] {
+	switch policy {
+	case ClientWins:
+		return func(local, remote *SyncChange[R]) (*SyncChange[R], error) {
+			return local, nil
+		}
+	case ServerWins:
+		return func(local, remote *SyncChange[R]) (*SyncChange[R], error) {
+			return remote, nil
+		}
+	default:
+		return func(local, remote *SyncChange[R]) (*SyncChange[R], error) {
+			if local.UpdateTime > remote.UpdateTime {
+				return local, nil
+			}
+			return remote, nil
+		}
+	}
+}
+
+func getUpdateTime[R any](updateTimes map[string]int64, c *SyncChange[R]) int64 {
+	if t, ok := updateTimes[c.LocalID]; ok {
+		return t
+	}
+	return c.UpdateTime
+}
+
+// getPendingChange returns local change which hasn't been pushed, or nil if there is none
+func (t *LocalTable[R]) getPendingChange(ctx context.Context, localID string) (*SyncChange[R], error) {
+	for _, query := range []struct {
+		tableName string
+		where     string
+	}{
+		{"locals", "id=?"},
+		{"remotes", "id=? AND synced=0"},
+		{"deletions", "id=?"},
+	} {
+		changes, err := t.listChanges(ctx, query.tableName, query.where, localID)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) > 0 {
+			return changes[0], nil
+		}
+	}
+	return nil, nil
+}
+
+func (t *LocalTable[R]) getPushRequest(ctx context.Context) (*PushRequest[R], error) {
+	var req PushRequest[R]
+	var err error
+	req.Creates, err = t.listChanges(ctx, "locals", "")
+	if err != nil {
+		return nil, err
+	}
+
+	req.Updates, err = t.listChanges(ctx, "remotes", "synced=0")
+	if err != nil {
+		return nil, err
+	}
+
+	req.Deletes, err = t.listChanges(ctx, "deletions", "")
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (t *LocalTable[R]) listChanges(ctx context.Context, tableName string, where string, args ...any) ([]*SyncChange[R], error) {
+	timeColumn, versionColumn := "update_time", "version"
+	if tableName == "deletions" {
+		timeColumn, versionColumn = "delete_time", "0"
+	}
+
+	if where != "" {
+		where = " WHERE " + where
+	}
+	query := fmt.Sprintf(`SELECT id, category, data, key_id, IFNULL(%s,0), IFNULL(%s,0) FROM %s%s`,
+		timeColumn, versionColumn, tableName, where)
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("execute query: %s, %w", query, err)
+	}
+	defer rows.Close()
+
+	var changes []*SyncChange[R]
+	for rows.Next() {
+		var c SyncChange[R]
+		var data []byte
+		var keyID int64
+		err = rows.Scan(&c.LocalID, &c.Category, &data, &keyID, &c.UpdateTime, &c.version)
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", tableName, err)
+		}
+		c.Record, err = t.decode(c.LocalID, data, keyID)
+		if err != nil {
+			return nil, fmt.Errorf("decode: %w", err)
+		}
+		c.Deleted = tableName == "deletions"
+		changes = append(changes, &c)
+	}
+	return changes, rows.Err()
+}
+
+// applyRemoteChange overwrites local record with remote change, and discards local changes
+func (t *LocalTable[R]) applyRemoteChange(ctx context.Context, c *SyncChange[R]) error {
+	var data []byte
+	var keyID int64
+	var err error
+	if !c.Deleted {
+		data, keyID, err = t.encode(c.LocalID, c.Record)
+		if err != nil {
+			return fmt.Errorf("encode: %s, %w", c.LocalID, err)
+		}
+	}
+
+	var op ChangeOp
+	var category int
+	if t.changes.Active() {
+		var exists bool
+		category, exists, err = t.lookup(ctx, c.LocalID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case c.Deleted && exists:
+			op = ChangeDelete
+		case c.Deleted:
+			break
+		case exists:
+			op, category = ChangeUpdate, c.Category
+		default:
+			op, category = ChangeInsert, c.Category
+		}
+	}
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, name := range localTableNames {
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+name+` WHERE id=?`, c.LocalID)
+		if err != nil {
+			return fmt.Errorf("delete from %s: %s, %w", name, c.LocalID, err)
+		}
+	}
+
+	if !c.Deleted {
+		_, err = tx.ExecContext(ctx, `INSERT INTO remotes(id, category, data, update_time, synced, key_id) VALUES(?,?,?,?,1,?)`,
+			c.LocalID, c.Category, data, c.UpdateTime, keyID)
+		if err != nil {
+			return fmt.Errorf("insert into remotes: %s, %w", c.LocalID, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	t.localCache.Remove(c.LocalID)
+	t.deletionCache.Remove(c.LocalID)
+	if c.Deleted {
+		t.remoteCache.Remove(c.LocalID)
+	} else {
+		t.remoteCache.Add(c.LocalID, c.Record)
+	}
+
+	if op != 0 {
+		t.publish(op, c.LocalID, category)
+	}
+	return nil
+}
+
+// markLocalPushed moves pushed record from locals to remotes, unless it's been changed since it was read
+func (t *LocalTable[R]) markLocalPushed(ctx context.Context, c *SyncChange[R], updateTime int64) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `REPLACE INTO remotes(id, category, data, update_time, synced, key_id)
+SELECT id, category, data, ?, 1, key_id FROM locals WHERE id=? AND version=?`, updateTime, c.LocalID, c.version)
+	if err != nil {
+		return fmt.Errorf("replace into remotes: %s, %w", c.LocalID, err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM locals WHERE id=?`, c.LocalID)
+	if err != nil {
+		return fmt.Errorf("delete from locals: %s, %w", c.LocalID, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	t.localCache.Remove(c.LocalID)
+	t.remoteCache.Add(c.LocalID, c.Record)
+	return nil
+}
+
+// markRemotePushed marks pushed remote record as synced, unless it's been changed since it was read
+func (t *LocalTable[R]) markRemotePushed(ctx context.Context, c *SyncChange[R], updateTime int64) error {
+	_, err := t.db.ExecContext(ctx, `UPDATE remotes SET synced=1, update_time=? WHERE id=? AND synced=0 AND version=?`,
+		updateTime, c.LocalID, c.version)
+	if err != nil {
+		return fmt.Errorf("update remotes: %s, %w", c.LocalID, err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package xsqlite
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"code.olapie.com/sugar/v2/xerror"
+	"code.olapie.com/sugar/v2/xtime"
+)
+
+const ErrInjected xerror.String = "injected error"
+
+const defaultMemoryRemoteStorePageSize = 100
+
+// MemoryRemoteStore is an in-memory RemoteStore for tests
+type MemoryRemoteStore[R any] struct {
+	mu       sync.Mutex
+	clock    xtime.Clock
+	records  map[string]*SyncChange[R]
+	log      []string
+	failures int
+
+	PageSize int
+}
+
+var _ RemoteStore[any] = (*MemoryRemoteStore[any])(nil)
+
+func NewMemoryRemoteStore[R any](clock xtime.Clock) *MemoryRemoteStore[R] {
+	if clock == nil {
+		clock = xtime.LocalClock{}
+	}
+	return &MemoryRemoteStore[R]{
+		clock:    clock,
+		records:  map[string]*SyncChange[R]{},
+		PageSize: defaultMemoryRemoteStorePageSize,
+	}
+}
+
+// Pull returns latest state of records changed after cursor, which is an offset of change log
+func (s *MemoryRemoteStore[R]) Pull(ctx context.Context, cursor string) (*PullResult[R], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+
+	var offset int
+	if cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(cursor)
+		if err != nil || offset < 0 || offset > len(s.log) {
+			return nil, fmt.Errorf("invalid cursor: %s", cursor)
+		}
+	}
+
+	end := offset + s.PageSize
+	if end > len(s.log) {
+		end = len(s.log)
+	}
+
+	res := &PullResult[R]{
+		Cursor:  strconv.Itoa(end),
+		HasMore: end < len(s.log),
+	}
+	for _, id := range s.log[offset:end] {
+		c := *s.records[id]
+		res.Changes = append(res.Changes, &c)
+	}
+	return res, nil
+}
+
+func (s *MemoryRemoteStore[R]) Push(ctx context.Context, req *PushRequest[R]) (*PushResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+
+	res := &PushResult{
+		UpdateTimes: map[string]int64{},
+	}
+	now := s.clock.Now().Unix()
+	for _, changes := range [][]*SyncChange[R]{req.Creates, req.Updates} {
+		for _, c := range changes {
+			stored := *c
+			stored.UpdateTime = now
+			s.put(&stored)
+			res.UpdateTimes[c.LocalID] = now
+		}
+	}
+
+	for _, c := range req.Deletes {
+		stored := *c
+		stored.UpdateTime = now
+		stored.Deleted = true
+		s.put(&stored)
+	}
+	return res, nil
+}
+
+// Put saves change as if it's pushed by another client
+func (s *MemoryRemoteStore[R]) Put(c *SyncChange[R]) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *c
+	s.put(&stored)
+}
+
+// Get returns the latest change of localID
+func (s *MemoryRemoteStore[R]) Get(localID string) (*SyncChange[R], bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.records[localID]
+	if !ok {
+		return nil, false
+	}
+	copied := *c
+	return &copied, true
+}
+
+// FailNext makes the next n calls of Pull or Push return ErrInjected
+func (s *MemoryRemoteStore[R]) FailNext(n int) {
+	s.mu.Lock()
+	s.failures = n
+	s.mu.Unlock()
+}
+
+func (s *MemoryRemoteStore[R]) put(c *SyncChange[R]) {
+	s.records[c.LocalID] = c
+	s.log = append(s.log, c.LocalID)
+}
+
+func (s *MemoryRemoteStore[R]) fail() error {
+	if s.failures > 0 {
+		s.failures--
+		return ErrInjected
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package xsqlite_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"code.olapie.com/sugar/v2/xerror"
+	"code.olapie.com/sugar/v2/xsqlite"
+	"code.olapie.com/sugar/v2/xtest"
+	"code.olapie.com/sugar/v2/xtype"
+	"github.com/google/uuid"
+)
+
+type syncClient struct {
+	table  *xsqlite.LocalTable[*localTableItem]
+	syncer *xsqlite.Syncer[*localTableItem]
+}
+
+func setupSyncClient(t testing.TB, store xsqlite.RemoteStore[*localTableItem], optFns ...func(options *xsqlite.SyncerOptions[*localTableItem])) *syncClient {
+	filename := "testdata/syncer" + xtype.NextID().Pretty() + ".db"
+	db, err := xsqlite.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(
+		func() {
+			db.Close()
+			os.Remove(filename)
+		})
+	table := xsqlite.NewLocalTable[*localTableItem](db, func(opts *xsqlite.LocalTableOptions[*localTableItem]) {
+		opts.Password = xtest.RandomString(10)
+	})
+	optFns = append([]func(options *xsqlite.SyncerOptions[*localTableItem]){func(options *xsqlite.SyncerOptions[*localTableItem]) {
+		options.Backoff = func(attempt int) time.Duration {
+			return 0
+		}
+	}}, optFns...)
+	return &syncClient{
+		table:  table,
+		syncer: xsqlite.NewSyncer(table, store, xsqlite.NewKVTable(db), optFns...),
+	}
+}
+
+func TestSyncer_Sync(t *testing.T) {
+	ctx := context.TODO()
+	store := xsqlite.NewMemoryRemoteStore[*localTableItem](nil)
+	a := setupSyncClient(t, store)
+	b := setupSyncClient(t, store)
+
+	item := newLocalTableItem()
+	localID := uuid.NewString()
+	xtest.NoError(t, a.table.SaveLocal(ctx, localID, 1, item))
+	xtest.NoError(t, a.syncer.Sync(ctx))
+	locals, err := a.table.ListLocals(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, 0, len(locals))
+	remotes, err := a.table.ListRemotes(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, 1, len(remotes))
+
+	xtest.NoError(t, b.syncer.Sync(ctx))
+	record, err := b.table.Get(ctx, localID)
+	xtest.NoError(t, err)
+	xtest.Equal(t, item, record)
+
+	item.Text = "updated by b"
+	xtest.NoError(t, b.table.UpdateRemote(ctx, localID, item))
+	xtest.NoError(t, b.syncer.Sync(ctx))
+	updates, err := b.table.ListUpdates(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, 0, len(updates))
+
+	xtest.NoError(t, a.syncer.Sync(ctx))
+	record, err = a.table.Get(ctx, localID)
+	xtest.NoError(t, err)
+	xtest.Equal(t, "updated by b", record.Text)
+
+	xtest.NoError(t, a.table.Delete(ctx, localID))
+	xtest.NoError(t, a.syncer.Sync(ctx))
+	deletions, err := a.table.ListDeletions(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, 0, len(deletions))
+
+	xtest.NoError(t, b.syncer.Sync(ctx))
+	_, err = b.table.Get(ctx, localID)
+	xtest.True(t, errors.Is(err, xerror.NotExist), err)
+}
+
+func TestSyncer_Pages(t *testing.T) {
+	ctx := context.TODO()
+	store := xsqlite.NewMemoryRemoteStore[*localTableItem](nil)
+	store.PageSize = 3
+	for i := 0; i < 10; i++ {
+		store.Put(&xsqlite.SyncChange[*localTableItem]{
+			LocalID:    uuid.NewString(),
+			Record:     newLocalTableItem(),
+			UpdateTime: time.Now().Unix(),
+		})
+	}
+
+	var events []xsqlite.SyncEvent
+	c := setupSyncClient(t, store, func(options *xsqlite.SyncerOptions[*localTableItem]) {
+		options.OnProgress = func(e xsqlite.SyncEvent) {
+			events = append(events, e)
+		}
+	})
+	xtest.NoError(t, c.syncer.Sync(ctx))
+	remotes, err := c.table.ListRemotes(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, 10, len(remotes))
+	xtest.Equal(t, 5, len(events))
+	xtest.Equal(t, xsqlite.SyncDone, events[4].Phase)
+	xtest.Equal(t, 10, events[4].Pulled)
+
+	// cursor is saved, so nothing is pulled again
+	events = nil
+	xtest.NoError(t, c.syncer.Sync(ctx))
+	xtest.Equal(t, 0, events[len(events)-1].Pulled)
+
+	xtest.NoError(t, c.syncer.ResetCursor())
+	events = nil
+	xtest.NoError(t, c.syncer.Sync(ctx))
+	xtest.Equal(t, 10, events[len(events)-1].Pulled)
+}
+
+func TestSyncer_Conflict(t *testing.T) {
+	ctx := context.TODO()
+	setup := func(t *testing.T, optFns ...func(options *xsqlite.SyncerOptions[*localTableItem])) (*xsqlite.MemoryRemoteStore[*localTableItem], *syncClient, string) {
+		store := xsqlite.NewMemoryRemoteStore[*localTableItem](nil)
+		c := setupSyncClient(t, store, optFns...)
+		localID := uuid.NewString()
+		item := newLocalTableItem()
+		xtest.NoError(t, c.table.SaveRemote(ctx, localID, 0, item, 1))
+		item.Text = "local"
+		xtest.NoError(t, c.table.UpdateRemote(ctx, localID, item))
+		return store, c, localID
+	}
+
+	putRemote := func(store *xsqlite.MemoryRemoteStore[*localTableItem], localID string, updateTime int64) {
+		item := newLocalTableItem()
+		item.Text = "remote"
+		store.Put(&xsqlite.SyncChange[*localTableItem]{
+			LocalID:    localID,
+			Record:     item,
+			UpdateTime: updateTime,
+		})
+	}
+
+	t.Run("LastWriterWins", func(t *testing.T) {
+		store, c, localID := setup(t)
+		putRemote(store, localID, time.Now().Add(-time.Hour).Unix())
+		xtest.NoError(t, c.syncer.Sync(ctx))
+		record, err := c.table.Get(ctx, localID)
+		xtest.NoError(t, err)
+		xtest.Equal(t, "local", record.Text)
+		remote, _ := store.Get(localID)
+		xtest.Equal(t, "local", remote.Record.Text)
+
+		store, c, localID = setup(t)
+		putRemote(store, localID, time.Now().Add(time.Hour).Unix())
+		xtest.NoError(t, c.syncer.Sync(ctx))
+		record, err = c.table.Get(ctx, localID)
+		xtest.NoError(t, err)
+		xtest.Equal(t, "remote", record.Text)
+	})
+
+	t.Run("ClientWins", func(t *testing.T) {
+		store, c, localID := setup(t, func(options *xsqlite.SyncerOptions[*localTableItem]) {
+			options.Policy = xsqlite.ClientWins
+		})
+		putRemote(store, localID, time.Now().Add(time.Hour).Unix())
+		xtest.NoError(t, c.syncer.Sync(ctx))
+		record, err := c.table.Get(ctx, localID)
+		xtest.NoError(t, err)
+		xtest.Equal(t, "local", record.Text)
+	})
+
+	t.Run("ServerWins", func(t *testing.T) {
+		store, c, localID := setup(t, func(options *xsqlite.SyncerOptions[*localTableItem]) {
+			options.Policy = xsqlite.ServerWins
+		})
+		putRemote(store, localID, time.Now().Add(-time.Hour).Unix())
+		xtest.NoError(t, c.syncer.Sync(ctx))
+		record, err := c.table.Get(ctx, localID)
+		xtest.NoError(t, err)
+		xtest.Equal(t, "remote", record.Text)
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		store, c, localID := setup(t, func(options *xsqlite.SyncerOptions[*localTableItem]) {
+			options.Merge = func(local, remote *xsqlite.SyncChange[*localTableItem]) (*xsqlite.SyncChange[*localTableItem], error) {
+				merged := *remote
+				item := *remote.Record
+				item.Text = local.Record.Text + "+" + remote.Record.Text
+				merged.Record = &item
+				return &merged, nil
+			}
+		})
+		putRemote(store, localID, time.Now().Unix())
+		xtest.NoError(t, c.syncer.Sync(ctx))
+		record, err := c.table.Get(ctx, localID)
+		xtest.NoError(t, err)
+		xtest.Equal(t, "local+remote", record.Text)
+		remote, _ := store.Get(localID)
+		xtest.Equal(t, "local+remote", remote.Record.Text)
+	})
+}
+
+func TestSyncer_Retry(t *testing.T) {
+	ctx := context.TODO()
+	store := xsqlite.NewMemoryRemoteStore[*localTableItem](nil)
+	var retries int
+	c := setupSyncClient(t, store, func(options *xsqlite.SyncerOptions[*localTableItem]) {
+		options.MaxAttempts = 3
+		options.OnProgress = func(e xsqlite.SyncEvent) {
+			if e.Phase == xsqlite.SyncRetrying {
+				retries++
+			}
+		}
+	})
+	localID := uuid.NewString()
+	xtest.NoError(t, c.table.SaveLocal(ctx, localID, 0, newLocalTableItem()))
+
+	store.FailNext(2)
+	xtest.NoError(t, c.syncer.Sync(ctx))
+	xtest.Equal(t, 2, retries)
+	_, ok := store.Get(localID)
+	xtest.True(t, ok)
+
+	store.FailNext(3)
+	err := c.syncer.Sync(ctx)
+	xtest.True(t, errors.Is(err, xsqlite.ErrInjected), err)
+}
+
+type pushHookStore struct {
+	*xsqlite.MemoryRemoteStore[*localTableItem]
+	beforePush func()
+}
+
+func (s *pushHookStore) Push(ctx context.Context, req *xsqlite.PushRequest[*localTableItem]) (*xsqlite.PushResult, error) {
+	if s.beforePush != nil {
+		s.beforePush()
+		s.beforePush = nil
+	}
+	return s.MemoryRemoteStore.Push(ctx, req)
+}
+
+func TestSyncer_ChangedWhilePushing(t *testing.T) {
+	ctx := context.TODO()
+	store := &pushHookStore{MemoryRemoteStore: xsqlite.NewMemoryRemoteStore[*localTableItem](nil)}
+	// pushed changes are pulled back, which are older than pending changes
+	c := setupSyncClient(t, store, func(options *xsqlite.SyncerOptions[*localTableItem]) {
+		options.Policy = xsqlite.ClientWins
+	})
+	localID := uuid.NewString()
+	item := newLocalTableItem()
+	xtest.NoError(t, c.table.SaveLocal(ctx, localID, 0, item))
+
+	// changed in the same second, after it has been read for pushing
+	store.beforePush = func() {
+		item.Text = "changed while pushing"
+		xtest.NoError(t, c.table.SaveLocal(ctx, localID, 0, item))
+	}
+	xtest.NoError(t, c.syncer.Sync(ctx))
+	locals, err := c.table.ListLocals(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, 1, len(locals))
+	xtest.NoError(t, c.syncer.Sync(ctx))
+	remote, _ := store.Get(localID)
+	xtest.Equal(t, "changed while pushing", remote.Record.Text)
+
+	item.Text = "updated"
+	xtest.NoError(t, c.table.UpdateRemote(ctx, localID, item))
+	store.beforePush = func() {
+		item.Text = "updated while pushing"
+		xtest.NoError(t, c.table.UpdateRemote(ctx, localID, item))
+	}
+	xtest.NoError(t, c.syncer.Sync(ctx))
+	updates, err := c.table.ListUpdates(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, 1, len(updates))
+
+	xtest.NoError(t, c.syncer.Sync(ctx))
+	updates, err = c.table.ListUpdates(ctx)
+	xtest.NoError(t, err)
+	xtest.Equal(t, 0, len(updates))
+	remote, _ = store.Get(localID)
+	xtest.Equal(t, "updated while pushing", remote.Record.Text)
+}
@@ -0,0 +1,132 @@
+package xsqlite_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"code.olapie.com/sugar/v2/xsql"
+	"code.olapie.com/sugar/v2/xtest"
+)
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string {
+	return "sql state " + string(e)
+}
+
+func (e sqlStateError) SQLState() string {
+	return string(e)
+}
+
+func TestIsSerializationFailure(t *testing.T) {
+	xtest.True(t, xsql.IsSerializationFailure(fmt.Errorf("commit: %w", sqlStateError("40001"))))
+	xtest.True(t, xsql.IsSerializationFailure(errors.New("database is locked")))
+	xtest.False(t, xsql.IsSerializationFailure(sqlStateError("23505")))
+	xtest.False(t, xsql.IsSerializationFailure(nil))
+}
+
+func TestDB_RunInTx(t *testing.T) {
+	ctx := context.TODO()
+	db := setupXSQLDB(t)
+	count := func() int {
+		n, err := db.Table("users").CountContext(ctx, "")
+		xtest.NoError(t, err)
+		return n
+	}
+
+	err := db.RunInTx(ctx, nil, func(tx *xsql.Tx) error {
+		return tx.InsertContext(ctx, &dialectUser{Name: "tom"})
+	})
+	xtest.NoError(t, err)
+	xtest.Equal(t, 1, count())
+
+	t.Run("Rollback", func(t *testing.T) {
+		errTest := errors.New("test")
+		err := db.RunInTx(ctx, nil, func(tx *xsql.Tx) error {
+			xtest.NoError(t, tx.InsertContext(ctx, &dialectUser{Name: "jim"}))
+			return errTest
+		})
+		xtest.True(t, errors.Is(err, errTest), err)
+		xtest.Equal(t, 1, count())
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		func() {
+			defer func() {
+				xtest.Equal(t, "test", recover())
+			}()
+			db.RunInTx(ctx, nil, func(tx *xsql.Tx) error {
+				xtest.NoError(t, tx.InsertContext(ctx, &dialectUser{Name: "jim"}))
+				panic("test")
+			})
+		}()
+		xtest.Equal(t, 1, count())
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		var backoffs []int
+		opts := &xsql.TxOptions{
+			MaxAttempts: 3,
+			Backoff: func(attempt int) time.Duration {
+				backoffs = append(backoffs, attempt)
+				return time.Millisecond
+			},
+		}
+		attempts := 0
+		err := db.RunInTx(ctx, opts, func(tx *xsql.Tx) error {
+			attempts++
+			xtest.NoError(t, tx.InsertContext(ctx, &dialectUser{Name: "jim"}))
+			if attempts < 3 {
+				return sqlStateError("40001")
+			}
+			return nil
+		})
+		xtest.NoError(t, err)
+		xtest.Equal(t, 3, attempts)
+		xtest.Equal(t, []int{1, 2}, backoffs)
+		xtest.Equal(t, 2, count())
+
+		attempts = 0
+		err = db.RunInTx(ctx, opts, func(tx *xsql.Tx) error {
+			attempts++
+			return sqlStateError("40001")
+		})
+		xtest.Error(t, err)
+		xtest.Equal(t, 3, attempts)
+	})
+
+	t.Run("AttemptTimeout", func(t *testing.T) {
+		opts := &xsql.TxOptions{
+			AttemptTimeout: 50 * time.Millisecond,
+			Backoff: func(attempt int) time.Duration {
+				return time.Millisecond
+			},
+		}
+		attempts := 0
+		err := db.RunInTx(ctx, opts, func(tx *xsql.Tx) error {
+			attempts++
+			if attempts == 1 {
+				time.Sleep(100 * time.Millisecond)
+			}
+			return tx.InsertContext(ctx, &dialectUser{Name: "lucy"})
+		})
+		xtest.NoError(t, err)
+		xtest.Equal(t, 2, attempts)
+		xtest.Equal(t, 3, count())
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		opts := &xsql.TxOptions{
+			Timeout: 50 * time.Millisecond,
+		}
+		err := db.RunInTx(ctx, opts, func(tx *xsql.Tx) error {
+			time.Sleep(100 * time.Millisecond)
+			return tx.InsertContext(ctx, &dialectUser{Name: "lily"})
+		})
+		xtest.Error(t, err)
+		xtest.Equal(t, 3, count())
+	})
+}